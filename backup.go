@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/LYcoding0/dbbackup/internal/compress"
+	"github.com/LYcoding0/dbbackup/internal/crypt"
+	"github.com/LYcoding0/dbbackup/internal/manifest"
+)
+
+// runBackup 执行一次备份，并在备份旁写入清单文件
+func runBackup(d Driver, t *Target, outputDir string) (*manifest.Manifest, error) {
+	m := manifest.New("")
+	m.Engine = d.Name()
+	m.Host = net.JoinHostPort(t.Host, t.Port)
+	if version, err := d.ServerVersion(t); err != nil {
+		fmt.Printf("Warning: failed to get server version: %v\n", err)
+	} else {
+		m.ServerVersion = version
+	}
+
+	result, err := d.Backup(t, outputDir)
+	if result == nil || result.Path == "" {
+		// 尚未产生任何文件，无需写清单
+		return nil, err
+	}
+
+	m.Name = backupName(result.Path)
+	m.Tool = result.Tool
+	m.ToolVersion = manifest.ToolVersion(result.Tool)
+	m.BackupType = result.BackupType
+	m.Compression = result.Compress
+	if t.Output.EncryptKey != nil {
+		m.Encryption = &manifest.Encryption{Algorithm: crypt.Algorithm, KeyFingerprint: t.Output.EncryptKey.Fingerprint()}
+	}
+	m.Databases = result.Databases
+	if len(m.Databases) == 0 && err == nil {
+		if databases, listErr := d.ListDatabases(t); listErr != nil {
+			fmt.Printf("Warning: failed to list databases: %v\n", listErr)
+		} else {
+			m.Databases = databases
+		}
+	}
+
+	// 失败时也记录已产生的部分文件，便于排查
+	if _, statErr := os.Stat(result.Path); statErr == nil {
+		if hashErr := m.AddPath(outputDir, result.Path); hashErr != nil && err == nil {
+			err = fmt.Errorf("failed to checksum backup: %v", hashErr)
+		}
+	}
+	m.Finish(err)
+
+	manifestPath := manifest.PathFor(outputDir, m.Name)
+	if writeErr := manifest.Write(manifestPath, m); writeErr != nil {
+		if err == nil {
+			err = writeErr
+		}
+		return m, err
+	}
+	fmt.Printf("Manifest written: %s\n", manifestPath)
+	return m, err
+}
+
+// backupName 由备份文件或目录路径得到备份名（去掉扩展名）
+func backupName(path string) string {
+	name := compress.TrimExt(strings.TrimSuffix(filepath.Base(path), crypt.Ext))
+	if i := strings.Index(name, ".archive"); i >= 0 {
+		name = name[:i]
+	}
+	return strings.TrimSuffix(name, ".sql")
+}
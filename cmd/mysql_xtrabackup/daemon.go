@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/LYcoding0/dbbackup/internal/metrics"
+	"github.com/LYcoding0/dbbackup/internal/schedule"
+)
+
+// daemonLock 所有计划共用一把锁，全量和增量备份不会同时执行。
+const daemonLock = "xtrabackup"
+
+// daemonMetrics daemon 模式下各次备份共用的指标，由 /metrics 提供；非 daemon 模式为 nil
+var daemonMetrics *metrics.Registry
+
+// runDaemon 按 schedules 定时执行备份，直到收到 SIGINT/SIGTERM；收到 SIGHUP 时重新加载配置。
+func runDaemon(cfgPath string, cfg *Config, skipRemote bool) error {
+	jobs, err := daemonJobs(cfg, skipRemote)
+	if err != nil {
+		return err
+	}
+	runner := schedule.NewRunner(daemonLogf)
+	runner.Set(jobs)
+
+	// 从 textfile 恢复之前的值，重启后计数器和上次成功时间不会丢失
+	if daemonMetrics, err = metrics.Load(cfg.Metrics.Textfile); err != nil {
+		daemonLogf("load metrics %s: %v", cfg.Metrics.Textfile, err)
+		daemonMetrics = metrics.New()
+	}
+	if cfg.Metrics.Listen != "" {
+		srv, err := metrics.Serve(cfg.Metrics.Listen, daemonMetrics)
+		if err != nil {
+			return fmt.Errorf("metrics listen: %w", err)
+		}
+		defer srv.Close()
+		daemonLogf("serving metrics on http://%s/metrics", cfg.Metrics.Listen)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				daemonLogf("reloading %s", cfgPath)
+				newJobs, err := reloadDaemonJobs(cfgPath, skipRemote)
+				if err != nil {
+					daemonLogf("reload failed, keeping previous config: %v", err)
+					continue
+				}
+				runner.Set(newJobs)
+			}
+		}
+	}()
+
+	daemonLogf("daemon started, pid %d", os.Getpid())
+	runner.Run(ctx)
+	daemonLogf("daemon stopped")
+	return nil
+}
+
+// reloadDaemonJobs 重新读取并检查配置，生成定时任务。
+func reloadDaemonJobs(cfgPath string, skipRemote bool) ([]schedule.Job, error) {
+	cfg, err := loadConfig(cfgPath)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.BackupType == "" {
+		cfg.BackupType = "full"
+	}
+	if err := validateConfig(cfg); err != nil {
+		return nil, err
+	}
+	return daemonJobs(cfg, skipRemote)
+}
+
+// daemonJobs 每个计划生成一个任务，执行时使用计划中的备份类型。
+func daemonJobs(cfg *Config, skipRemote bool) ([]schedule.Job, error) {
+	if len(cfg.Schedules) == 0 {
+		return nil, errors.New("schedules is empty, nothing to run in daemon mode")
+	}
+	var jobs []schedule.Job
+	for _, s := range cfg.Schedules {
+		sched, err := schedule.Parse(s.Cron)
+		if err != nil {
+			return nil, err
+		}
+		runCfg := *cfg
+		runCfg.BackupType = s.Type
+		jobs = append(jobs, schedule.Job{
+			Name:     fmt.Sprintf("%s[%s]", s.Type, s.Cron),
+			Schedule: sched,
+			Lock:     daemonLock,
+			Overlap:  cfg.Overlap,
+			Run: func() {
+				if err := runBackupJob(&runCfg, skipRemote); err != nil {
+					daemonLogf("%s backup failed: %v", runCfg.BackupType, err)
+				}
+			},
+		})
+	}
+	return jobs, nil
+}
+
+func daemonLogf(format string, args ...interface{}) {
+	fmt.Printf("[%s] "+format+"\n", append([]interface{}{timeStamp()}, args...)...)
+}
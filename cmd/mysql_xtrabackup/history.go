@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/LYcoding0/dbbackup/internal/history"
+	"github.com/LYcoding0/dbbackup/internal/manifest"
+)
+
+// historyPath 运行记录文件，默认 <log_dir>/history.jsonl，history_file 为 "-" 时不记录。
+func historyPath(cfg *Config) string {
+	switch cfg.HistoryFile {
+	case "-":
+		return ""
+	case "":
+		logDir := cfg.LogDir
+		if logDir == "" {
+			logDir = filepath.Join(cfg.BackupDir, "log")
+		}
+		return filepath.Join(logDir, "history.jsonl")
+	}
+	return cfg.HistoryFile
+}
+
+// recordHistory 追加本次备份的记录，包括失败的备份，写入失败只输出到标准错误。
+func recordHistory(cfg *Config, res *backupResult, start time.Time, err error, warnings []string) {
+	path := historyPath(cfg)
+	if path == "" {
+		return
+	}
+	e := &history.Entry{
+		Tool:     "mysql_xtrabackup",
+		Job:      cfg.BackupPrefix,
+		Type:     cfg.BackupType,
+		Host:     mysqlAddr(cfg),
+		Status:   history.StatusSuccess,
+		Start:    start,
+		End:      time.Now(),
+		Warnings: warnings,
+	}
+	if err != nil {
+		e.Status, e.Error = history.StatusFailure, err.Error()
+	}
+	if res != nil {
+		e.Backups = []string{res.BackupName}
+		e.Location = res.ArchivePath
+		e.Log = res.LogPath
+		if res.ManifestPath != "" {
+			e.Manifests = []string{res.ManifestPath}
+		}
+		if m, err := manifest.Read(res.ManifestPath); err == nil && m.Status == manifest.StatusSuccess {
+			e.Size = m.Size
+		}
+	}
+	if err := history.Append(path, e); err != nil {
+		fmt.Fprintf(os.Stderr, "record history failed: %v\n", err)
+	}
+}
+
+// runHistory 按条件输出运行记录。
+func runHistory(cfg *Config, f history.Filter, asJSON bool) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	path := historyPath(cfg)
+	if path == "" {
+		return fmt.Errorf("history is disabled (history_file is \"-\")")
+	}
+	entries, skipped, err := history.Read(path, f)
+	if err != nil {
+		return err
+	}
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "warning: skipped %d unreadable line(s) in %s\n", skipped, path)
+	}
+	return history.Print(os.Stdout, entries, asJSON)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/LYcoding0/dbbackup/internal/manifest"
+	"github.com/LYcoding0/dbbackup/internal/xtrabackup"
+)
+
+// 备份类型：incr 以最近一次成功的备份（全量或增量）为基线，只包含其后的变化；
+// diff（差异）始终以最近一次成功的全量备份为基线，恢复时只需要全量和这一份。
+var backupTypes = []string{"full", "incr", "diff"}
+
+func validBackupType(t string) bool {
+	for _, v := range backupTypes {
+		if t == v {
+			return true
+		}
+	}
+	return false
+}
+
+// incrementalBase 可作为增量基线的本地备份目录（流式备份为 --extra-lsndir）。
+type incrementalBase struct {
+	Name        string
+	Dir         string
+	Time        time.Time
+	Parent      string // 清单中的基线
+	Checkpoints *xtrabackup.Checkpoints
+	Err         error // 不能作为基线的原因
+}
+
+// localBases 列出 backup_dir 中的备份目录并逐个检查能否作为基线，按时间升序。
+func localBases(cfg *Config) ([]*incrementalBase, error) {
+	entries, err := os.ReadDir(cfg.BackupDir)
+	if err != nil {
+		return nil, fmt.Errorf("read backup_dir: %w", err)
+	}
+	var bases []*incrementalBase
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		_, t, ok := parseBackupName(cfg.BackupPrefix, e.Name())
+		if !ok {
+			continue
+		}
+		b := &incrementalBase{Name: e.Name(), Dir: filepath.Join(cfg.BackupDir, e.Name()), Time: t}
+		b.Err = checkBase(cfg, b)
+		bases = append(bases, b)
+	}
+	// 名称中含类型，不能直接按字符串排序
+	sort.Slice(bases, func(i, j int) bool { return bases[i].Time.Before(bases[j].Time) })
+	return bases, nil
+}
+
+// checkBase 检查备份能否作为基线：清单为成功状态，打包的归档仍在，
+// xtrabackup_checkpoints 为未 prepare 的全量或增量备份且 LSN 自洽。
+// 中途失败或被强制结束的 xtrabackup 留下的目录没有成功的清单，不会被选中。
+func checkBase(cfg *Config, b *incrementalBase) error {
+	m, err := manifest.Read(manifest.PathFor(cfg.BackupDir, b.Name))
+	if os.IsNotExist(err) {
+		return errors.New("no manifest, the backup did not finish")
+	} else if err != nil {
+		return err
+	}
+	if m.Status != manifest.StatusSuccess {
+		if m.Error != "" {
+			return fmt.Errorf("backup %s: %s", m.Status, m.Error)
+		}
+		return fmt.Errorf("backup %s", m.Status)
+	}
+	// 流式备份的归档只在存储中
+	for _, top := range topPaths(m) {
+		if _, archive := trimArchiveExt(top); archive && !isXbstream(top) {
+			if _, err := os.Stat(filepath.Join(cfg.BackupDir, top)); err != nil {
+				return fmt.Errorf("archive %s is missing", top)
+			}
+		}
+	}
+	cp, err := xtrabackup.ReadCheckpoints(b.Dir)
+	if err != nil {
+		return err
+	}
+	if cp.BackupType != xtrabackup.TypeFull && cp.BackupType != xtrabackup.TypeIncremental {
+		return fmt.Errorf("backup_type is %s, want %s or %s", cp.BackupType, xtrabackup.TypeFull, xtrabackup.TypeIncremental)
+	}
+	if err := cp.Validate(); err != nil {
+		return err
+	}
+	b.Parent, b.Checkpoints = m.Parent, cp
+	return nil
+}
+
+// findIncrementalBase 按备份类型选择基线：incr 取最近一次成功的备份，diff 取最近一次成功的全量备份，
+// 跳过的备份及原因写入 logger。基线沿清单中的 parent 回到全量备份的每一环都必须可用且 LSN 连续。
+func findIncrementalBase(cfg *Config, backupType string, logger io.Writer) (*incrementalBase, error) {
+	bases, err := localBases(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var base *incrementalBase
+	for i := len(bases) - 1; i >= 0 && base == nil; i-- {
+		b := bases[i]
+		switch {
+		case b.Err != nil:
+			fmt.Fprintf(logger, "[%s] skip base %s: %v\n", timeStamp(), b.Name, b.Err)
+		case backupType == "incr" || b.Checkpoints.BackupType == xtrabackup.TypeFull:
+			base = b
+		}
+	}
+	if base == nil {
+		return nil, errors.New("no usable full backup found, run a full backup first")
+	}
+	if err := checkChain(bases, base); err != nil {
+		return nil, fmt.Errorf("chain of %s is broken: %w, run a full backup first", base.Name, err)
+	}
+	return base, nil
+}
+
+// checkChain 检查从 b 回到全量备份的链路：每个基线都可用，增量备份的 from_lsn 等于其基线的 to_lsn。
+func checkChain(bases []*incrementalBase, b *incrementalBase) error {
+	byName := map[string]*incrementalBase{}
+	for _, base := range bases {
+		byName[base.Name] = base
+	}
+	for seen := map[string]bool{}; b.Checkpoints.BackupType != xtrabackup.TypeFull; {
+		if seen[b.Name] {
+			return fmt.Errorf("parent loop at %s", b.Name)
+		}
+		seen[b.Name] = true
+		if b.Parent == "" {
+			return fmt.Errorf("%s has no parent in its manifest", b.Name)
+		}
+		parent := byName[b.Parent]
+		if parent == nil {
+			return fmt.Errorf("parent %s of %s not found in backup_dir", b.Parent, b.Name)
+		}
+		if parent.Err != nil {
+			return fmt.Errorf("parent %s of %s: %v", parent.Name, b.Name, parent.Err)
+		}
+		if parent.Checkpoints.ToLSN != b.Checkpoints.FromLSN {
+			return fmt.Errorf("%s starts at lsn %d but its parent %s ends at %d",
+				b.Name, b.Checkpoints.FromLSN, parent.Name, parent.Checkpoints.ToLSN)
+		}
+		b = parent
+	}
+	return nil
+}
+
+// checkIncremental 检查刚完成的增量备份从基线的 to_lsn 开始，dir 为备份目录或 --extra-lsndir。
+func checkIncremental(dir string, base *incrementalBase) error {
+	cp, err := xtrabackup.ReadCheckpoints(dir)
+	if err != nil {
+		return err
+	}
+	if err := cp.Validate(); err != nil {
+		return err
+	}
+	if cp.BackupType != xtrabackup.TypeIncremental || cp.FromLSN != base.Checkpoints.ToLSN {
+		return fmt.Errorf("%s is %s from lsn %d, want incremental from %s at lsn %d",
+			xtrabackup.CheckpointsFile, cp.BackupType, cp.FromLSN, base.Name, base.Checkpoints.ToLSN)
+	}
+	return nil
+}
+
+// backupChain 沿清单中的 parent 返回从全量备份到 name 的链路，用于通知；清单缺失时链路到此为止。
+func backupChain(cfg *Config, name string) []string {
+	chain := []string{name}
+	for seen := map[string]bool{name: true}; ; {
+		m, err := manifest.Read(manifest.PathFor(cfg.BackupDir, name))
+		if err != nil || m.Parent == "" || seen[m.Parent] {
+			break
+		}
+		name = m.Parent
+		seen[name] = true
+		chain = append([]string{name}, chain...)
+	}
+	return chain
+}
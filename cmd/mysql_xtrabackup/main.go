@@ -1,31 +1,50 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"net/http"
+	"net"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"sort"
 	"strings"
 	"time"
+
+	"github.com/LYcoding0/dbbackup/internal/compress"
+	"github.com/LYcoding0/dbbackup/internal/crypt"
+	"github.com/LYcoding0/dbbackup/internal/history"
+	"github.com/LYcoding0/dbbackup/internal/manifest"
+	"github.com/LYcoding0/dbbackup/internal/metrics"
+	"github.com/LYcoding0/dbbackup/internal/notify"
+	"github.com/LYcoding0/dbbackup/internal/retention"
+	"github.com/LYcoding0/dbbackup/internal/schedule"
+	"github.com/LYcoding0/dbbackup/internal/storage"
 )
 
 // Config 备份工具的 JSON 配置。
 type Config struct {
-	BackupType    string `json:"backup_type"`    // full 或 incr
+	BackupType    string `json:"backup_type"`    // full、incr（增量）或 diff（差异）
 	BackupDir     string `json:"backup_dir"`     // 本地备份根目录
 	BackupPrefix  string `json:"backup_prefix"`  // 备份命名前缀
-	RetentionDays int    `json:"retention_days"` // 保留天数
+	RetentionDays int    `json:"retention_days"` // 保留天数，等同于 retention.days
 	TarArchive    bool   `json:"tar_archive"`    // 是否打包为 tar.gz
 
 	LogDir string `json:"log_dir"` // 可选，默认 <BackupDir>/log
 
+	// 本地和各目的地的默认保留策略（按天数和 GFS），备份时间取自备份名
+	Retention retention.Policy `json:"retention"`
+
+	// daemon 模式的定时计划，例如每周日全量、每小时增量
+	Schedules []struct {
+		Type string `json:"type"` // full 或 incr
+		Cron string `json:"cron"` // cron 表达式，例如 "0 2 * * 0"
+	} `json:"schedules"`
+	Overlap string `json:"overlap"` // 上次备份未结束时：skip（默认）或 queue
+
 	MySQL struct {
 		DefaultsFile string `json:"defaults_file"` // my.cnf 路径
 		Socket       string `json:"socket"`        // 优先使用 socket
@@ -43,6 +62,13 @@ type Config struct {
 		ExtraArgs       []string `json:"extra_args"`       // 额外参数
 	} `json:"xtrabackup"`
 
+	// 备份上传位置，见 internal/storage；为空且 remote.enabled=true 时按 remote 使用 SFTP
+	Storage storage.Config `json:"storage"`
+
+	// 多个上传目的地，与 storage/remote 二选一；只配置 storage 时视为名为 default 的唯一目的地
+	Destinations []Destination `json:"destinations"`
+
+	// 旧版 scp 配置，保留兼容
 	Remote struct {
 		Enabled bool   `json:"enabled"` // 是否上传远端
 		User    string `json:"user"`
@@ -51,28 +77,87 @@ type Config struct {
 		DestDir string `json:"dest_dir"`
 	} `json:"remote"`
 
+	// 流式备份：xtrabackup --stream=xbstream 的输出直接上传到 storage，本地只保留 LSN 信息
+	Stream struct {
+		Enabled       bool   `json:"enabled"`
+		Compress      string `json:"compress"`       // none、gzip 或 zstd
+		CompressLevel int    `json:"compress_level"` // 0 表示默认级别
+	} `json:"stream"`
+
+	Encryption struct {
+		Enabled bool   `json:"enabled"`  // 是否加密 tar 归档或 xbstream 流，需 tar_archive=true 或 stream.enabled=true
+		KeyFile string `json:"key_file"` // AES-256 密钥文件，恢复加密归档时也需要
+	} `json:"encryption"`
+
+	// 通知通道，例如飞书、钉钉、邮件，每个通道可设置发送条件
+	Notify []notify.Config `json:"notify"`
+
+	// 兼容旧配置，enabled 时等同于 notify 中的一个 feishu 通道
 	Feishu struct {
 		Enabled bool   `json:"enabled"` // 是否发送飞书通知
 		Webhook string `json:"webhook"` // 飞书机器人 webhook
 		Keyword string `json:"keyword"` // 飞书安全关键字，需出现在文本
 	} `json:"feishu"`
+
+	// Prometheus 指标：每次备份后写入 textfile，daemon 模式下在 listen 上提供 /metrics
+	Metrics metrics.Config `json:"metrics"`
+
+	// 运行记录（JSONL），默认 <log_dir>/history.jsonl，"-" 表示不记录；用 -mode history 查询
+	HistoryFile string `json:"history_file"`
+
+	key *crypt.Key // 由 encryption.key_file 加载
 }
 
+// Destination 一个上传目的地，存储字段与 storage 相同。
+type Destination struct {
+	Name string `json:"name"`
+	storage.Config
+	Optional      bool             `json:"optional"`       // 可选目的地上传失败只告警，不影响备份结果
+	RetentionDays int              `json:"retention_days"` // 等同于 retention.days，-1 表示不清理
+	Retention     retention.Policy `json:"retention"`      // 都未设置时使用顶层的保留策略
+}
+
+// notifyStateFile backup_dir 中记录上一次备份结果的文件，用于判断是否恢复
+const notifyStateFile = ".notify_state.json"
+
 type backupResult struct {
-	BackupName  string
-	TargetDir   string
-	ArchivePath string
-	LogPath     string
+	BackupName   string
+	TargetDir    string
+	ArchivePath  string // 流式备份时为存储中的位置
+	Streamed     bool
+	LogPath      string
+	ManifestPath string
 }
 
 func main() {
 	var cfgPath string
 	var backupTypeOverride string
 	var skipRemote bool
+	var fetch bool
+	var from string
+	var dryRun bool
+	var mode string
+	var restoreOpts restoreOptions
+	var historyFilter history.Filter
+	var since, until string
+	var asJSON bool
 
 	flag.StringVar(&cfgPath, "config", "config/mysql_backup.json", "Path to config file (JSON)")
-	flag.StringVar(&backupTypeOverride, "type", "", "Override backup type: full or incr")
-	flag.BoolVar(&skipRemote, "skip-remote", false, "Skip sending to remote storage even if enabled")
+	flag.StringVar(&backupTypeOverride, "type", "", "Override backup type: full, incr (incremental) or diff (differential); in history mode only show runs of this type")
+	flag.BoolVar(&skipRemote, "skip-remote", false, "Skip uploading to storage even if configured")
+	flag.BoolVar(&fetch, "fetch", false, "Download the backup chain from storage into backup_dir before prepare/restore")
+	flag.StringVar(&from, "from", "", "Destination to fetch from (default the first one)")
+	flag.BoolVar(&dryRun, "dry-run", false, "Only report what would be removed (prune mode)")
+	flag.StringVar(&mode, "mode", "backup", "Run mode: backup, upload, prune, prepare, restore, verify, daemon or history")
+	flag.StringVar(&restoreOpts.Backup, "backup", "", "Backup name or path to upload/prepare/restore (default latest) or verify (default all)")
+	flag.StringVar(&restoreOpts.WorkDir, "work-dir", "", "Directory to prepare the backup chain in (default <backup_dir>/restore_<ts>)")
+	flag.StringVar(&restoreOpts.TargetDatadir, "target-datadir", "", "Empty MySQL datadir to copy the prepared backup into (restore mode)")
+	flag.BoolVar(&restoreOpts.MoveBack, "move-back", false, "Use --move-back instead of --copy-back (restore mode)")
+	flag.StringVar(&historyFilter.Status, "status", "", "Only show runs with this status: success or failure (history mode)")
+	flag.StringVar(&since, "since", "", "Only show runs started at or after this time, e.g. 2024-01-01 or 2024-01-01 08:00 (history mode)")
+	flag.StringVar(&until, "until", "", "Only show runs started before this time, a date includes the whole day (history mode)")
+	flag.IntVar(&historyFilter.Limit, "limit", 0, "Only show the latest N runs (history mode, 0 = all)")
+	flag.BoolVar(&asJSON, "json", false, "Print one JSON object per line (history mode)")
 	flag.Parse()
 
 	cfg, err := loadConfig(cfgPath)
@@ -80,6 +165,25 @@ func main() {
 		fatalf("load config: %v", err)
 	}
 
+	// history 只读取运行记录，不需要检查 MySQL 和 xtrabackup
+	if mode == "history" {
+		historyFilter.Type = backupTypeOverride
+		if since != "" {
+			if historyFilter.Since, err = history.ParseTime(since, false); err != nil {
+				fatalf("-since: %v", err)
+			}
+		}
+		if until != "" {
+			if historyFilter.Until, err = history.ParseTime(until, true); err != nil {
+				fatalf("-until: %v", err)
+			}
+		}
+		if err := runHistory(cfg, historyFilter, asJSON); err != nil {
+			fatalf("history failed: %v", err)
+		}
+		return
+	}
+
 	if backupTypeOverride != "" {
 		cfg.BackupType = backupTypeOverride
 	}
@@ -90,29 +194,98 @@ func main() {
 	if err := validateConfig(cfg); err != nil {
 		fatalf("config invalid: %v", err)
 	}
+	if skipRemote && cfg.Stream.Enabled && (mode == "backup" || mode == "daemon") {
+		fatalf("-skip-remote cannot be used with stream.enabled, streamed backups are only stored remotely")
+	}
 
-	result, err := runBackup(cfg)
+	switch mode {
+	case "backup":
+	case "prepare", "restore":
+		restoreOpts.PrepareOnly = mode == "prepare"
+		if fetch {
+			if len(cfg.Destinations) == 0 {
+				fatalf("-fetch requires storage.url or destinations")
+			}
+			if err := fetchBackups(cfg, from, restoreOpts.Backup); err != nil {
+				fatalf("fetch failed: %v", err)
+			}
+		}
+		if err := runRestore(cfg, &restoreOpts); err != nil {
+			fatalf("%s failed: %v", mode, err)
+		}
+		return
+	case "upload":
+		if len(cfg.Destinations) == 0 {
+			fatalf("upload mode requires storage.url or destinations")
+		}
+		warnings, err := runUpload(cfg, restoreOpts.Backup)
+		for _, w := range warnings {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+		}
+		if err != nil {
+			fatalf("upload failed: %v", err)
+		}
+		return
+	case "prune":
+		if err := runPrune(cfg, dryRun); err != nil {
+			fatalf("prune failed: %v", err)
+		}
+		return
+	case "verify":
+		if err := runVerify(cfg, restoreOpts.Backup); err != nil {
+			fatalf("verify failed: %v", err)
+		}
+		return
+	case "daemon":
+		if err := runDaemon(cfgPath, cfg, skipRemote); err != nil {
+			fatalf("daemon failed: %v", err)
+		}
+		return
+	default:
+		fatalf("unsupported mode: %s", mode)
+	}
+
+	if err := runBackupJob(cfg, skipRemote); err != nil {
+		fatalf("%v", err)
+	}
+}
+
+// runBackupJob 执行一次完整的备份流程：备份、上传、清理过期备份，发送通知并更新指标。
+func runBackupJob(cfg *Config, skipRemote bool) (err error) {
+	start := time.Now()
+	var result *backupResult
+	var warnings, pruned []string
+	defer func() {
+		recordMetrics(cfg, result, start, err)
+		recordHistory(cfg, result, start, err, warnings)
+	}()
+	result, err = runBackup(cfg)
 	if err != nil {
-		sendFeishu(cfg, result, "失败", err.Error())
-		fatalf("backup failed: %v", err)
+		notifyResult(cfg, result, start, err, nil, nil)
+		return fmt.Errorf("backup failed: %w", err)
 	}
 
-	if cfg.Remote.Enabled && !skipRemote {
-		if err := sendArchive(cfg, result); err != nil {
-			sendFeishu(cfg, result, "失败", err.Error())
-			fatalf("send to remote failed: %v", err)
+	if len(cfg.Destinations) > 0 && !skipRemote {
+		warnings, pruned, err = uploadBackup(cfg, result.ManifestPath)
+		if err != nil {
+			notifyResult(cfg, result, start, err, warnings, pruned)
+			return fmt.Errorf("upload failed: %w", err)
 		}
 	}
 
-	if cfg.RetentionDays > 0 {
-		if err := cleanupOld(cfg); err != nil {
-			sendFeishu(cfg, result, "失败", err.Error())
-			fatalf("cleanup failed: %v", err)
+	if !cfg.Retention.IsZero() {
+		local, err := cleanupOld(cfg, false)
+		pruned = append(pruned, local...)
+		if err != nil {
+			notifyResult(cfg, result, start, err, warnings, pruned)
+			return fmt.Errorf("cleanup failed: %w", err)
 		}
 	}
 
-	sendFeishu(cfg, result, "成功", "")
-	fmt.Printf("Backup finished. name=%s local=%s archive=%s log=%s\n", result.BackupName, result.TargetDir, result.ArchivePath, result.LogPath)
+	// 可选目的地失败时仍为成功，在通知中附上失败原因
+	notifyResult(cfg, result, start, nil, warnings, pruned)
+	fmt.Printf("Backup finished. name=%s local=%s archive=%s manifest=%s log=%s\n", result.BackupName, result.TargetDir, result.ArchivePath, result.ManifestPath, result.LogPath)
+	return nil
 }
 
 func loadConfig(path string) (*Config, error) {
@@ -128,8 +301,8 @@ func loadConfig(path string) (*Config, error) {
 }
 
 func validateConfig(cfg *Config) error {
-	if cfg.BackupType != "full" && cfg.BackupType != "incr" {
-		return fmt.Errorf("backup_type must be full or incr, got %s", cfg.BackupType)
+	if !validBackupType(cfg.BackupType) {
+		return fmt.Errorf("backup_type must be full, incr or diff, got %s", cfg.BackupType)
 	}
 	if cfg.BackupDir == "" {
 		return errors.New("backup_dir is required")
@@ -167,6 +340,21 @@ func validateConfig(cfg *Config) error {
 	if cfg.XtraBackup.Compress && cfg.XtraBackup.CompressThreads == 0 {
 		cfg.XtraBackup.CompressThreads = 2
 	}
+	if cfg.Encryption.Enabled {
+		if !cfg.TarArchive && !cfg.Stream.Enabled {
+			return errors.New("encryption.enabled requires tar_archive=true or stream.enabled=true")
+		}
+		if cfg.Encryption.KeyFile == "" {
+			return errors.New("encryption.key_file is required when encryption.enabled=true")
+		}
+	}
+	if cfg.Encryption.KeyFile != "" {
+		key, err := crypt.LoadKey(cfg.Encryption.KeyFile)
+		if err != nil {
+			return fmt.Errorf("encryption: %w", err)
+		}
+		cfg.key = key
+	}
 	if cfg.Remote.Enabled {
 		if cfg.Remote.User == "" || cfg.Remote.Host == "" || cfg.Remote.DestDir == "" {
 			return errors.New("remote.user, remote.host, remote.dest_dir are required when remote.enabled=true")
@@ -174,10 +362,51 @@ func validateConfig(cfg *Config) error {
 		if cfg.Remote.Port == 0 {
 			cfg.Remote.Port = 22
 		}
-		if _, err := exec.LookPath("scp"); err != nil {
-			return fmt.Errorf("scp not found in PATH: %w", err)
+		if cfg.Storage.URL == "" {
+			dest := cfg.Remote.DestDir
+			if !strings.HasPrefix(dest, "/") {
+				dest = "/~/" + dest // scp 的相对路径相对于家目录
+			}
+			u := url.URL{
+				Scheme: "sftp",
+				User:   url.User(cfg.Remote.User),
+				Host:   net.JoinHostPort(cfg.Remote.Host, fmt.Sprint(cfg.Remote.Port)),
+				Path:   dest,
+			}
+			cfg.Storage.URL = u.String()
+		}
+	}
+	if err := cfg.Retention.Validate(); err != nil {
+		return err
+	}
+	if cfg.RetentionDays > 0 && cfg.Retention.Days == 0 {
+		cfg.Retention.Days = cfg.RetentionDays
+	}
+	if err := validateDestinations(cfg); err != nil {
+		return err
+	}
+	if cfg.Stream.Enabled {
+		if cfg.primary() == nil {
+			return errors.New("stream.enabled requires storage.url or a required destination")
+		}
+		if cfg.TarArchive {
+			return errors.New("stream.enabled and tar_archive are mutually exclusive")
+		}
+		if err := compress.Validate(cfg.Stream.Compress, cfg.Stream.CompressLevel); err != nil {
+			return fmt.Errorf("stream: %w", err)
 		}
 	}
+	for i, s := range cfg.Schedules {
+		if !validBackupType(s.Type) {
+			return fmt.Errorf("schedules[%d].type must be full, incr or diff, got %s", i, s.Type)
+		}
+		if _, err := schedule.Parse(s.Cron); err != nil {
+			return fmt.Errorf("schedules[%d]: %w", i, err)
+		}
+	}
+	if err := schedule.ValidateOverlap(cfg.Overlap); err != nil {
+		return err
+	}
 	if cfg.Feishu.Enabled {
 		if cfg.Feishu.Webhook == "" {
 			return errors.New("feishu.webhook is required when feishu.enabled=true")
@@ -185,11 +414,94 @@ func validateConfig(cfg *Config) error {
 		if cfg.Feishu.Keyword == "" {
 			return errors.New("feishu.keyword is required when feishu.enabled=true (需满足飞书关键字校验)")
 		}
+		cfg.Notify = append(cfg.Notify, notify.Config{Type: "feishu", URL: cfg.Feishu.Webhook, Keyword: cfg.Feishu.Keyword})
+		cfg.Feishu.Enabled = false // 已转换，重复检查时不再添加
+	}
+	for i, c := range cfg.Notify {
+		if err := notify.Validate(c); err != nil {
+			return fmt.Errorf("notify[%d]: %w", i, err)
+		}
+	}
+	if err := cfg.Metrics.Validate(); err != nil {
+		return fmt.Errorf("metrics: %w", err)
 	}
 	return nil
 }
 
-func runBackup(cfg *Config) (*backupResult, error) {
+// validateDestinations 检查目的地配置，只配置了 storage 时将其转换为唯一的目的地；
+// 未设置 retention_days 和 retention 的目的地使用顶层的保留策略。
+func validateDestinations(cfg *Config) error {
+	if len(cfg.Destinations) == 0 {
+		if err := storage.Validate(cfg.Storage); err != nil {
+			return fmt.Errorf("storage: %w", err)
+		}
+		if cfg.Storage.URL != "" {
+			cfg.Destinations = []Destination{{Name: "default", Config: cfg.Storage, Retention: cfg.Retention}}
+		}
+		return nil
+	}
+	if cfg.Storage.URL != "" {
+		return errors.New("storage (or remote) and destinations are mutually exclusive")
+	}
+	seen := map[string]bool{}
+	for i, d := range cfg.Destinations {
+		if d.Name == "" {
+			return fmt.Errorf("destinations[%d].name is required", i)
+		}
+		if seen[d.Name] {
+			return fmt.Errorf("duplicate destination name %q", d.Name)
+		}
+		seen[d.Name] = true
+		if d.URL == "" {
+			return fmt.Errorf("destination %s: url is required", d.Name)
+		}
+		if err := storage.Validate(d.Config); err != nil {
+			return fmt.Errorf("destination %s: %w", d.Name, err)
+		}
+		if d.RetentionDays < -1 {
+			return fmt.Errorf("destination %s: retention_days must be -1 (keep forever) or more", d.Name)
+		}
+		if err := d.Retention.Validate(); err != nil {
+			return fmt.Errorf("destination %s: %w", d.Name, err)
+		}
+		p := &cfg.Destinations[i].Retention
+		if d.RetentionDays > 0 && p.Days == 0 {
+			p.Days = d.RetentionDays
+		}
+		if p.IsZero() && d.RetentionDays == 0 {
+			*p = cfg.Retention
+		}
+	}
+	return nil
+}
+
+// primary 返回第一个必需的目的地，流式备份上传到这里，没有时返回 nil。
+func (cfg *Config) primary() *Destination {
+	for i := range cfg.Destinations {
+		if !cfg.Destinations[i].Optional {
+			return &cfg.Destinations[i]
+		}
+	}
+	return nil
+}
+
+// destination 返回名为 name 的目的地，name 为空时返回第一个。
+func (cfg *Config) destination(name string) (*Destination, error) {
+	if len(cfg.Destinations) == 0 {
+		return nil, errors.New("no storage or destinations configured")
+	}
+	if name == "" {
+		return &cfg.Destinations[0], nil
+	}
+	for i := range cfg.Destinations {
+		if cfg.Destinations[i].Name == name {
+			return &cfg.Destinations[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown destination %q", name)
+}
+
+func runBackup(cfg *Config) (result *backupResult, err error) {
 	if err := os.MkdirAll(cfg.BackupDir, 0755); err != nil {
 		return nil, fmt.Errorf("create backup_dir: %w", err)
 	}
@@ -211,6 +523,23 @@ func runBackup(cfg *Config) (*backupResult, error) {
 	logger := io.MultiWriter(os.Stdout, logFile)
 	fmt.Fprintf(logger, "[%s] starting backup: %s\n", timeStamp(), backupName)
 
+	// 无论成功与否都在备份旁写入清单，失败的备份不会被当作增量基线
+	m := manifest.New(backupName)
+	m.Engine = "mysql"
+	m.Host = mysqlAddr(cfg)
+	m.Tool = "xtrabackup"
+	m.BackupType = cfg.BackupType
+	manifestPath := manifest.PathFor(cfg.BackupDir, backupName)
+	defer func() {
+		m.Finish(err)
+		if werr := manifest.Write(manifestPath, m); werr != nil {
+			fmt.Fprintf(logger, "[%s] %v\n", timeStamp(), werr)
+			if err == nil {
+				result, err = nil, werr
+			}
+		}
+	}()
+
 	args := []string{
 		"--defaults-file=" + cfg.MySQL.DefaultsFile,
 		"--user=" + cfg.MySQL.User,
@@ -228,29 +557,73 @@ func runBackup(cfg *Config) (*backupResult, error) {
 	}
 	if cfg.XtraBackup.Compress {
 		args = append(args, "--compress", "--compress-threads="+fmt.Sprint(cfg.XtraBackup.CompressThreads))
+		m.Compression = "xtrabackup"
 	}
-	if cfg.BackupType == "incr" {
-		baseDir, err := findLatestFull(cfg.BackupDir, cfg.BackupPrefix)
-		if err != nil {
+	var base *incrementalBase
+	if cfg.BackupType != "full" {
+		if base, err = findIncrementalBase(cfg, cfg.BackupType, logger); err != nil {
 			return nil, err
 		}
-		args = append(args, "--incremental-basedir="+baseDir)
-		fmt.Fprintf(logger, "[%s] incremental basedir: %s\n", timeStamp(), baseDir)
+		args = append(args, "--incremental-basedir="+base.Dir)
+		m.Parent = base.Name
+		fmt.Fprintf(logger, "[%s] incremental basedir: %s (to_lsn %d)\n", timeStamp(), base.Dir, base.Checkpoints.ToLSN)
+	}
+	if cfg.Stream.Enabled {
+		// LSN 信息写入本地 <backup_dir>/<name>，作为后续增量备份的基线
+		args = append(args, "--stream=xbstream", "--extra-lsndir="+targetDir)
+		if cfg.Stream.Compress != "" && cfg.Stream.Compress != compress.None {
+			m.Compression = cfg.Stream.Compress
+		}
 	}
 	args = append(args, cfg.XtraBackup.ExtraArgs...)
+	fmt.Fprintf(logger, "[%s] exec: %s %s\n", timeStamp(), cfg.XtraBackup.Bin, strings.Join(maskPassword(args), " "))
+
+	if cfg.Stream.Enabled {
+		if cfg.Encryption.Enabled {
+			m.Encryption = &manifest.Encryption{Algorithm: crypt.Algorithm, KeyFingerprint: cfg.key.Fingerprint()}
+		}
+		location, err := streamBackup(cfg, args, backupName, m, logger)
+		if err != nil {
+			return nil, fmt.Errorf("%w (see log %s)", err, logPath)
+		}
+		if base != nil {
+			if err := checkIncremental(targetDir, base); err != nil {
+				return nil, fmt.Errorf("incremental chain: %w", err)
+			}
+		}
+		fillManifestFromInfo(m, targetDir, cfg.XtraBackup.Bin)
+		fmt.Fprintf(logger, "[%s] backup finished\n", timeStamp())
+		return &backupResult{
+			BackupName:   backupName,
+			TargetDir:    targetDir,
+			ArchivePath:  location,
+			Streamed:     true,
+			LogPath:      logPath,
+			ManifestPath: manifestPath,
+		}, nil
+	}
 
 	cmd := exec.Command(cfg.XtraBackup.Bin, args...)
 	cmd.Stdout = logger
 	cmd.Stderr = logger
-
-	fmt.Fprintf(logger, "[%s] exec: %s %s\n", timeStamp(), cfg.XtraBackup.Bin, strings.Join(maskPassword(args), " "))
 	if err := cmd.Run(); err != nil {
 		return nil, fmt.Errorf("xtrabackup: %w (see log %s)", err, logPath)
 	}
+	if base != nil {
+		if err := checkIncremental(targetDir, base); err != nil {
+			return nil, fmt.Errorf("incremental chain: %w", err)
+		}
+	}
+	fillManifestFromInfo(m, targetDir, cfg.XtraBackup.Bin)
 
 	var archivePath string
 	if cfg.TarArchive {
-		archivePath, err = tarDir(targetDir, logger)
+		var key *crypt.Key
+		if cfg.Encryption.Enabled {
+			key = cfg.key
+			m.Encryption = &manifest.Encryption{Algorithm: crypt.Algorithm, KeyFingerprint: key.Fingerprint()}
+		}
+		archivePath, err = tarDir(targetDir, key, logger)
 		if err != nil {
 			return nil, err
 		}
@@ -258,35 +631,57 @@ func runBackup(cfg *Config) (*backupResult, error) {
 		archivePath = targetDir
 	}
 
+	fmt.Fprintf(logger, "[%s] checksum %s\n", timeStamp(), archivePath)
+	if err := m.AddPath(cfg.BackupDir, archivePath); err != nil {
+		return nil, fmt.Errorf("checksum backup: %w", err)
+	}
+
 	fmt.Fprintf(logger, "[%s] backup finished\n", timeStamp())
 	return &backupResult{
-		BackupName:  backupName,
-		TargetDir:   targetDir,
-		ArchivePath: archivePath,
-		LogPath:     logPath,
+		BackupName:   backupName,
+		TargetDir:    targetDir,
+		ArchivePath:  archivePath,
+		LogPath:      logPath,
+		ManifestPath: manifestPath,
 	}, nil
 }
 
-func findLatestFull(root, prefix string) (string, error) {
-	entries, err := os.ReadDir(root)
-	if err != nil {
-		return "", fmt.Errorf("read backup_dir: %w", err)
+func mysqlAddr(cfg *Config) string {
+	if cfg.MySQL.Socket != "" {
+		return cfg.MySQL.Socket
 	}
-	var fulls []string
-	p := prefix + "_full_"
-	for _, e := range entries {
-		if e.IsDir() && strings.HasPrefix(e.Name(), p) {
-			fulls = append(fulls, e.Name())
+	return net.JoinHostPort(cfg.MySQL.Host, fmt.Sprint(cfg.MySQL.Port))
+}
+
+// fillManifestFromInfo 从 xtrabackup_info 读取工具和服务器版本，并以备份中的库目录作为数据库列表。
+func fillManifestFromInfo(m *manifest.Manifest, targetDir, bin string) {
+	if data, err := os.ReadFile(filepath.Join(targetDir, "xtrabackup_info")); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				continue
+			}
+			switch strings.TrimSpace(key) {
+			case "tool_version":
+				m.ToolVersion = strings.TrimSpace(value)
+			case "server_version":
+				m.ServerVersion = strings.TrimSpace(value)
+			}
 		}
 	}
-	if len(fulls) == 0 {
-		return "", errors.New("no full backup found, run a full backup first")
+	if m.ToolVersion == "" {
+		m.ToolVersion = manifest.ToolVersion(bin)
+	}
+	entries, _ := os.ReadDir(targetDir)
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), "#") {
+			m.Databases = append(m.Databases, e.Name())
+		}
 	}
-	sort.Strings(fulls)
-	return filepath.Join(root, fulls[len(fulls)-1]), nil
 }
 
-func tarDir(dir string, logger io.Writer) (string, error) {
+// tarDir 将备份目录打包为 tar.gz，key 不为空时边打包边加密为 .tar.gz.enc。
+func tarDir(dir string, key *crypt.Key, logger io.Writer) (string, error) {
 	info, err := os.Stat(dir)
 	if err != nil {
 		return "", fmt.Errorf("stat target dir: %w", err)
@@ -300,67 +695,50 @@ func tarDir(dir string, logger io.Writer) (string, error) {
 	base := filepath.Base(dir)
 	parent := filepath.Dir(dir)
 	archive := dir + ".tar.gz"
-	fmt.Fprintf(logger, "[%s] tar %s -> %s\n", timeStamp(), dir, archive)
-	cmd := exec.Command("tar", "-czf", archive, "-C", parent, base)
-	cmd.Stdout = logger
-	cmd.Stderr = logger
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("tar archive failed: %w", err)
+	if key == nil {
+		fmt.Fprintf(logger, "[%s] tar %s -> %s\n", timeStamp(), dir, archive)
+		cmd := exec.Command("tar", "-czf", archive, "-C", parent, base)
+		cmd.Stdout = logger
+		cmd.Stderr = logger
+		if err := cmd.Run(); err != nil {
+			return "", fmt.Errorf("tar archive failed: %w", err)
+		}
+		return archive, nil
 	}
-	return archive, nil
-}
 
-func sendArchive(cfg *Config, res *backupResult) error {
-	fmt.Printf("[%s] sending archive to %s@%s:%s ...\n", timeStamp(), cfg.Remote.User, cfg.Remote.Host, cfg.Remote.DestDir)
-	args := []string{
-		"-P", fmt.Sprint(cfg.Remote.Port),
-		res.ArchivePath,
-		fmt.Sprintf("%s@%s:%s", cfg.Remote.User, cfg.Remote.Host, cfg.Remote.DestDir),
-	}
-	cmd := exec.Command("scp", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("scp failed: %w", err)
+	archive += crypt.Ext
+	fmt.Fprintf(logger, "[%s] tar %s -> %s (encrypted, key %s)\n", timeStamp(), dir, archive, key.Fingerprint())
+	if err := encryptTar(archive, parent, base, key, logger); err != nil {
+		os.Remove(archive)
+		return "", err
 	}
-	return nil
+	return archive, nil
 }
 
-func cleanupOld(cfg *Config) error {
-	entries, err := os.ReadDir(cfg.BackupDir)
+// encryptTar 将 tar 的输出直接加密写入 archive，明文归档不落盘。
+func encryptTar(archive, parent, base string, key *crypt.Key, logger io.Writer) error {
+	f, err := os.OpenFile(archive, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
 	if err != nil {
-		return fmt.Errorf("cleanup read dir: %w", err)
+		return fmt.Errorf("create archive: %w", err)
 	}
-	cutoff := time.Now().AddDate(0, 0, -cfg.RetentionDays)
-	for _, e := range entries {
-		name := e.Name()
-		if !strings.HasPrefix(name, cfg.BackupPrefix+"_") {
-			continue
-		}
-		fp := filepath.Join(cfg.BackupDir, name)
-		info, err := e.Info()
-		if err != nil {
-			continue
-		}
-		if info.ModTime().Before(cutoff) {
-			if err := os.RemoveAll(fp); err != nil {
-				return fmt.Errorf("cleanup remove %s: %w", fp, err)
-			}
-			fmt.Printf("[%s] cleaned old backup %s\n", timeStamp(), fp)
-		}
+	defer f.Close()
+	w, err := crypt.NewWriter(f, key)
+	if err != nil {
+		return fmt.Errorf("start encryption: %w", err)
 	}
-	logEntries, _ := os.ReadDir(cfg.LogDir)
-	for _, e := range logEntries {
-		fp := filepath.Join(cfg.LogDir, e.Name())
-		info, err := e.Info()
-		if err != nil {
-			continue
-		}
-		if info.ModTime().Before(cutoff) {
-			_ = os.Remove(fp)
-		}
+	cmd := exec.Command("tar", "-cz", "-C", parent, base)
+	cmd.Stdout = w
+	cmd.Stderr = logger
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("tar archive failed: %w", err)
 	}
-	return nil
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("finish encryption: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("sync archive: %w", err)
+	}
+	return f.Close()
 }
 
 func maskPassword(args []string) []string {
@@ -383,44 +761,56 @@ func fatalf(format string, a ...interface{}) {
 	os.Exit(1)
 }
 
-func sendFeishu(cfg *Config, res *backupResult, status string, errMsg string) {
-	if !cfg.Feishu.Enabled {
-		return
+// recordMetrics 更新本次备份的指标，daemon 模式下同时更新 /metrics，写入失败只输出到标准错误。
+func recordMetrics(cfg *Config, res *backupResult, start time.Time, err error) {
+	run := metrics.Run{
+		Tool:     "mysql_xtrabackup",
+		Job:      cfg.BackupPrefix,
+		Type:     cfg.BackupType,
+		Success:  err == nil,
+		Time:     time.Now(),
+		Duration: time.Since(start),
+	}
+	if err == nil && res != nil {
+		if m, err := manifest.Read(res.ManifestPath); err == nil {
+			run.Size = m.Size
+		}
 	}
-
-	backupName := ""
-	archive := ""
-	log := ""
-	if res != nil {
-		backupName = res.BackupName
-		archive = res.ArchivePath
-		log = res.LogPath
+	if err := metrics.Update(daemonMetrics, cfg.Metrics.Textfile, run); err != nil {
+		fmt.Fprintf(os.Stderr, "update metrics failed: %v\n", err)
 	}
+}
 
-	textLines := []string{
-		cfg.Feishu.Keyword,
-		fmt.Sprintf("状态: %s", status),
-		fmt.Sprintf("备份名: %s", backupName),
-		fmt.Sprintf("文件: %s", archive),
-		fmt.Sprintf("日志: %s", log),
-	}
-	if errMsg != "" {
-		textLines = append(textLines, "错误: "+errMsg)
+// notifyResult 将本次备份结果发送到 notify 中的通道，err 为空表示成功。
+// 发送失败只输出到标准错误，不影响备份结果。
+func notifyResult(cfg *Config, res *backupResult, start time.Time, err error, warnings, pruned []string) {
+	if len(cfg.Notify) == 0 {
+		return
 	}
-	payload := map[string]interface{}{
-		"msg_type": "text",
-		"content": map[string]string{
-			"text": strings.Join(textLines, "\n"),
-		},
+	e := &notify.Event{
+		Tool:     "mysql_xtrabackup",
+		Job:      cfg.BackupPrefix,
+		Host:     mysqlAddr(cfg),
+		Type:     cfg.BackupType,
+		Status:   notify.StatusSuccess,
+		Duration: time.Since(start),
+		Warnings: warnings,
+		Pruned:   pruned,
 	}
-	body, _ := json.Marshal(payload)
-	req, _ := http.NewRequest("POST", cfg.Feishu.Webhook, bytes.NewReader(body))
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "send feishu failed: %v\n", err)
-		return
+		e.Status, e.Error = notify.StatusFailure, err.Error()
+	}
+	if res != nil {
+		e.Backups = []string{res.BackupName}
+		e.Location = res.ArchivePath
+		e.Log = res.LogPath
+		if m, err := manifest.Read(res.ManifestPath); err == nil {
+			e.Size = m.Size
+			e.Manifests = []*manifest.Manifest{m}
+		}
+		e.Chain = backupChain(cfg, res.BackupName)
+	}
+	if err := notify.Send(cfg.Notify, e, filepath.Join(cfg.BackupDir, notifyStateFile)); err != nil {
+		fmt.Fprintf(os.Stderr, "notify failed: %v\n", err)
 	}
-	_ = resp.Body.Close()
 }
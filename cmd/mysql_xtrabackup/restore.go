@@ -0,0 +1,455 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LYcoding0/dbbackup/internal/compress"
+	"github.com/LYcoding0/dbbackup/internal/crypt"
+	"github.com/LYcoding0/dbbackup/internal/manifest"
+	"github.com/LYcoding0/dbbackup/internal/xtrabackup"
+)
+
+// restoreOptions 恢复/prepare 模式的命令行参数。
+type restoreOptions struct {
+	Backup        string // 要恢复到的备份名或路径，空则取最新
+	WorkDir       string // prepare 工作目录，空则 <BackupDir>/restore_<ts>
+	TargetDatadir string // copy-back/move-back 目标数据目录
+	MoveBack      bool   // 使用 --move-back 代替 --copy-back
+	PrepareOnly   bool   // 只 prepare 不 copy-back
+}
+
+// localBackup 本地 backup_dir 下的一份备份（目录和/或归档）。
+type localBackup struct {
+	Name        string
+	Type        string
+	Time        time.Time
+	Dir         string // 备份目录，不存在则为空
+	Archive     string // tar.gz 或 xbstream 归档（可能压缩、加密），不存在则为空
+	Checkpoints *xtrabackup.Checkpoints
+	Parent      string // 清单中记录的基线备份名，全量备份或没有清单的旧备份为空
+}
+
+// 本工具产生的归档格式，归档名为 <name><格式>[.gz|.zst][.enc]。
+const (
+	tarExt      = ".tar"
+	xbstreamExt = ".xbstream"
+)
+
+// trimArchiveExt 去掉归档扩展名，不是归档时返回 false。
+func trimArchiveExt(name string) (string, bool) {
+	base := compress.TrimExt(strings.TrimSuffix(name, crypt.Ext))
+	for _, ext := range []string{tarExt, xbstreamExt} {
+		if strings.HasSuffix(base, ext) {
+			return strings.TrimSuffix(base, ext), true
+		}
+	}
+	return name, false
+}
+
+// isXbstream 归档是否为流式备份产生的 xbstream。
+func isXbstream(archive string) bool {
+	return strings.HasSuffix(compress.TrimExt(strings.TrimSuffix(archive, crypt.Ext)), xbstreamExt)
+}
+
+// hasData 目录是否为完整的备份，而不是流式备份留在本地的 --extra-lsndir（只有 checkpoints 和 info）。
+func hasData(dir string) bool {
+	matches, _ := filepath.Glob(filepath.Join(dir, "xtrabackup_logfile*"))
+	return len(matches) > 0
+}
+
+// openArchive 打开归档，.enc 归档使用 encryption.key_file 解密，返回解压后的 tar 或 xbstream 数据流。
+func openArchive(cfg *Config, archive string) (io.ReadCloser, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	var r io.Reader = f
+	name := archive
+	if strings.HasSuffix(archive, crypt.Ext) {
+		if cfg.key == nil {
+			f.Close()
+			return nil, fmt.Errorf("%s is encrypted, set encryption.key_file to decrypt", archive)
+		}
+		if r, err = crypt.NewReader(f, cfg.key); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("decrypt %s: %w", archive, err)
+		}
+		name = strings.TrimSuffix(archive, crypt.Ext)
+	}
+	zr, err := compress.NewReader(r, compress.Detect(name))
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("decompress %s: %w", archive, err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{zr, closers{zr, f}}, nil
+}
+
+// closers 依次关闭多个 Closer，返回第一个错误。
+type closers []io.Closer
+
+func (c closers) Close() error {
+	var first error
+	for _, cl := range c {
+		if err := cl.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// readArchiveCheckpoints 从归档中读取 xtrabackup_checkpoints，无需解包。
+// tar 中的路径为 <name>/xtrabackup_checkpoints，xbstream 中为 xtrabackup_checkpoints。
+func readArchiveCheckpoints(cfg *Config, archive, name string) (*xtrabackup.Checkpoints, error) {
+	f, err := openArchive(cfg, archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if isXbstream(archive) {
+		data, err := xtrabackup.ReadXbstreamFile(f, xtrabackup.CheckpointsFile)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", archive, err)
+		}
+		return xtrabackup.ParseCheckpoints(bytes.NewReader(data))
+	}
+	tr := tar.NewReader(f)
+	want := name + "/" + xtrabackup.CheckpointsFile
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("xtrabackup_checkpoints not found in %s", archive)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read tar %s: %w", archive, err)
+		}
+		if strings.TrimPrefix(hdr.Name, "./") == want {
+			return xtrabackup.ParseCheckpoints(tr)
+		}
+	}
+}
+
+// parseBackupName 解析 <prefix>_<type>_<20060102_150405> 形式的备份名。
+func parseBackupName(prefix, name string) (string, time.Time, bool) {
+	rest := strings.TrimPrefix(name, prefix+"_")
+	if rest == name {
+		return "", time.Time{}, false
+	}
+	typ, ts, ok := strings.Cut(rest, "_")
+	if !ok {
+		return "", time.Time{}, false
+	}
+	t, err := time.ParseInLocation("20060102_150405", ts, time.Local)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return typ, t, true
+}
+
+// listLocalBackups 列出 backup_dir 下的所有备份，按时间升序。
+func listLocalBackups(cfg *Config) ([]*localBackup, error) {
+	entries, err := os.ReadDir(cfg.BackupDir)
+	if err != nil {
+		return nil, fmt.Errorf("read backup_dir: %w", err)
+	}
+	byName := map[string]*localBackup{}
+	for _, e := range entries {
+		name := e.Name()
+		var isArchive bool
+		if !e.IsDir() {
+			if name, isArchive = trimArchiveExt(name); !isArchive {
+				continue
+			}
+		}
+		typ, t, ok := parseBackupName(cfg.BackupPrefix, name)
+		if !ok {
+			continue
+		}
+		b := byName[name]
+		if b == nil {
+			b = &localBackup{Name: name, Type: typ, Time: t}
+			byName[name] = b
+		}
+		if isArchive {
+			b.Archive = filepath.Join(cfg.BackupDir, e.Name())
+		} else if dir := filepath.Join(cfg.BackupDir, name); hasData(dir) {
+			b.Dir = dir
+		}
+	}
+
+	var backups []*localBackup
+	for _, b := range byName {
+		if b.Dir == "" && b.Archive == "" {
+			fmt.Printf("[%s] skip %s: streamed backup not in backup_dir, use -fetch\n", timeStamp(), b.Name)
+			continue
+		}
+		var cp *xtrabackup.Checkpoints
+		if b.Dir != "" {
+			cp, err = xtrabackup.ReadCheckpoints(b.Dir)
+		} else {
+			cp, err = readArchiveCheckpoints(cfg, b.Archive, b.Name)
+		}
+		if err != nil {
+			fmt.Printf("[%s] skip %s: %v\n", timeStamp(), b.Name, err)
+			continue
+		}
+		b.Checkpoints = cp
+		if m, err := manifest.Read(manifest.PathFor(cfg.BackupDir, b.Name)); err == nil {
+			b.Parent = m.Parent
+		}
+		backups = append(backups, b)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Time.Before(backups[j].Time) })
+	return backups, nil
+}
+
+// resolveChain 找到从全量到目标备份的完整链路，顺序为 full, incr1, incr2...
+// 优先沿清单中的 parent 查找，没有清单的旧备份按 LSN 找之前最近的、to_lsn 相同的备份。
+func resolveChain(backups []*localBackup, target *localBackup) ([]*localBackup, error) {
+	byName := map[string]*localBackup{}
+	for _, b := range backups {
+		byName[b.Name] = b
+	}
+	chain := []*localBackup{target}
+	cur := target
+	for cur.Checkpoints.BackupType != xtrabackup.TypeFull {
+		var parent *localBackup
+		if cur.Parent != "" {
+			if parent = byName[cur.Parent]; parent == nil {
+				return nil, fmt.Errorf("chain broken: base %s of %s not found in backup_dir", cur.Parent, cur.Name)
+			}
+			if parent.Checkpoints.ToLSN != cur.Checkpoints.FromLSN {
+				return nil, fmt.Errorf("chain broken: %s ends at lsn %d but %s starts at lsn %d",
+					parent.Name, parent.Checkpoints.ToLSN, cur.Name, cur.Checkpoints.FromLSN)
+			}
+		} else {
+			for _, b := range backups {
+				if b.Time.Before(cur.Time) && b.Checkpoints.ToLSN == cur.Checkpoints.FromLSN {
+					parent = b // 升序遍历，取最近的一个
+				}
+			}
+			if parent == nil {
+				return nil, fmt.Errorf("chain broken: no backup with to_lsn=%d found for %s", cur.Checkpoints.FromLSN, cur.Name)
+			}
+		}
+		for _, b := range chain {
+			if b == parent {
+				return nil, fmt.Errorf("chain broken: %s depends on itself", cur.Name)
+			}
+		}
+		chain = append([]*localBackup{parent}, chain...)
+		cur = parent
+	}
+	return chain, nil
+}
+
+func findRestoreTarget(cfg *Config, backups []*localBackup, want string) (*localBackup, error) {
+	if len(backups) == 0 {
+		return nil, errors.New("no backup found in backup_dir")
+	}
+	if want == "" {
+		return backups[len(backups)-1], nil
+	}
+	name, _ := trimArchiveExt(filepath.Base(want))
+	for _, b := range backups {
+		if b.Name == name {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("backup %s not found in %s", name, cfg.BackupDir)
+}
+
+func runRestore(cfg *Config, opts *restoreOptions) error {
+	if !opts.PrepareOnly && opts.TargetDatadir == "" {
+		return errors.New("-target-datadir is required in restore mode")
+	}
+	if err := os.MkdirAll(cfg.LogDir, 0755); err != nil {
+		return fmt.Errorf("create log_dir: %w", err)
+	}
+
+	backups, err := listLocalBackups(cfg)
+	if err != nil {
+		return err
+	}
+	target, err := findRestoreTarget(cfg, backups, opts.Backup)
+	if err != nil {
+		return err
+	}
+	chain, err := resolveChain(backups, target)
+	if err != nil {
+		return err
+	}
+
+	ts := time.Now().Format("20060102_150405")
+	workDir := opts.WorkDir
+	if workDir == "" {
+		workDir = filepath.Join(cfg.BackupDir, "restore_"+ts)
+	}
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return fmt.Errorf("create work dir: %w", err)
+	}
+	logPath := filepath.Join(cfg.LogDir, target.Name+"_restore_"+ts+".log")
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("open log file: %w", err)
+	}
+	defer logFile.Close()
+	logger := io.MultiWriter(os.Stdout, logFile)
+
+	var names []string
+	for _, b := range chain {
+		names = append(names, b.Name)
+	}
+	fmt.Fprintf(logger, "[%s] restore chain: %s\n", timeStamp(), strings.Join(names, " -> "))
+	fmt.Fprintf(logger, "[%s] work dir: %s\n", timeStamp(), workDir)
+
+	// 在工作目录中准备副本，避免 prepare 修改原始备份
+	var dirs []string
+	for _, b := range chain {
+		dir, err := stageBackup(cfg, b, workDir, logger)
+		if err != nil {
+			return err
+		}
+		if err := decompressIfNeeded(cfg, dir, logger); err != nil {
+			return err
+		}
+		dirs = append(dirs, dir)
+	}
+
+	full := dirs[0]
+	if err := runXtrabackup(cfg, logger, "--prepare", "--apply-log-only", "--target-dir="+full); err != nil {
+		return err
+	}
+	for _, incr := range dirs[1:] {
+		if err := runXtrabackup(cfg, logger, "--prepare", "--apply-log-only", "--target-dir="+full, "--incremental-dir="+incr); err != nil {
+			return err
+		}
+	}
+	// 最后一次 prepare 回滚未提交事务，得到可用的数据目录
+	if err := runXtrabackup(cfg, logger, "--prepare", "--target-dir="+full); err != nil {
+		return err
+	}
+	fmt.Fprintf(logger, "[%s] prepared backup: %s\n", timeStamp(), full)
+
+	if opts.PrepareOnly {
+		return nil
+	}
+
+	if err := ensureEmptyDir(opts.TargetDatadir); err != nil {
+		return err
+	}
+	method := "--copy-back"
+	if opts.MoveBack {
+		method = "--move-back"
+	}
+	if err := runXtrabackup(cfg, logger, method, "--target-dir="+full, "--datadir="+opts.TargetDatadir); err != nil {
+		return err
+	}
+	fmt.Fprintf(logger, "[%s] restore finished into %s, fix ownership (e.g. chown -R mysql:mysql %s) before starting mysqld\n", timeStamp(), opts.TargetDatadir, opts.TargetDatadir)
+	return nil
+}
+
+// stageBackup 将备份复制或解包到工作目录，返回工作目录中的备份路径。
+func stageBackup(cfg *Config, b *localBackup, workDir string, logger io.Writer) (string, error) {
+	dst := filepath.Join(workDir, b.Name)
+	if _, err := os.Stat(dst); err == nil {
+		return "", fmt.Errorf("%s already exists, use an empty work dir", dst)
+	}
+	var cmd *exec.Cmd
+	switch {
+	case b.Dir != "":
+		fmt.Fprintf(logger, "[%s] copy %s -> %s\n", timeStamp(), b.Dir, dst)
+		cmd = exec.Command("cp", "-a", b.Dir, dst)
+	case isXbstream(b.Archive):
+		// xbstream 中的路径相对于备份根目录
+		fmt.Fprintf(logger, "[%s] extract %s -> %s\n", timeStamp(), b.Archive, dst)
+		if _, err := exec.LookPath("xbstream"); err != nil {
+			return "", fmt.Errorf("xbstream not found in PATH: %w", err)
+		}
+		if err := os.MkdirAll(dst, 0750); err != nil {
+			return "", err
+		}
+		archive, err := openArchive(cfg, b.Archive)
+		if err != nil {
+			return "", err
+		}
+		defer archive.Close()
+		cmd = exec.Command("xbstream", "-x", "-C", dst)
+		cmd.Stdin = archive
+	default:
+		fmt.Fprintf(logger, "[%s] extract %s -> %s\n", timeStamp(), b.Archive, workDir)
+		archive, err := openArchive(cfg, b.Archive)
+		if err != nil {
+			return "", err
+		}
+		defer archive.Close()
+		cmd = exec.Command("tar", "-x", "-C", workDir)
+		cmd.Stdin = archive
+	}
+	cmd.Stdout = logger
+	cmd.Stderr = logger
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("stage %s: %w", b.Name, err)
+	}
+	return dst, nil
+}
+
+// decompressIfNeeded 备份使用了 --compress 时先解压。
+func decompressIfNeeded(cfg *Config, dir string, logger io.Writer) error {
+	compressed := false
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := filepath.Ext(path)
+		if !d.IsDir() && (ext == ".qp" || ext == ".zst" || ext == ".lz4") {
+			compressed = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("scan %s: %w", dir, err)
+	}
+	if !compressed {
+		return nil
+	}
+	return runXtrabackup(cfg, logger, "--decompress", "--remove-original", "--parallel="+fmt.Sprint(cfg.XtraBackup.Parallel), "--target-dir="+dir)
+}
+
+func ensureEmptyDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return os.MkdirAll(dir, 0750)
+	}
+	if err != nil {
+		return fmt.Errorf("read target datadir: %w", err)
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("target datadir %s is not empty", dir)
+	}
+	return nil
+}
+
+func runXtrabackup(cfg *Config, logger io.Writer, args ...string) error {
+	cmd := exec.Command(cfg.XtraBackup.Bin, args...)
+	cmd.Stdout = logger
+	cmd.Stderr = logger
+	fmt.Fprintf(logger, "[%s] exec: %s %s\n", timeStamp(), cfg.XtraBackup.Bin, strings.Join(args, " "))
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("xtrabackup %s: %w", args[0], err)
+	}
+	return nil
+}
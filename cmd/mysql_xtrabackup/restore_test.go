@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LYcoding0/dbbackup/internal/xtrabackup"
+)
+
+func testBackup(name string, minute int, typ string, from, to uint64, parent string) *localBackup {
+	return &localBackup{
+		Name:        name,
+		Time:        time.Date(2024, 1, 1, 2, minute, 0, 0, time.Local),
+		Checkpoints: &xtrabackup.Checkpoints{BackupType: typ, FromLSN: from, ToLSN: to},
+		Parent:      parent,
+	}
+}
+
+func chainNames(chain []*localBackup) string {
+	var names []string
+	for _, b := range chain {
+		names = append(names, b.Name)
+	}
+	return strings.Join(names, " ")
+}
+
+func TestResolveChain(t *testing.T) {
+	full := xtrabackup.TypeFull
+	incr := xtrabackup.TypeIncremental
+	for _, tt := range []struct {
+		name    string
+		backups []*localBackup // 按时间升序，最后一个为恢复目标
+		want    string         // 链路，为空时期望出错
+	}{
+		{"parent", []*localBackup{
+			testBackup("full", 0, full, 0, 100, ""),
+			testBackup("incr1", 1, incr, 100, 200, "full"),
+			// 之后从同一基线做的增量，数据没有变化，to_lsn 与 incr1 相同
+			testBackup("incr1b", 2, incr, 100, 200, "full"),
+			testBackup("incr2", 3, incr, 200, 300, "incr1"),
+		}, "full incr1 incr2"},
+		{"lsn without manifest", []*localBackup{
+			testBackup("full", 0, full, 0, 100, ""),
+			testBackup("incr1", 1, incr, 100, 200, ""),
+			testBackup("incr1b", 2, incr, 100, 200, ""),
+			testBackup("incr2", 3, incr, 200, 300, ""),
+		}, "full incr1b incr2"},
+		{"legacy parent", []*localBackup{
+			testBackup("full", 0, full, 0, 100, ""),
+			testBackup("incr1", 1, incr, 100, 200, "full"),
+			testBackup("incr2", 2, incr, 200, 300, ""),
+		}, "full incr1 incr2"},
+		{"differential", []*localBackup{
+			testBackup("full", 0, full, 0, 100, ""),
+			testBackup("diff1", 1, incr, 100, 200, "full"),
+			testBackup("diff2", 2, incr, 100, 300, "full"),
+		}, "full diff2"},
+		{"missing parent", []*localBackup{
+			testBackup("incr1", 1, incr, 100, 200, "full"),
+		}, ""},
+		{"lsn mismatch", []*localBackup{
+			testBackup("full", 0, full, 0, 100, ""),
+			testBackup("incr1", 1, incr, 150, 200, "full"),
+		}, ""},
+		{"no lsn match", []*localBackup{
+			testBackup("full", 0, full, 0, 100, ""),
+			testBackup("incr1", 1, incr, 150, 200, ""),
+		}, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			chain, err := resolveChain(tt.backups, tt.backups[len(tt.backups)-1])
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("resolveChain = %s, want error", chainNames(chain))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := chainNames(chain); got != tt.want {
+				t.Errorf("resolveChain = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
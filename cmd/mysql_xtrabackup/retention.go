@@ -0,0 +1,277 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LYcoding0/dbbackup/internal/manifest"
+	"github.com/LYcoding0/dbbackup/internal/retention"
+	"github.com/LYcoding0/dbbackup/internal/storage"
+	"github.com/LYcoding0/dbbackup/internal/xtrabackup"
+)
+
+// remoteBackup 存储中的一份备份：同一备份名下的归档、目录中的文件和清单。
+type remoteBackup struct {
+	Name     string
+	Type     string    // 备份名中的类型，full 或 incr
+	Time     time.Time // 备份名中的时间
+	Keys     []string  // 有清单时清单在最前
+	Size     int64
+	Complete bool // 有清单，即已完整上传并校验
+}
+
+// listRemoteBackups 按备份名归类存储中的文件，返回按时间排序的备份；
+// 不符合 <prefix>_<type>_<时间> 命名的文件不属于任何备份，不会被列出。
+func listRemoteBackups(cfg *Config, s storage.Storage) ([]*remoteBackup, error) {
+	objects, err := s.List(cfg.BackupPrefix + "_")
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]*remoteBackup{}
+	var backups []*remoteBackup
+	for _, o := range objects {
+		top, _, _ := strings.Cut(o.Name, "/")
+		name, _ := trimArchiveExt(strings.TrimSuffix(top, manifest.Suffix))
+		typ, t, ok := parseBackupName(cfg.BackupPrefix, name)
+		if !ok {
+			continue
+		}
+		b := byName[name]
+		if b == nil {
+			b = &remoteBackup{Name: name, Type: typ, Time: t}
+			byName[name] = b
+			backups = append(backups, b)
+		}
+		b.Size += o.Size
+		if o.Name == name+manifest.Suffix {
+			b.Complete = true
+			b.Keys = append([]string{o.Name}, b.Keys...)
+		} else {
+			b.Keys = append(b.Keys, o.Name)
+		}
+	}
+	// 名称中含类型，不能直接按字符串排序
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Time.Before(backups[j].Time) })
+	return backups, nil
+}
+
+// latestRemoteBackup 返回存储中按时间最新的完整备份名。
+func latestRemoteBackup(cfg *Config, s storage.Storage) (string, error) {
+	backups, err := listRemoteBackups(cfg, s)
+	if err != nil {
+		return "", err
+	}
+	for i := len(backups) - 1; i >= 0; i-- {
+		if backups[i].Complete {
+			return backups[i].Name, nil
+		}
+	}
+	return "", errors.New("no backup found in storage")
+}
+
+// pruneRemote 按目的地的保留策略删除存储中过期的备份，返回已删除的备份（"目的地: 备份名"）。
+// 每个备份先删除清单，中途失败时剩下的文件不会被当作完整的备份。dryRun 时只报告。
+func pruneRemote(cfg *Config, d *Destination, s storage.Storage, dryRun bool) ([]string, error) {
+	backups, err := listRemoteBackups(cfg, s)
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]*remoteBackup{}
+	list := make([]retention.Backup, len(backups))
+	for i, b := range backups {
+		byName[b.Name] = b
+		list[i] = retention.Backup{Name: b.Name, Time: b.Time, Complete: b.Complete}
+		// 未完整上传的增量备份无法恢复，不需要为它保留基线
+		if b.Complete && b.Type != "full" {
+			if list[i].Parent, err = remoteParent(s, b.Keys[0]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	var pruned []string
+	for _, e := range d.Retention.Expired(list, time.Now()) {
+		b := byName[e.Name]
+		desc := fmt.Sprintf("%s (%d file(s), %s", b.Name, len(b.Keys), manifest.FormatSize(b.Size))
+		if !b.Complete {
+			desc += ", incomplete"
+		}
+		desc += ")"
+		if dryRun {
+			fmt.Printf("[%s] [%s] would remove %s\n", timeStamp(), d.Name, desc)
+			continue
+		}
+		for _, key := range b.Keys {
+			if err := s.Delete(key); err != nil {
+				return pruned, fmt.Errorf("prune %s: %w", key, err)
+			}
+		}
+		fmt.Printf("[%s] [%s] pruned %s\n", timeStamp(), d.Name, desc)
+		pruned = append(pruned, d.Name+": "+b.Name)
+	}
+	return pruned, nil
+}
+
+// remoteParent 读取存储中的清单，返回增量备份的基线。
+func remoteParent(s storage.Storage, key string) (string, error) {
+	r, err := s.Get(key)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	var m manifest.Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return "", fmt.Errorf("parse manifest %s: %w", key, err)
+	}
+	return m.Parent, nil
+}
+
+// runPrune 按保留策略清理本地 backup_dir 和所有目的地，dryRun 时只列出将被删除的备份。
+func runPrune(cfg *Config, dryRun bool) error {
+	var errs []string
+	if !cfg.Retention.IsZero() {
+		fmt.Printf("[%s] local retention: %s\n", timeStamp(), cfg.Retention)
+		if _, err := cleanupOld(cfg, dryRun); err != nil {
+			errs = append(errs, "local: "+err.Error())
+		}
+	}
+	for i := range cfg.Destinations {
+		d := &cfg.Destinations[i]
+		if d.Retention.IsZero() {
+			fmt.Printf("[%s] [%s] no retention configured, skipped\n", timeStamp(), d.Name)
+			continue
+		}
+		fmt.Printf("[%s] [%s] retention: %s\n", timeStamp(), d.Name, d.Retention)
+		err := func() error {
+			s, err := storage.Open(d.Config)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+			_, err = pruneRemote(cfg, d, s, dryRun)
+			return err
+		}()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("destination %s: %v", d.Name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// localFiles backup_dir 中的一份备份：同名的目录、归档、清单和日志。
+type localFiles struct {
+	Name     string
+	Type     string
+	Time     time.Time
+	Paths    []string
+	Manifest string // 清单状态，没有清单时为空
+	Parent   string // 清单中增量备份的基线
+	HasData  bool   // 有备份目录或归档
+}
+
+// cleanupOld 按顶层保留策略删除 backup_dir 中过期的备份及其日志（包括恢复日志），返回已删除的备份（"local: 备份名"），
+// dryRun 时只报告。
+// 成功的备份，以及没有清单的旧版本备份，才占用日、周、月、年的名额；
+// 保留的增量备份依赖的全量和增量备份一并保留。
+func cleanupOld(cfg *Config, dryRun bool) ([]string, error) {
+	byName := map[string]*localFiles{}
+	var list []retention.Backup
+	add := func(dir string) error {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			base := e.Name()
+			name, archive := trimArchiveExt(strings.TrimSuffix(strings.TrimSuffix(base, manifest.Suffix), ".log"))
+			// 恢复日志 <备份名>_restore_<时间>.log 随所恢复的备份一起清理
+			if i := strings.LastIndex(name, "_restore_"); i > 0 && strings.HasSuffix(base, ".log") {
+				name = name[:i]
+			}
+			typ, t, ok := parseBackupName(cfg.BackupPrefix, name)
+			if !ok {
+				continue
+			}
+			b := byName[name]
+			if b == nil {
+				b = &localFiles{Name: name, Type: typ, Time: t}
+				byName[name] = b
+			}
+			fp := filepath.Join(dir, base)
+			b.Paths = append(b.Paths, fp)
+			switch {
+			case strings.HasSuffix(base, manifest.Suffix):
+				if m, err := manifest.Read(fp); err == nil {
+					b.Manifest, b.Parent = m.Status, m.Parent
+				} else {
+					b.Manifest = "unreadable"
+				}
+			case archive || e.IsDir():
+				b.HasData = true
+			}
+		}
+		return nil
+	}
+	if err := add(cfg.BackupDir); err != nil {
+		return nil, fmt.Errorf("cleanup read dir: %w", err)
+	}
+	if filepath.Clean(cfg.LogDir) != filepath.Clean(cfg.BackupDir) {
+		_ = add(cfg.LogDir)
+	}
+	legacyParents(cfg, byName)
+	for _, b := range byName {
+		complete := b.Manifest == manifest.StatusSuccess || (b.Manifest == "" && b.HasData)
+		list = append(list, retention.Backup{Name: b.Name, Time: b.Time, Complete: complete, Parent: b.Parent})
+	}
+	var pruned []string
+	for _, e := range cfg.Retention.Expired(list, time.Now()) {
+		b := byName[e.Name]
+		for _, fp := range b.Paths {
+			if dryRun {
+				fmt.Printf("[%s] would remove local %s\n", timeStamp(), fp)
+				continue
+			}
+			if err := os.RemoveAll(fp); err != nil {
+				return pruned, fmt.Errorf("cleanup remove %s: %w", fp, err)
+			}
+			fmt.Printf("[%s] cleaned old backup %s\n", timeStamp(), fp)
+		}
+		if !dryRun {
+			pruned = append(pruned, "local: "+b.Name)
+		}
+	}
+	return pruned, nil
+}
+
+// legacyParents 没有清单的旧增量备份按 xtrabackup_checkpoints 的 LSN 找到基线；
+// 找不到链路时不设置基线，只按时间清理。
+func legacyParents(cfg *Config, byName map[string]*localFiles) {
+	need := false
+	for _, b := range byName {
+		need = need || (b.Manifest == "" && b.HasData && b.Type != "full")
+	}
+	if !need {
+		return
+	}
+	backups, err := listLocalBackups(cfg)
+	if err != nil {
+		return
+	}
+	for _, b := range backups {
+		f := byName[b.Name]
+		if f == nil || f.Manifest != "" || b.Checkpoints.BackupType == xtrabackup.TypeFull {
+			continue
+		}
+		if chain, err := resolveChain(backups, b); err == nil {
+			f.Parent = chain[len(chain)-2].Name
+		}
+	}
+}
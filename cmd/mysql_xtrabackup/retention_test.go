@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/LYcoding0/dbbackup/internal/retention"
+)
+
+func TestCleanupOldRestoreLogs(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &Config{BackupDir: dir, LogDir: filepath.Join(dir, "log"), BackupPrefix: "mysql", Retention: retention.Policy{Days: 7}}
+	if err := os.MkdirAll(cfg.LogDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	name := func(age int) string {
+		return "mysql_full_" + time.Now().AddDate(0, 0, -age).Format("20060102_150405")
+	}
+	old, recent, gone := name(30), name(1), name(40)
+	for _, b := range []string{old, recent} {
+		if err := os.Mkdir(filepath.Join(dir, b), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	logs := []string{
+		old + ".log",
+		old + "_restore_20240601_100000.log",
+		recent + ".log",
+		recent + "_restore_20240601_100000.log",
+		// 本地已删除、从存储下载恢复的备份
+		gone + "_restore_20240601_100000.log",
+		"daemon.log",
+	}
+	for _, l := range logs {
+		if err := os.WriteFile(filepath.Join(cfg.LogDir, l), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pruned, err := cleanupOld(cfg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(pruned)
+	if want := []string{"local: " + gone, "local: " + old}; len(pruned) != 2 || pruned[0] != want[0] || pruned[1] != want[1] {
+		t.Errorf("pruned = %v, want %v", pruned, want)
+	}
+	var left []string
+	for _, d := range []string{dir, cfg.LogDir} {
+		entries, err := os.ReadDir(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			if e.Name() != "log" {
+				left = append(left, e.Name())
+			}
+		}
+	}
+	sort.Strings(left)
+	want := []string{recent, "daemon.log", recent + ".log", recent + "_restore_20240601_100000.log"}
+	sort.Strings(want)
+	if len(left) != len(want) {
+		t.Fatalf("left = %v, want %v", left, want)
+	}
+	for i := range want {
+		if left[i] != want[i] {
+			t.Fatalf("left = %v, want %v", left, want)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LYcoding0/dbbackup/internal/manifest"
+	"github.com/LYcoding0/dbbackup/internal/storage"
+)
+
+// uploadBackup 将备份并行上传到所有目的地，必需的目的地都上传并校验成功时返回 nil，
+// 可选目的地的失败作为告警返回。上传后按各目的地的保留策略清理过期备份，返回已删除的备份。
+func uploadBackup(cfg *Config, manifestPath string) (warnings, pruned []string, err error) {
+	m, err := manifest.Read(manifestPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if m.Status != manifest.StatusSuccess {
+		return nil, nil, fmt.Errorf("backup %s did not succeed (status %s)", m.Name, m.Status)
+	}
+
+	errs := make([]error, len(cfg.Destinations))
+	prunedBy := make([][]string, len(cfg.Destinations))
+	var wg sync.WaitGroup
+	for i := range cfg.Destinations {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			prunedBy[i], errs[i] = syncDestination(cfg, &cfg.Destinations[i], m, manifestPath)
+		}(i)
+	}
+	wg.Wait()
+
+	var failed []string
+	for i, d := range cfg.Destinations {
+		pruned = append(pruned, prunedBy[i]...)
+		if errs[i] == nil {
+			continue
+		}
+		msg := fmt.Sprintf("destination %s: %v", d.Name, errs[i])
+		fmt.Printf("[%s] %s\n", timeStamp(), msg)
+		if d.Optional {
+			warnings = append(warnings, msg)
+		} else {
+			failed = append(failed, msg)
+		}
+	}
+	if len(failed) > 0 {
+		return warnings, pruned, errors.New(strings.Join(failed, "; "))
+	}
+	return warnings, pruned, nil
+}
+
+// syncDestination 上传到目的地 d 并清理其中的过期备份，返回已删除的备份。
+func syncDestination(cfg *Config, d *Destination, m *manifest.Manifest, manifestPath string) ([]string, error) {
+	s, err := storage.Open(d.Config)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	if err := uploadTo(cfg, d, s, m, manifestPath); err != nil {
+		return nil, err
+	}
+	if !d.Retention.IsZero() {
+		return pruneRemote(cfg, d, s, false)
+	}
+	return nil, nil
+}
+
+// uploadTo 将清单中的归档（或未打包的备份目录）上传到 s，逐个文件与清单中的大小和 SHA-256
+// 比对后再上传清单，存储中有清单即表示该备份已完整上传，已有清单时跳过。
+// 中断后重新上传同一备份时从断点继续；流式备份的数据已上传到主目的地，其他目的地从主目的地复制。
+func uploadTo(cfg *Config, d *Destination, s storage.Storage, m *manifest.Manifest, manifestPath string) error {
+	manifestKey := filepath.Base(manifestPath)
+	if _, err := s.Stat(manifestKey); err == nil {
+		fmt.Printf("[%s] [%s] %s already in %s\n", timeStamp(), d.Name, m.Name, s)
+		return nil
+	} else if !errors.Is(err, storage.ErrNotExist) {
+		return err
+	}
+
+	for _, top := range topPaths(m) {
+		local := filepath.Join(cfg.BackupDir, top)
+		if _, err := os.Stat(local); os.IsNotExist(err) {
+			if p := cfg.primary(); p != nil && p.Name != d.Name {
+				if err := copyFrom(p, s, m, top); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		fmt.Printf("[%s] [%s] upload %s -> %s/%s\n", timeStamp(), d.Name, local, s, top)
+		if err := storage.PutPath(s, local, top); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("[%s] [%s] verify %d file(s) in %s\n", timeStamp(), d.Name, len(m.Files), s)
+	for _, f := range m.Files {
+		if err := storage.Verify(s, f.Path, f.Size, f.SHA256); err != nil {
+			if errors.Is(err, storage.ErrMismatch) {
+				// 删除损坏的副本，重新上传时从头开始
+				s.Delete(f.Path)
+			}
+			return err
+		}
+	}
+	if err := storage.PutPath(s, manifestPath, manifestKey); err != nil {
+		return err
+	}
+	fmt.Printf("[%s] [%s] upload finished\n", timeStamp(), d.Name)
+	return nil
+}
+
+// copyFrom 从目的地 src 复制清单中 top 下的文件到 dst，用于只存在于主目的地的流式备份。
+func copyFrom(src *Destination, dst storage.Storage, m *manifest.Manifest, top string) error {
+	s, err := storage.Open(src.Config)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	for _, f := range m.Files {
+		if f.Path != top && !strings.HasPrefix(f.Path, top+"/") {
+			continue
+		}
+		fmt.Printf("[%s] copy %s/%s -> %s\n", timeStamp(), s, f.Path, dst)
+		if err := storage.Copy(s, dst, f.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runUpload 重新上传本地已有的备份，用于上传中断或校验失败之后，已有该备份的目的地跳过；
+// want 为空时取本地最新的成功备份。
+func runUpload(cfg *Config, want string) ([]string, error) {
+	var name string
+	if want != "" {
+		name, _ = trimArchiveExt(strings.TrimSuffix(filepath.Base(want), manifest.Suffix))
+	} else {
+		paths, _ := filepath.Glob(filepath.Join(cfg.BackupDir, cfg.BackupPrefix+"_*"+manifest.Suffix))
+		var latest time.Time
+		for _, p := range paths {
+			base := strings.TrimSuffix(filepath.Base(p), manifest.Suffix)
+			_, t, ok := parseBackupName(cfg.BackupPrefix, base)
+			if !ok || (name != "" && !t.After(latest)) {
+				continue
+			}
+			if m, err := manifest.Read(p); err == nil && m.Status == manifest.StatusSuccess {
+				name, latest = base, t
+			}
+		}
+		if name == "" {
+			return nil, fmt.Errorf("no successful backup found in %s", cfg.BackupDir)
+		}
+	}
+	warnings, _, err := uploadBackup(cfg, manifest.PathFor(cfg.BackupDir, name))
+	return warnings, err
+}
+
+// topPaths 返回清单中文件路径的第一段，即归档文件名或备份目录名。
+func topPaths(m *manifest.Manifest) []string {
+	var tops []string
+	for _, f := range m.Files {
+		top, _, _ := strings.Cut(f.Path, "/")
+		if len(tops) == 0 || tops[len(tops)-1] != top {
+			tops = append(tops, top)
+		}
+	}
+	return tops
+}
+
+// fetchBackups 从目的地 from（为空时为第一个）下载要恢复的备份及其依赖的全量/增量备份到 backup_dir，
+// want 为空时取存储中最新的备份。本地已有的备份不会重复下载。
+func fetchBackups(cfg *Config, from, want string) error {
+	d, err := cfg.destination(from)
+	if err != nil {
+		return err
+	}
+	s, err := storage.Open(d.Config)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	var name string
+	if want != "" {
+		name, _ = trimArchiveExt(filepath.Base(want))
+	} else if name, err = latestRemoteBackup(cfg, s); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cfg.BackupDir, 0755); err != nil {
+		return fmt.Errorf("create backup_dir: %w", err)
+	}
+	// 沿清单中的 parent 向上，直到全量备份
+	for seen := map[string]bool{}; name != ""; {
+		if seen[name] {
+			return fmt.Errorf("parent loop at %s", name)
+		}
+		seen[name] = true
+		m, err := fetchBackup(cfg, s, name)
+		if err != nil {
+			return err
+		}
+		name = m.Parent
+	}
+	return nil
+}
+
+// fetchBackup 下载一个备份的清单和清单中列出的文件，并按清单校验大小和 SHA-256。
+func fetchBackup(cfg *Config, s storage.Storage, name string) (*manifest.Manifest, error) {
+	manifestPath := manifest.PathFor(cfg.BackupDir, name)
+	m, err := manifest.Read(manifestPath)
+	if err == nil && hasFiles(cfg.BackupDir, m) {
+		fmt.Printf("[%s] %s already in %s\n", timeStamp(), name, cfg.BackupDir)
+		return m, nil
+	}
+
+	fmt.Printf("[%s] fetch %s from %s\n", timeStamp(), name, s)
+	if err := storage.GetPath(s, name+manifest.Suffix, manifestPath); err != nil {
+		return nil, err
+	}
+	if m, err = manifest.Read(manifestPath); err != nil {
+		return nil, err
+	}
+	if m.Status != manifest.StatusSuccess {
+		return nil, fmt.Errorf("backup %s did not succeed (status %s)", name, m.Status)
+	}
+	// 清单中的路径相对于 backup_dir
+	for _, top := range topPaths(m) {
+		if err := storage.GetPath(s, top, filepath.Join(cfg.BackupDir, top)); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := m.Check(cfg.BackupDir, ""); err != nil {
+		// 删除清单，下次重新下载而不是当作已在本地
+		os.Remove(manifestPath)
+		return nil, fmt.Errorf("fetch %s: %w", name, err)
+	}
+	return m, nil
+}
+
+// hasFiles 清单中的文件是否都已在本地。
+func hasFiles(dir string, m *manifest.Manifest) bool {
+	for _, f := range m.Files {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(f.Path))); err != nil {
+			return false
+		}
+	}
+	return len(m.Files) > 0
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LYcoding0/dbbackup/internal/manifest"
+	"github.com/LYcoding0/dbbackup/internal/storage"
+)
+
+func TestFetchBackupVerifies(t *testing.T) {
+	remote := t.TempDir()
+	name := "mysql_full_20240501_020000"
+	files := map[string]string{
+		"xtrabackup_checkpoints": "backup_type = full-backuped\nfrom_lsn = 0\nto_lsn = 100\n",
+		"ibdata1":                "innodb data",
+	}
+	if err := os.Mkdir(filepath.Join(remote, name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for f, data := range files {
+		if err := os.WriteFile(filepath.Join(remote, name, f), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := manifest.New(name)
+	m.Status = manifest.StatusSuccess
+	if err := m.AddPath(remote, filepath.Join(remote, name)); err != nil {
+		t.Fatal(err)
+	}
+	if err := manifest.Write(manifest.PathFor(remote, name), m); err != nil {
+		t.Fatal(err)
+	}
+	s, err := storage.Open(storage.Config{URL: remote})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	cfg := &Config{BackupDir: t.TempDir()}
+	if _, err := fetchBackup(cfg, s, name); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := m.Check(cfg.BackupDir, ""); err != nil || n != 2 {
+		t.Errorf("fetched files: %d checked, %v", n, err)
+	}
+
+	// 存储中的文件损坏时报错，并删除清单，下次重新下载
+	if err := os.WriteFile(filepath.Join(remote, name, "ibdata1"), []byte("innodb"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg.BackupDir = t.TempDir()
+	if _, err := fetchBackup(cfg, s, name); err == nil || !strings.Contains(err.Error(), "ibdata1: size 6") {
+		t.Errorf("fetch of a corrupted file: err = %v, want a size mismatch", err)
+	}
+	if _, err := os.Stat(manifest.PathFor(cfg.BackupDir, name)); !os.IsNotExist(err) {
+		t.Errorf("manifest of a corrupted download left behind: %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os/exec"
+
+	"github.com/LYcoding0/dbbackup/internal/compress"
+	"github.com/LYcoding0/dbbackup/internal/crypt"
+	"github.com/LYcoding0/dbbackup/internal/manifest"
+	"github.com/LYcoding0/dbbackup/internal/storage"
+)
+
+// streamBackup 以 --stream=xbstream 执行 xtrabackup，输出边压缩、加密边上传到主目的地，
+// 本地不落盘；args 中需已包含 --extra-lsndir。返回备份在存储中的位置。
+func streamBackup(cfg *Config, args []string, name string, m *manifest.Manifest, logger io.Writer) (string, error) {
+	s, err := storage.Open(cfg.primary().Config)
+	if err != nil {
+		return "", err
+	}
+	defer s.Close()
+
+	key := name + ".xbstream" + compress.Ext(cfg.Stream.Compress)
+	if cfg.Encryption.Enabled {
+		key += crypt.Ext
+	}
+	fmt.Fprintf(logger, "[%s] streaming to %s/%s\n", timeStamp(), s, key)
+
+	pr, pw := io.Pipe()
+	uploaded := make(chan error, 1)
+	go func() {
+		err := s.Put(key, pr)
+		// 上传失败时让写入端立即出错，避免 xtrabackup 阻塞
+		pr.CloseWithError(err)
+		uploaded <- err
+	}()
+
+	sum := &hashWriter{h: sha256.New()}
+	if err := runStream(cfg, args, io.MultiWriter(pw, sum), logger); err != nil {
+		// 上传先失败时 err 中已包含上传的错误
+		pw.CloseWithError(err)
+		<-uploaded
+		return "", err
+	}
+	pw.Close()
+	if err := <-uploaded; err != nil {
+		return "", fmt.Errorf("upload %s: %w", key, err)
+	}
+
+	m.Files = append(m.Files, manifest.File{Path: key, Size: sum.n, SHA256: hex.EncodeToString(sum.h.Sum(nil))})
+	m.Size += sum.n
+	fmt.Fprintf(logger, "[%s] streamed %d bytes\n", timeStamp(), sum.n)
+	return fmt.Sprintf("%s/%s", s, key), nil
+}
+
+// runStream 执行 xtrabackup 并将 stdout 经压缩、加密后写入 w。
+func runStream(cfg *Config, args []string, w io.Writer, logger io.Writer) error {
+	var enc *crypt.Writer
+	if cfg.Encryption.Enabled {
+		var err error
+		if enc, err = crypt.NewWriter(w, cfg.key); err != nil {
+			return fmt.Errorf("start encryption: %w", err)
+		}
+		w = enc
+	}
+	zw, err := compress.NewWriter(w, cfg.Stream.Compress, cfg.Stream.CompressLevel)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(cfg.XtraBackup.Bin, args...)
+	cmd.Stderr = logger
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start xtrabackup: %w", err)
+	}
+	// 写入失败（例如上传中断）时结束 xtrabackup，否则它会阻塞在管道上
+	_, copyErr := io.Copy(zw, stdout)
+	if copyErr != nil {
+		cmd.Process.Kill()
+	}
+	if err := cmd.Wait(); err != nil && copyErr == nil {
+		return fmt.Errorf("xtrabackup: %w", err)
+	}
+	if copyErr != nil {
+		return fmt.Errorf("stream: %w", copyErr)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("finish compression: %w", err)
+	}
+	if enc != nil {
+		if err := enc.Close(); err != nil {
+			return fmt.Errorf("finish encryption: %w", err)
+		}
+	}
+	return nil
+}
+
+// hashWriter 计算写入数据的 SHA-256 和长度。
+type hashWriter struct {
+	h hash.Hash
+	n int64
+}
+
+func (w *hashWriter) Write(p []byte) (int, error) {
+	w.h.Write(p)
+	w.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/LYcoding0/dbbackup/internal/manifest"
+	"github.com/LYcoding0/dbbackup/internal/verify"
+)
+
+// runVerify 校验 backup_dir 下的备份目录、归档和清单，want 不为空时只校验该备份。
+// 与 listLocalBackups 不同，checkpoints 损坏的备份也会被检查并报告。
+func runVerify(cfg *Config, want string) error {
+	entries, err := os.ReadDir(cfg.BackupDir)
+	if err != nil {
+		return fmt.Errorf("read backup_dir: %w", err)
+	}
+	wantName, _ := trimArchiveExt(strings.TrimSuffix(filepath.Base(want), manifest.Suffix))
+	opts := verify.Options{Key: cfg.key}
+
+	var results []verify.Result
+	verified := map[string]bool{}
+	var manifests []string
+	for _, e := range entries {
+		name := e.Name()
+		base, isArchive := trimArchiveExt(name)
+		isManifest := !e.IsDir() && strings.HasSuffix(name, manifest.Suffix)
+		if isManifest {
+			base = strings.TrimSuffix(name, manifest.Suffix)
+		} else if !e.IsDir() && !isArchive {
+			continue
+		}
+		if _, _, ok := parseBackupName(cfg.BackupPrefix, base); !ok {
+			continue
+		}
+		if want != "" && base != wantName {
+			continue
+		}
+		if isManifest {
+			manifests = append(manifests, base)
+			continue
+		}
+		verified[base] = true
+		results = append(results, verify.Path(filepath.Join(cfg.BackupDir, name), opts)...)
+	}
+	// 只剩清单的备份（例如失败的备份）也要报告
+	for _, base := range manifests {
+		if !verified[base] {
+			verified[base] = true
+			results = append(results, verify.Manifest(manifest.PathFor(cfg.BackupDir, base), opts)...)
+		}
+	}
+	if len(verified) == 0 {
+		if want != "" {
+			return fmt.Errorf("backup %s not found in %s", wantName, cfg.BackupDir)
+		}
+		return errors.New("no backup found in backup_dir")
+	}
+
+	for _, r := range results {
+		fmt.Println(r)
+	}
+	if failed := verify.Failed(results); failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(results))
+	}
+	fmt.Printf("Verified %d backup(s), all checks passed\n", len(verified))
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/LYcoding0/dbbackup/internal/metrics"
+	"github.com/LYcoding0/dbbackup/internal/pool"
+	"github.com/LYcoding0/dbbackup/internal/schedule"
+)
+
+// daemonMetrics daemon 模式下各目标共用的指标，由 /metrics 提供；非 daemon 模式为 nil
+var daemonMetrics *metrics.Registry
+
+// runDaemon 按配置中各目标的 schedule 定时备份，直到收到 SIGINT/SIGTERM。
+// 收到 SIGHUP 时重新加载配置，新配置有误时继续使用旧配置；metrics.listen 的修改需重启生效。
+func runDaemon(configPath string, names []string) error {
+	cfg, err := loadJobsConfig(configPath)
+	if err != nil {
+		return err
+	}
+	// 重新加载配置时沿用同一个 Limiter，正在执行的任务仍计入并发限制
+	limiter := pool.NewLimiter(cfg.Concurrency, cfg.PerHostLimit)
+	jobs, err := daemonJobs(cfg, names, limiter)
+	if err != nil {
+		return err
+	}
+
+	// 从 textfile 恢复之前的值，重启后计数器和上次成功时间不会丢失
+	if daemonMetrics, err = metrics.Load(cfg.Metrics.Textfile); err != nil {
+		daemonLogf("load metrics %s: %v", cfg.Metrics.Textfile, err)
+		daemonMetrics = metrics.New()
+	}
+	if cfg.Metrics.Listen != "" {
+		srv, err := metrics.Serve(cfg.Metrics.Listen, daemonMetrics)
+		if err != nil {
+			return fmt.Errorf("metrics listen: %v", err)
+		}
+		defer srv.Close()
+		daemonLogf("serving metrics on http://%s/metrics", cfg.Metrics.Listen)
+	}
+
+	runner := schedule.NewRunner(daemonLogf)
+	runner.Set(jobs)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				daemonLogf("reloading %s", configPath)
+				newJobs, err := loadDaemonJobs(configPath, names, limiter)
+				if err != nil {
+					daemonLogf("reload failed, keeping previous config: %v", err)
+					continue
+				}
+				runner.Set(newJobs)
+			}
+		}
+	}()
+
+	daemonLogf("daemon started, pid %d", os.Getpid())
+	runner.Run(ctx)
+	daemonLogf("daemon stopped")
+	return nil
+}
+
+// loadDaemonJobs 读取配置并生成定时任务，成功后按新配置调整 limiter 的并发限制
+func loadDaemonJobs(configPath string, names []string, limiter *pool.Limiter) ([]schedule.Job, error) {
+	cfg, err := loadJobsConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := daemonJobs(cfg, names, limiter)
+	if err != nil {
+		return nil, err
+	}
+	limiter.SetLimits(cfg.Concurrency, cfg.PerHostLimit)
+	return jobs, nil
+}
+
+// daemonJobs 为配置了 schedule 的目标生成定时任务，所有任务共享 limiter 的并发限制
+func daemonJobs(cfg *JobsConfig, names []string, limiter *pool.Limiter) ([]schedule.Job, error) {
+	selected, err := cfg.selectTargets(names)
+	if err != nil {
+		return nil, err
+	}
+	var jobs []schedule.Job
+	for _, tc := range selected {
+		if tc.Schedule == "" {
+			daemonLogf("target %s has no schedule, ignored", tc.Name)
+			continue
+		}
+		sched, err := schedule.Parse(tc.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("target %s: %v", tc.Name, err)
+		}
+		tc := tc
+		jobs = append(jobs, schedule.Job{
+			Name:     tc.Name,
+			Schedule: sched,
+			Overlap:  tc.Overlap,
+			Run: func() {
+				host := tc.hostKey()
+				if err := limiter.Acquire(context.Background(), host); err != nil {
+					return
+				}
+				defer limiter.Release(host)
+				res := runJob(tc)
+				finishJob(cfg, tc, res)
+				if res.Err != nil {
+					daemonLogf("[%s] backup failed after %s: %v", tc.Name, res.Duration.Round(time.Second), res.Err)
+					return
+				}
+				daemonLogf("[%s] backup finished in %s: %v", tc.Name, res.Duration.Round(time.Second), res.Backups)
+			},
+		})
+	}
+	if len(jobs) == 0 {
+		return nil, errors.New("no target has a schedule")
+	}
+	return jobs, nil
+}
+
+// daemonLogf 输出带时间戳的调度日志
+func daemonLogf(format string, args ...interface{}) {
+	fmt.Printf("[%s] "+format+"\n", append([]interface{}{time.Now().Format("2006-01-02 15:04:05")}, args...)...)
+}
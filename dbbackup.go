@@ -1,183 +1,298 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
-	"os/exec"
+	"strconv"
 	"strings"
-	"time"
-)
-
-// MongoDBConfig MongoDB配置结构
-type MongoDBConfig struct {
-	Host              string
-	Port              string
-	Username          string
-	Password          string
-	Database          string
-	AuthDatabase      string // 新增：认证数据库
-	Options           string
-	AllDatabases      bool   // 新增：是否备份所有数据库
-}
 
+	"github.com/LYcoding0/dbbackup/internal/compress"
+	"github.com/LYcoding0/dbbackup/internal/crypt"
+	"github.com/LYcoding0/dbbackup/internal/history"
+	"github.com/LYcoding0/dbbackup/internal/storage"
+)
 
-// 新增PostgreSQL备份配置结构
-type PostgresConfig struct {
-	Host        string
-	Port        string
-	Username    string
-	Password    string
-	Database    string
-	AllDatabases bool // 是否备份所有数据库
-}
-
-// 新增MySQL配置结构
-type MySQLConfig struct {
-	Host        string
-	Port        string
-	Username    string
-	Password    string
-	Database    string
-	AllDatabases bool   // 是否备份所有数据库
-	BackupTool  string // "mysqldump" 或 "xtrabackup"
-	Datadir     string // 数据目录（使用xtrabackup时必需）
+// RestoreOptions 恢复配置结构
+type RestoreOptions struct {
+	InputPath  string     // 本工具生成的备份文件或目录
+	TargetDB   string     // 目标数据库，为空则使用备份中的数据库
+	AssumeYes  bool       // 跳过交互确认
+	DecryptKey *crypt.Key // 解密.enc备份使用的密钥
 }
 
 func main() {
 	// 定义命令行参数（包含简写形式）
-	dbType := flag.String("t", "", "Database type: mysql, postgresql, mongodb (shorthand)")
-	flag.String("type", "", "Database type: mysql, postgresql, mongodb")
-	
+	typeUsage := "Database type: " + strings.Join(driverNames(), ", ")
+	dbType := flag.String("t", "", typeUsage+" (shorthand)")
+	flag.String("type", "", typeUsage)
+
 	host := flag.String("h", "localhost", "Database host (shorthand)")
 	flag.String("host", "localhost", "Database host")
-	
+
 	port := flag.String("P", "", "Database port (shorthand)")
 	flag.String("port", "", "Database port")
-	
+
 	username := flag.String("u", "", "Database username (shorthand)")
 	flag.String("user", "", "Database username")
-	
+
 	password := flag.String("p", "", "Database password (shorthand)")
 	flag.String("pass", "", "Database password")
-	
+
 	database := flag.String("db", "", "Database name")
 	outputDir := flag.String("out", "./backups", "Backup output directory")
-	mongoOptions := flag.String("mongo-options", "", "Additional MongoDB options")
-	mongoAuthDB := flag.String("mongo-auth-db", "", "MongoDB authentication database")
-	mongoAllDBs := flag.Bool("mongo-all", false, "MongoDB backup all databases")
-	
-	// MySQL特定参数
-	mysqlBackupTool := flag.String("mysql-tool", "mysqldump", "MySQL backup tool: mysqldump or xtrabackup")
-	mysqlDatadir := flag.String("mysql-datadir", "/var/lib/mysql", "MySQL data directory (required for xtrabackup)")
-	mysqlAllDBs := flag.Bool("mysql-all", true, "MySQL backup all databases (default true)")
-	
-	// PostgreSQL特定参数
-	postgresAllDatabases := flag.Bool("postgres-all", false, "PostgreSQL backup all databases (pg_dumpall)")
-	
+
+	// 运行模式及恢复参数
+	mode := flag.String("mode", "backup", "Run mode: backup, restore, list, verify, daemon, prune or history")
+	inputPath := flag.String("in", "", "Backup file, directory or manifest to restore or verify")
+	targetDB := flag.String("target-db", "", "Restore into this database instead of the one in the backup")
+	assumeYes := flag.Bool("yes", false, "Skip restore confirmation prompt")
+	dryRun := flag.Bool("dry-run", false, "Only list the backups prune mode would remove")
+
+	// history 模式的查询条件，-targets 和 -type 同样用于筛选
+	status := flag.String("status", "", "Only show runs with this status: success or failure (history mode)")
+	since := flag.String("since", "", "Only show runs started at or after this time, e.g. 2024-01-01 or 2024-01-01 08:00 (history mode)")
+	until := flag.String("until", "", "Only show runs started before this time, a date includes the whole day (history mode)")
+	limit := flag.Int("limit", 0, "Only show the latest N runs (history mode, 0 = all)")
+	asJSON := flag.Bool("json", false, "Print one JSON object per line (history mode)")
+
+	// 输出处理参数
+	compression := flag.String("compress", "none", "Compress dump output: none, gzip or zstd")
+	compressLevel := flag.Int("compress-level", 0, "Compression level (0 = default; gzip 1-9, zstd 1-19)")
+	storageURL := flag.String("storage", "", "Upload backups to (backup mode) or fetch -in from (restore mode) this storage: a directory, sftp://user@host[:port]/path or s3://bucket/prefix?endpoint=...&path_style=true")
+	keyFile := flag.String("key-file", "", "AES-256 key file: encrypt backups (backup mode) or decrypt .enc backups (restore/verify mode)")
+
+	// 多目标配置文件
+	configPath := flag.String("config", "", "JSON config file describing named backup targets (backup, daemon, prune and history mode)")
+	targetNames := flag.String("targets", "", "Comma-separated target names from -config to run (default all)")
+
+	// 引擎特定参数由已注册的驱动生成
+	registerDriverFlags()
+
 	// 解析命令行参数
 	flag.Parse()
-	
+
 	// 处理参数简写形式
 	*dbType = getFlagValue("t", "type", *dbType)
 	*host = getFlagValue("h", "host", *host)
 	*port = getFlagValue("P", "port", *port)
 	*username = getFlagValue("u", "user", *username)
 	*password = getFlagValue("p", "pass", *password)
-	
+
+	var key *crypt.Key
+	if *keyFile != "" {
+		var err error
+		if key, err = crypt.LoadKey(*keyFile); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// verify 模式只检查本地文件，不需要连接数据库
+	if *mode == "verify" {
+		if *inputPath == "" {
+			fmt.Println("Error: -in is required in verify mode")
+			flag.Usage()
+			os.Exit(1)
+		}
+		if err := runVerify(*inputPath, key); err != nil {
+			fmt.Printf("Verify failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Verify passed")
+		return
+	}
+
+	// 使用配置文件时连接和输出参数均来自配置文件
+	if (*mode == "daemon" || *mode == "prune" || *mode == "history") && *configPath == "" {
+		fmt.Printf("Error: -config is required in %s mode\n", *mode)
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *configPath != "" {
+		var names []string
+		for _, name := range strings.Split(*targetNames, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+		var err error
+		switch *mode {
+		case "backup":
+			err = runJobs(*configPath, names)
+		case "daemon":
+			err = runDaemon(*configPath, names)
+		case "prune":
+			err = runPrune(*configPath, names, *dryRun)
+		case "history":
+			f := history.Filter{Jobs: names, Type: *dbType, Status: *status, Limit: *limit}
+			if *since != "" {
+				f.Since, err = history.ParseTime(*since, false)
+			}
+			if err == nil && *until != "" {
+				f.Until, err = history.ParseTime(*until, true)
+			}
+			if err == nil {
+				err = runHistory(*configPath, f, *asJSON)
+			}
+		default:
+			err = errors.New("-config only supports backup, daemon, prune and history mode")
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// 检查必需参数
 	if *dbType == "" {
 		fmt.Println("Error: -t or -type is required")
 		flag.Usage()
 		os.Exit(1)
 	}
-	
-	if *database == "" && *dbType != "mysql" && !*postgresAllDatabases && !*mongoAllDBs {
-		fmt.Println("Error: -db is required")
+
+	driver, err := lookupDriver(strings.ToLower(*dbType))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *mode != "backup" && *mode != "restore" && *mode != "list" {
+		fmt.Printf("Error: unsupported mode '%s'\n", *mode)
 		flag.Usage()
 		os.Exit(1)
 	}
-	
+
+	if *mode == "restore" && *inputPath == "" {
+		fmt.Println("Error: -in is required in restore mode")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if err := storage.Validate(storage.Config{URL: *storageURL}); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if err := compress.Validate(*compression, *compressLevel); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
 	if *username == "" {
 		fmt.Println("Error: -u or -user is required")
 		flag.Usage()
 		os.Exit(1)
 	}
-	
-	// 设置默认端口
-	if *port == "" {
-		switch *dbType {
-		case "mysql":
-			*port = "3306"
-		case "postgresql":
-			*port = "5432"
-		case "mongodb":
-			*port = "27017"
-		default:
-			fmt.Println("Error: unsupported database type")
+
+	// 未指定端口时使用驱动的默认端口
+	target := &Target{
+		Type:     driver.Name(),
+		Host:     *host,
+		Port:     *port,
+		Username: *username,
+		Password: *password,
+		Database: *database,
+		Options:  driverFlagValues(driver),
+		Output: OutputOptions{
+			Compress:      *compression,
+			CompressLevel: *compressLevel,
+			EncryptKey:    key,
+		},
+	}
+	applyDriverDefaults(driver, target)
+
+	switch *mode {
+	case "backup":
+		if err := driver.Validate(target); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			flag.Usage()
 			os.Exit(1)
 		}
-	}
-	
-	// 创建输出目录
-	if err := os.MkdirAll(*outputDir, 0755); err != nil {
-		fmt.Printf("Error creating output directory: %v\n", err)
-		os.Exit(1)
-	}
-	
-	// 根据数据库类型执行备份
-	switch strings.ToLower(*dbType) {
-	case "mysql":
-		config := &MySQLConfig{
-			Host:        *host,
-			Port:        *port,
-			Username:    *username,
-			Password:    *password,
-			Database:    *database,
-			AllDatabases: *mysqlAllDBs,
-			BackupTool:  *mysqlBackupTool,
-			Datadir:     *mysqlDatadir,
+
+		// 创建输出目录
+		if err := os.MkdirAll(*outputDir, 0755); err != nil {
+			fmt.Printf("Error creating output directory: %v\n", err)
+			os.Exit(1)
 		}
-		err := backupMySQL(config, *outputDir)
+
+		m, err := runBackup(driver, target, *outputDir)
 		if err != nil {
-			fmt.Printf("MySQL backup failed: %v\n", err)
+			fmt.Printf("%s backup failed: %v\n", driver.Name(), err)
 			os.Exit(1)
 		}
-	case "postgresql":
-		config := &PostgresConfig{
-			Host:         *host,
-			Port:         *port,
-			Username:     *username,
-			Password:     *password,
-			Database:     *database,
-			AllDatabases: *postgresAllDatabases,
+		if *storageURL != "" {
+			if err := withStorage(*storageURL, func(s storage.Storage) error {
+				return uploadBackup(s, *outputDir, "", m)
+			}); err != nil {
+				fmt.Printf("Upload failed: %v\n", err)
+				os.Exit(1)
+			}
 		}
-		err := backupPostgreSQL(config, *outputDir)
-		if err != nil {
-			fmt.Printf("PostgreSQL backup failed: %v\n", err)
-			os.Exit(1)
+	case "restore":
+		// 指定 -storage 时 -in 为存储中的路径，先下载到 -out
+		if *storageURL != "" {
+			if err := withStorage(*storageURL, func(s storage.Storage) error {
+				if err := os.MkdirAll(*outputDir, 0755); err != nil {
+					return err
+				}
+				local, err := fetchBackup(s, *inputPath, *outputDir)
+				*inputPath = local
+				return err
+			}); err != nil {
+				fmt.Printf("Download failed: %v\n", err)
+				os.Exit(1)
+			}
 		}
-	case "mongodb":
-		config := &MongoDBConfig{
-			Host:         *host,
-			Port:         *port,
-			Username:     *username,
-			Password:     *password,
-			Database:     *database,
-			AuthDatabase: *mongoAuthDB,
-			Options:      *mongoOptions,
-			AllDatabases: *mongoAllDBs,
+		opts := &RestoreOptions{
+			InputPath:  *inputPath,
+			TargetDB:   *targetDB,
+			AssumeYes:  *assumeYes,
+			DecryptKey: key,
+		}
+		if err := driver.Restore(target, opts); err != nil {
+			fmt.Printf("%s restore failed: %v\n", driver.Name(), err)
+			os.Exit(1)
 		}
-		err := backupMongoDB(config, *outputDir)
+	case "list":
+		databases, err := driver.ListDatabases(target)
 		if err != nil {
-			fmt.Printf("MongoDB backup failed: %v\n", err)
+			fmt.Printf("%s list databases failed: %v\n", driver.Name(), err)
 			os.Exit(1)
 		}
-	default:
-		fmt.Printf("Error: unsupported database type '%s'\n", *dbType)
-		flag.Usage()
-		os.Exit(1)
+		for _, name := range databases {
+			fmt.Println(name)
+		}
+	}
+}
+
+// registerDriverFlags 为已注册驱动的引擎特定参数生成命令行参数
+func registerDriverFlags() {
+	for _, name := range driverNames() {
+		for _, opt := range drivers[name].Options() {
+			if opt.Bool {
+				def, _ := strconv.ParseBool(opt.Default)
+				flag.Bool(opt.Name, def, opt.Usage)
+			} else {
+				flag.String(opt.Name, opt.Default, opt.Usage)
+			}
+		}
+	}
+}
+
+// driverFlagValues 读取驱动的引擎特定参数值
+func driverFlagValues(d Driver) map[string]string {
+	values := map[string]string{}
+	for _, opt := range d.Options() {
+		values[opt.Name] = flag.Lookup(opt.Name).Value.String()
 	}
+	return values
 }
 
 // getFlagValue 获取参数值，支持简写和完整形式
@@ -187,13 +302,13 @@ func getFlagValue(short, long, defaultValue string) string {
 	if shortValue != "" {
 		return shortValue
 	}
-	
+
 	// 检查完整参数
 	longValue := getFlagValueByName(long)
 	if longValue != "" {
 		return longValue
 	}
-	
+
 	// 返回默认值
 	return defaultValue
 }
@@ -202,382 +317,46 @@ func getFlagValue(short, long, defaultValue string) string {
 func getFlagValueByName(name string) string {
 	found := false
 	value := ""
-	
+
 	flag.Visit(func(f *flag.Flag) {
 		if f.Name == name {
 			found = true
 			value = f.Value.String()
 		}
 	})
-	
+
 	if found {
 		return value
 	}
 	return ""
 }
 
-// backupMySQL 备份MySQL数据库，支持mysqldump和xtrabackup
-func backupMySQL(config *MySQLConfig, outputDir string) error {
-	fmt.Printf("Starting MySQL backup using %s...\n", config.BackupTool)
-	
-	switch config.BackupTool {
-	case "xtrabackup":
-		return backupMySQLWithXtraBackup(config, outputDir)
-	case "mysqldump":
-		return backupMySQLWithMysqldump(config, outputDir)
-	default:
-		// 默认使用mysqldump方式
-		return backupMySQLWithMysqldump(config, outputDir)
-	}
-}
-
-// backupMySQLWithXtraBackup 使用XtraBackup备份MySQL
-func backupMySQLWithXtraBackup(config *MySQLConfig, outputDir string) error {
-	fmt.Println("Starting MySQL backup with XtraBackup...")
-	
-	// 检查xtrabackup命令是否存在
-	_, err := exec.LookPath("xtrabackup")
-	if err != nil {
-		return fmt.Errorf("xtrabackup command not found. Please install Percona XtraBackup: %v", err)
-	}
-	
-	// 创建备份目录
-	backupDir := fmt.Sprintf("%s/xtrabackup_%s", outputDir, time.Now().Format("20060102_150405"))
-	if err := os.MkdirAll(backupDir, 0755); err != nil {
-		return fmt.Errorf("failed to create backup directory: %v", err)
-	}
-	
-	// 构建xtrabackup命令
-	cmdArgs := []string{
-		"--backup",
-		"--datadir=" + config.Datadir,
-		"--target-dir=" + backupDir,
-		"--host=" + config.Host,
-		"--port=" + config.Port,
-		"--user=" + config.Username,
-		"--password=" + config.Password,
-	}
-	
-	cmd := exec.Command("xtrabackup", cmdArgs...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	
-	// 创建不包含密码的日志参数用于显示
-	logArgs := make([]string, len(cmdArgs))
-	copy(logArgs, cmdArgs)
+// maskPasswordArgs 创建不包含密码的日志参数用于显示
+func maskPasswordArgs(args []string) []string {
+	logArgs := make([]string, len(args))
+	copy(logArgs, args)
 	for i, arg := range logArgs {
 		if strings.HasPrefix(arg, "--password=") {
 			logArgs[i] = "--password=***"
 		}
 	}
-	
-	fmt.Printf("Executing: xtrabackup with args %v\n", logArgs)
-	err = cmd.Run()
-	if err != nil {
-		return fmt.Errorf("xtrabackup failed: %v", err)
-	}
-	
-	fmt.Printf("MySQL backup with XtraBackup completed successfully: %s\n", backupDir)
-	return nil
-}
-
-// backupMySQLWithMysqldump 使用mysqldump备份MySQL
-func backupMySQLWithMysqldump(config *MySQLConfig, outputDir string) error {
-	fmt.Println("Starting MySQL backup with mysqldump...")
-	
-	// 检查mysqldump命令是否存在
-	_, err := exec.LookPath("mysqldump")
-	if err != nil {
-		return fmt.Errorf("mysqldump command not found. Please install MySQL client tools: %v", err)
-	}
-	
-	// 构建mysqldump命令
-	filename := fmt.Sprintf("%s/mysql_%s.sql", outputDir, time.Now().Format("20060102_150405"))
-	cmdArgs := []string{
-		"--host=" + config.Host,
-		"--port=" + config.Port,
-		"--user=" + config.Username,
-		"--password=" + config.Password,
-		"--single-transaction",
-		"--routines",
-		"--triggers",
-		"--no-tablespaces", // 添加此参数以避免需要PROCESS权限
-	}
-	
-	// 根据是否备份所有数据库添加相应参数
-	if config.AllDatabases {
-		cmdArgs = append(cmdArgs, "--all-databases") // 备份所有数据库
-	} else {
-		cmdArgs = append(cmdArgs, config.Database) // 备份指定数据库
-	}
-	
-	cmd := exec.Command("mysqldump", cmdArgs...)
-	outputFile, err := os.Create(filename)
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %v", err)
-	}
-	defer outputFile.Close()
-	
-	cmd.Stdout = outputFile
-	cmd.Stderr = os.Stderr
-	
-	// 创建不包含密码的日志参数用于显示
-	logArgs := make([]string, len(cmdArgs))
-	copy(logArgs, cmdArgs)
-	for i, arg := range logArgs {
-		if strings.HasPrefix(arg, "--password=") {
-			logArgs[i] = "--password=***"
-		}
-	}
-	
-	fmt.Printf("Executing: mysqldump with args %v\n", logArgs)
-	err = cmd.Run()
-	if err != nil {
-		return fmt.Errorf("mysqldump failed: %v", err)
-	}
-	
-	fmt.Printf("MySQL backup with mysqldump completed successfully: %s\n", filename)
-	return nil
-}
-
-// backupPostgreSQL 备份PostgreSQL数据库
-func backupPostgreSQL(config *PostgresConfig, outputDir string) error {
-	if config.AllDatabases {
-		return backupPostgreSQLAll(config, outputDir)
-	} else {
-		return backupPostgreSQLSingle(config, outputDir)
-	}
-}
-
-// backupPostgreSQLAll 使用pg_dumpall备份所有PostgreSQL数据库
-func backupPostgreSQLAll(config *PostgresConfig, outputDir string) error {
-	fmt.Println("Starting PostgreSQL backup of all databases...")
-	
-	// 检查pg_dumpall命令是否存在
-	_, err := exec.LookPath("pg_dumpall")
-	if err != nil {
-		return fmt.Errorf("pg_dumpall command not found. Please install PostgreSQL client tools: %v", err)
-	}
-	
-	// 设置环境变量
-	env := os.Environ()
-	env = append(env, fmt.Sprintf("PGHOST=%s", config.Host))
-	env = append(env, fmt.Sprintf("PGPORT=%s", config.Port))
-	env = append(env, fmt.Sprintf("PGUSER=%s", config.Username))
-	env = append(env, fmt.Sprintf("PGPASSWORD=%s", config.Password))
-	
-	// 构建pg_dumpall命令
-	filename := fmt.Sprintf("%s/postgresql_all_%s.sql", outputDir, time.Now().Format("20060102_150405"))
-	cmdArgs := []string{
-		"--verbose",
-		"--clean",
-		"--no-owner",
-		"--no-acl",
-	}
-	
-	cmd := exec.Command("pg_dumpall", cmdArgs...)
-	cmd.Env = env
-	
-	outputFile, err := os.Create(filename)
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %v", err)
-	}
-	defer outputFile.Close()
-	
-	cmd.Stdout = outputFile
-	cmd.Stderr = os.Stderr
-	
-	// 创建不包含密码的日志参数用于显示
-	logEnv := make([]string, len(env))
-	copy(logEnv, env)
-	for i, envVar := range logEnv {
-		if strings.HasPrefix(envVar, "PGPASSWORD=") {
-			logEnv[i] = "PGPASSWORD=***"
-		}
-	}
-	
-	fmt.Printf("Executing: pg_dumpall with args %v and env %v\n", cmdArgs, logEnv)
-	err = cmd.Run()
-	if err != nil {
-		return fmt.Errorf("pg_dumpall failed: %v", err)
-	}
-	
-	fmt.Printf("PostgreSQL backup of all databases completed successfully: %s\n", filename)
-	return nil
+	return logArgs
 }
 
-// backupPostgreSQLSingle 使用pg_dump备份单个PostgreSQL数据库
-func backupPostgreSQLSingle(config *PostgresConfig, outputDir string) error {
-	fmt.Printf("Starting PostgreSQL backup of database '%s'...\n", config.Database)
-	
-	// 检查pg_dump命令是否存在
-	_, err := exec.LookPath("pg_dump")
-	if err != nil {
-		return fmt.Errorf("pg_dump command not found. Please install PostgreSQL client tools: %v", err)
-	}
-	
-	// 设置环境变量
-	env := os.Environ()
-	env = append(env, fmt.Sprintf("PGHOST=%s", config.Host))
-	env = append(env, fmt.Sprintf("PGPORT=%s", config.Port))
-	env = append(env, fmt.Sprintf("PGUSER=%s", config.Username))
-	env = append(env, fmt.Sprintf("PGPASSWORD=%s", config.Password))
-	
-	// 构建pg_dump命令
-	filename := fmt.Sprintf("%s/postgresql_%s_%s.sql", outputDir, config.Database, time.Now().Format("20060102_150405"))
-	cmdArgs := []string{
-		"--verbose",
-		"--clean",
-		"--no-owner",
-		"--no-acl",
-		config.Database,
+// confirmRestore 打印恢复摘要并等待用户确认
+func confirmRestore(summary string, assumeYes bool) error {
+	fmt.Println(summary)
+	if assumeYes {
+		return nil
 	}
-	
-	cmd := exec.Command("pg_dump", cmdArgs...)
-	cmd.Env = env
-	
-	outputFile, err := os.Create(filename)
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %v", err)
-	}
-	defer outputFile.Close()
-	
-	cmd.Stdout = outputFile
-	cmd.Stderr = os.Stderr
-	
-	// 创建不包含密码的日志参数用于显示
-	logEnv := make([]string, len(env))
-	copy(logEnv, env)
-	for i, envVar := range logEnv {
-		if strings.HasPrefix(envVar, "PGPASSWORD=") {
-			logEnv[i] = "PGPASSWORD=***"
-		}
-	}
-	
-	fmt.Printf("Executing: pg_dump with args %v and env %v\n", cmdArgs, logEnv)
-	err = cmd.Run()
-	if err != nil {
-		return fmt.Errorf("pg_dump failed: %v", err)
-	}
-	
-	fmt.Printf("PostgreSQL backup of database '%s' completed successfully: %s\n", config.Database, filename)
-	return nil
-}
-
-// backupMongoDB 备份MongoDB数据库
-func backupMongoDB(config *MongoDBConfig, outputDir string) error {
-	if config.AllDatabases {
-		return backupMongoDBAll(config, outputDir)
-	} else {
-		return backupMongoDBSingle(config, outputDir)
-	}
-}
 
-// backupMongoDBAll 备份所有MongoDB数据库
-func backupMongoDBAll(config *MongoDBConfig, outputDir string) error {
-	fmt.Println("Starting MongoDB backup of all databases...")
-	
-	// 检查mongodump命令是否存在
-	_, err := exec.LookPath("mongodump")
-	if err != nil {
-		return fmt.Errorf("mongodump command not found. Please install MongoDB client tools: %v", err)
-	}
-	
-	// 构建mongodump命令（不指定--db参数以备份所有数据库）
-	filename := fmt.Sprintf("%s/mongodb_all_%s", outputDir, time.Now().Format("20060102_150405"))
-	cmdArgs := []string{
-		"--host=" + config.Host + ":" + config.Port,
-		"--username=" + config.Username,
-		"--password=" + config.Password,
-		"--out=" + filename,
+	fmt.Print("Existing data in the target will be overwritten. Type 'yes' to continue: ")
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return fmt.Errorf("failed to read confirmation: %v", err)
 	}
-	
-	// 添加认证数据库参数（如果没有指定则默认使用admin）
-	authDB := config.AuthDatabase
-	if authDB == "" {
-		authDB = "admin"
+	if strings.TrimSpace(answer) != "yes" {
+		return errors.New("restore aborted by user")
 	}
-	cmdArgs = append(cmdArgs, "--authenticationDatabase="+authDB)
-	
-	// 添加额外选项
-	if config.Options != "" {
-		cmdArgs = append(cmdArgs, strings.Split(config.Options, " ")...)
-	}
-	
-	cmd := exec.Command("mongodump", cmdArgs...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	
-	// 创建不包含密码的日志参数用于显示
-	logArgs := make([]string, len(cmdArgs))
-	copy(logArgs, cmdArgs)
-	for i, arg := range logArgs {
-		if strings.HasPrefix(arg, "--password=") {
-			logArgs[i] = "--password=***"
-		}
-	}
-	
-	fmt.Printf("Executing: mongodump with args %v\n", logArgs)
-	err = cmd.Run()
-	if err != nil {
-		return fmt.Errorf("mongodump failed: %v", err)
-	}
-	
-	fmt.Printf("MongoDB backup of all databases completed successfully: %s\n", filename)
 	return nil
 }
-
-// backupMongoDBSingle 备份单个MongoDB数据库
-func backupMongoDBSingle(config *MongoDBConfig, outputDir string) error {
-	fmt.Printf("Starting MongoDB backup of database '%s'...\n", config.Database)
-	
-	// 检查mongodump命令是否存在
-	_, err := exec.LookPath("mongodump")
-	if err != nil {
-		return fmt.Errorf("mongodump command not found. Please install MongoDB client tools: %v", err)
-	}
-	
-	// 构建mongodump命令
-	filename := fmt.Sprintf("%s/mongodb_%s_%s", outputDir, config.Database, time.Now().Format("20060102_150405"))
-	cmdArgs := []string{
-		"--host=" + config.Host + ":" + config.Port,
-		"--username=" + config.Username,
-		"--password=" + config.Password,
-		"--db=" + config.Database,
-		"--out=" + filename,
-	}
-	
-	// 添加认证数据库参数（如果没有指定则默认使用admin）
-	authDB := config.AuthDatabase
-	if authDB == "" {
-		authDB = "admin"
-	}
-	cmdArgs = append(cmdArgs, "--authenticationDatabase="+authDB)
-	
-	// 添加额外选项
-	if config.Options != "" {
-		cmdArgs = append(cmdArgs, strings.Split(config.Options, " ")...)
-	}
-	
-	cmd := exec.Command("mongodump", cmdArgs...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	
-	// 创建不包含密码的日志参数用于显示
-	logArgs := make([]string, len(cmdArgs))
-	copy(logArgs, cmdArgs)
-	for i, arg := range logArgs {
-		if strings.HasPrefix(arg, "--password=") {
-			logArgs[i] = "--password=***"
-		}
-	}
-	
-	fmt.Printf("Executing: mongodump with args %v\n", logArgs)
-	err = cmd.Run()
-	if err != nil {
-		return fmt.Errorf("mongodump failed: %v", err)
-	}
-	
-	fmt.Printf("MongoDB backup of database '%s' completed successfully: %s\n", config.Database, filename)
-	return nil
-}
\ No newline at end of file
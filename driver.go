@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Target 一次备份、恢复或列库操作的连接参数
+type Target struct {
+	Type     string // 引擎名称，对应已注册的Driver
+	Host     string
+	Port     string
+	Username string
+	Password string
+	Database string
+	Options  map[string]string // 引擎特定参数，键为DriverOption.Name
+	Output   OutputOptions     // 输出文件的压缩等处理
+}
+
+// Option 获取引擎特定参数
+func (t *Target) Option(name string) string {
+	return t.Options[name]
+}
+
+// BoolOption 获取布尔类型的引擎特定参数
+func (t *Target) BoolOption(name string) bool {
+	v, _ := strconv.ParseBool(t.Options[name])
+	return v
+}
+
+// DriverOption 引擎特定参数的定义，同时用于生成命令行参数
+type DriverOption struct {
+	Name    string // 参数名，例如 mysql-tool
+	Default string // 默认值
+	Usage   string // 帮助信息
+	Bool    bool   // 是否为布尔参数
+}
+
+// Driver 数据库引擎驱动
+type Driver interface {
+	// Name 引擎名称，即 -type 参数的取值
+	Name() string
+	// DefaultPort 默认端口
+	DefaultPort() string
+	// Options 引擎特定参数
+	Options() []DriverOption
+	// Validate 检查备份参数是否完整
+	Validate(t *Target) error
+	// Backup 备份到输出目录，只要已确定备份文件名，失败时也返回结果
+	Backup(t *Target, outputDir string) (*BackupResult, error)
+	// Restore 恢复本工具生成的备份
+	Restore(t *Target, opts *RestoreOptions) error
+	// ListDatabases 列出服务器上的数据库
+	ListDatabases(t *Target) ([]string, error)
+	// ServerVersion 查询服务器版本
+	ServerVersion(t *Target) (string, error)
+}
+
+// BackupResult 一次备份的产出
+type BackupResult struct {
+	Path       string   // 备份文件或目录
+	Tool       string   // 使用的备份工具
+	BackupType string   // 备份类型，例如 full
+	Databases  []string // 备份的数据库，备份所有数据库时为空
+	Compress   string   // 使用的压缩算法
+}
+
+// drivers 已注册的引擎驱动
+var drivers = map[string]Driver{}
+
+// RegisterDriver 注册引擎驱动，通常在驱动文件的init中调用
+func RegisterDriver(d Driver) {
+	if _, ok := drivers[d.Name()]; ok {
+		panic(fmt.Sprintf("driver %s registered twice", d.Name()))
+	}
+	drivers[d.Name()] = d
+}
+
+// lookupDriver 按名称查找引擎驱动
+func lookupDriver(name string) (Driver, error) {
+	d, ok := drivers[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported database type '%s', supported: %v", name, driverNames())
+	}
+	return d, nil
+}
+
+// driverNames 返回已注册的引擎名称（已排序）
+func driverNames() []string {
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyDriverDefaults 填充未设置的端口和引擎特定参数
+func applyDriverDefaults(d Driver, t *Target) {
+	if t.Port == "" {
+		t.Port = d.DefaultPort()
+	}
+	if t.Options == nil {
+		t.Options = map[string]string{}
+	}
+	for _, opt := range d.Options() {
+		if _, ok := t.Options[opt.Name]; !ok {
+			t.Options[opt.Name] = opt.Default
+		}
+	}
+}
+
+// splitLines 按行拆分命令输出并去掉空行
+func splitLines(out []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
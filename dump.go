@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/LYcoding0/dbbackup/internal/compress"
+	"github.com/LYcoding0/dbbackup/internal/crypt"
+)
+
+// backupTimestampPattern 匹配备份文件名中的时间戳及扩展名后缀
+var backupTimestampPattern = regexp.MustCompile(`_\d{8}_\d{6}(\.sql(\.gz|\.zst)?(\.enc)?)?$`)
+
+// OutputOptions 逻辑备份输出文件的处理方式
+type OutputOptions struct {
+	Compress      string     // none、gzip 或 zstd
+	CompressLevel int        // 压缩级别，0 表示默认
+	EncryptKey    *crypt.Key // 不为空时加密输出
+}
+
+// dumpExt 返回逻辑备份文件的扩展名，例如 .sql.gz.enc
+func (o OutputOptions) dumpExt() string {
+	return ".sql" + compress.Ext(o.Compress) + o.encryptExt()
+}
+
+// encryptExt 返回加密文件的扩展名，未加密时为空
+func (o OutputOptions) encryptExt() string {
+	if o.EncryptKey == nil {
+		return ""
+	}
+	return crypt.Ext
+}
+
+// runDumpToFile 执行导出命令，将其stdout依次压缩、加密后写入filename，明文不会落盘
+func runDumpToFile(cmd *exec.Cmd, filename string, opts OutputOptions) error {
+	outputFile, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	defer outputFile.Close()
+
+	var sink io.WriteCloser = nopCloser{outputFile}
+	if opts.EncryptKey != nil {
+		if sink, err = crypt.NewWriter(outputFile, opts.EncryptKey); err != nil {
+			return fmt.Errorf("failed to start encryption: %v", err)
+		}
+	}
+	writer, err := compress.NewWriter(sink, opts.Compress, opts.CompressLevel)
+	if err != nil {
+		return fmt.Errorf("failed to start %s compression: %v", opts.Compress, err)
+	}
+
+	cmd.Stdout = writer
+	if err := cmd.Run(); err != nil {
+		writer.Close()
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to finish %s compression: %v", opts.Compress, err)
+	}
+	if err := sink.Close(); err != nil {
+		return fmt.Errorf("failed to finish encryption: %v", err)
+	}
+	if err := outputFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync output file: %v", err)
+	}
+	return outputFile.Close()
+}
+
+// openEncrypted 打开备份文件，扩展名为.enc时使用key解密
+func openEncrypted(path string, key *crypt.Key) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup file: %v", err)
+	}
+	if !strings.HasSuffix(path, crypt.Ext) {
+		return file, nil
+	}
+	if key == nil {
+		file.Close()
+		return nil, fmt.Errorf("%s is encrypted, use -key-file to decrypt", path)
+	}
+	reader, err := crypt.NewReader(file, key)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &dumpReader{Reader: reader, closers: []io.Closer{file}}, nil
+}
+
+// openDump 打开逻辑备份文件，并根据扩展名自动解密、解压
+func openDump(path string, key *crypt.Key) (io.ReadCloser, error) {
+	file, err := openEncrypted(path, key)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := compress.NewReader(file, compress.Detect(strings.TrimSuffix(path, crypt.Ext)))
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open compressed backup: %v", err)
+	}
+	return &dumpReader{Reader: reader, closers: []io.Closer{reader, file}}, nil
+}
+
+// dumpReader 关闭时依次关闭解压流、解密流和底层文件
+type dumpReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *dumpReader) Close() error {
+	var err error
+	for _, c := range r.closers {
+		if closeErr := c.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// nopCloser 为io.Writer补充空的Close
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
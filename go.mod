@@ -0,0 +1,3 @@
+module github.com/LYcoding0/dbbackup
+
+go 1.21
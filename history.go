@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/LYcoding0/dbbackup/internal/history"
+	"github.com/LYcoding0/dbbackup/internal/manifest"
+)
+
+// finishJob 目标备份结束后发送通知、更新指标并追加运行记录
+func finishJob(cfg *JobsConfig, tc TargetConfig, res *jobResult) {
+	notifyJob(tc, res)
+	recordJob(cfg.Metrics, tc, res)
+	recordHistory(cfg.HistoryFile, tc, res)
+}
+
+// recordHistory 追加目标本次备份的记录，包括失败的备份，写入失败只输出警告
+func recordHistory(path string, tc TargetConfig, res *jobResult) {
+	if path == "" {
+		return
+	}
+	e := &history.Entry{
+		Tool:     "dbbackup",
+		Job:      tc.Name,
+		Type:     tc.Type,
+		Host:     tc.hostKey(),
+		Status:   history.StatusSuccess,
+		Start:    res.Start,
+		End:      res.Start.Add(res.Duration),
+		Seconds:  res.Duration.Seconds(),
+		Size:     res.Size,
+		Backups:  res.Backups,
+		Location: tc.OutputDir,
+	}
+	if tc.Storage.URL != "" {
+		e.Location = tc.Storage.URL + "/" + tc.Name
+	}
+	for _, m := range res.Manifests {
+		e.Manifests = append(e.Manifests, manifest.PathFor(tc.OutputDir, m.Name))
+	}
+	if res.Err != nil {
+		e.Status, e.Error = history.StatusFailure, res.Err.Error()
+	}
+	if err := history.Append(path, e); err != nil {
+		fmt.Printf("Warning: [%s] record history failed: %v\n", tc.Name, err)
+	}
+}
+
+// runHistory 按条件输出配置文件中目标的运行记录
+func runHistory(configPath string, f history.Filter, asJSON bool) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	cfg, err := loadJobsConfig(configPath)
+	if err != nil {
+		return err
+	}
+	if cfg.HistoryFile == "" {
+		return errors.New(`history is disabled (history_file is "-")`)
+	}
+	// 检查目标名，已从配置中删除的目标仍可查询
+	known := map[string]bool{}
+	for _, tc := range cfg.Targets {
+		known[tc.Name] = true
+	}
+	for _, name := range f.Jobs {
+		if !known[name] {
+			fmt.Fprintf(os.Stderr, "Warning: target %s is not in %s\n", name, configPath)
+		}
+	}
+	entries, skipped, err := history.Read(cfg.HistoryFile, f)
+	if err != nil {
+		return err
+	}
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: skipped %d unreadable line(s) in %s\n", skipped, cfg.HistoryFile)
+	}
+	return history.Print(os.Stdout, entries, asJSON)
+}
@@ -0,0 +1,186 @@
+// Package compress 对备份数据流做边写边压缩，避免未压缩的数据落盘。
+// gzip 使用标准库实现，zstd 通过管道调用系统中的 zstd 命令。
+package compress
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// 支持的压缩算法。
+const (
+	None = "none"
+	Gzip = "gzip"
+	Zstd = "zstd"
+)
+
+// Validate 检查压缩算法和级别，level 为 0 表示使用默认级别。
+func Validate(algo string, level int) error {
+	switch algo {
+	case "", None:
+		return nil
+	case Gzip:
+		if level < 0 || level > gzip.BestCompression {
+			return fmt.Errorf("gzip level must be 1-9, got %d", level)
+		}
+	case Zstd:
+		if level < 0 || level > 19 {
+			return fmt.Errorf("zstd level must be 1-19, got %d", level)
+		}
+		if _, err := exec.LookPath("zstd"); err != nil {
+			return fmt.Errorf("zstd not found in PATH: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported compression %q, use none, gzip or zstd", algo)
+	}
+	return nil
+}
+
+// Ext 返回压缩算法对应的文件扩展名。
+func Ext(algo string) string {
+	switch algo {
+	case Gzip:
+		return ".gz"
+	case Zstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// Detect 根据文件扩展名判断压缩算法。
+func Detect(path string) string {
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		return Gzip
+	case strings.HasSuffix(path, ".zst"):
+		return Zstd
+	}
+	return None
+}
+
+// TrimExt 去掉路径末尾的压缩扩展名。
+func TrimExt(path string) string {
+	return strings.TrimSuffix(path, Ext(Detect(path)))
+}
+
+// NewWriter 返回写入 w 的压缩流，调用方必须 Close 以刷新数据。
+// 关闭返回的 Writer 不会关闭 w。
+func NewWriter(w io.Writer, algo string, level int) (io.WriteCloser, error) {
+	switch algo {
+	case "", None:
+		return nopWriteCloser{w}, nil
+	case Gzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w, level)
+	case Zstd:
+		args := []string{"-q", "-c", "-T0"}
+		if level > 0 {
+			args = append(args, "-"+strconv.Itoa(level))
+		}
+		cmd := exec.Command("zstd", args...)
+		cmd.Stdout = w
+		return startWriter(cmd)
+	}
+	return nil, fmt.Errorf("unsupported compression %q", algo)
+}
+
+// NewReader 返回从 r 读取的解压流。
+func NewReader(r io.Reader, algo string) (io.ReadCloser, error) {
+	switch algo {
+	case "", None:
+		return io.NopCloser(r), nil
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zstd:
+		cmd := exec.Command("zstd", "-q", "-d", "-c")
+		cmd.Stdin = r
+		return startReader(cmd)
+	}
+	return nil, fmt.Errorf("unsupported compression %q", algo)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// cmdWriter 将写入的数据交给外部命令的 stdin。
+type cmdWriter struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+}
+
+func startWriter(cmd *exec.Cmd) (*cmdWriter, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", cmd.Path, err)
+	}
+	return &cmdWriter{cmd: cmd, stdin: stdin}, nil
+}
+
+func (c *cmdWriter) Write(p []byte) (int, error) {
+	return c.stdin.Write(p)
+}
+
+func (c *cmdWriter) Close() error {
+	closeErr := c.stdin.Close()
+	if err := c.cmd.Wait(); err != nil {
+		return fmt.Errorf("%s: %w", c.cmd.Path, err)
+	}
+	return closeErr
+}
+
+// cmdReader 读取外部命令的 stdout。
+type cmdReader struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+}
+
+func startReader(cmd *exec.Cmd) (*cmdReader, error) {
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", cmd.Path, err)
+	}
+	return &cmdReader{cmd: cmd, stdout: stdout}, nil
+}
+
+func (c *cmdReader) Read(p []byte) (int, error) {
+	if c.cmd == nil {
+		return 0, io.EOF
+	}
+	n, err := c.stdout.Read(p)
+	if err == io.EOF {
+		// 读到结尾时检查命令退出状态，损坏的数据不能当作正常结束
+		cmd := c.cmd
+		c.cmd = nil
+		if waitErr := cmd.Wait(); waitErr != nil {
+			return n, fmt.Errorf("%s: %w", cmd.Path, waitErr)
+		}
+	}
+	return n, err
+}
+
+func (c *cmdReader) Close() error {
+	if c.cmd == nil {
+		return nil
+	}
+	// 提前关闭时结束子进程，避免其阻塞在写 stdout 上
+	_ = c.stdout.Close()
+	_ = c.cmd.Process.Kill()
+	_ = c.cmd.Wait()
+	c.cmd = nil
+	return nil
+}
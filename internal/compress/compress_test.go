@@ -0,0 +1,132 @@
+package compress
+
+import (
+	"bytes"
+	"io"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	for _, tt := range []struct {
+		algo  string
+		level int
+		ok    bool
+	}{
+		{"", 0, true},
+		{None, 5, true},
+		{Gzip, 0, true},
+		{Gzip, 9, true},
+		{Gzip, 10, false},
+		{Gzip, -1, false},
+		{Zstd, 20, false},
+		{"bzip2", 0, false},
+	} {
+		if err := Validate(tt.algo, tt.level); (err == nil) != tt.ok {
+			t.Errorf("Validate(%q, %d) = %v, want ok=%v", tt.algo, tt.level, err, tt.ok)
+		}
+	}
+}
+
+func TestExt(t *testing.T) {
+	for _, tt := range []struct {
+		path, algo, trimmed string
+	}{
+		{"mysql_app_20240501_020000.sql.gz", Gzip, "mysql_app_20240501_020000.sql"},
+		{"mysql_full_20240501_020000.xbstream.zst", Zstd, "mysql_full_20240501_020000.xbstream"},
+		{"mysql_app_20240501_020000.sql", None, "mysql_app_20240501_020000.sql"},
+		{"backup.gz.enc", None, "backup.gz.enc"},
+	} {
+		if got := Detect(tt.path); got != tt.algo {
+			t.Errorf("Detect(%s) = %s, want %s", tt.path, got, tt.algo)
+		}
+		if got := TrimExt(tt.path); got != tt.trimmed {
+			t.Errorf("TrimExt(%s) = %s, want %s", tt.path, got, tt.trimmed)
+		}
+		if tt.algo != None && !strings.HasSuffix(tt.path, Ext(tt.algo)) {
+			t.Errorf("Ext(%s) = %s, want the suffix of %s", tt.algo, Ext(tt.algo), tt.path)
+		}
+	}
+	if Ext(None) != "" {
+		t.Errorf("Ext(none) = %q, want empty", Ext(None))
+	}
+}
+
+// roundTrip 压缩 data 再解压，返回压缩后的数据
+func roundTrip(t *testing.T, algo string, level int, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, algo, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	compressed := append([]byte{}, buf.Bytes()...)
+	r, err := NewReader(&buf, algo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("%s: %v", algo, err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("%s: round trip returned %d byte(s), want %d", algo, len(got), len(data))
+	}
+	return compressed
+}
+
+func TestRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("INSERT INTO t VALUES (1, 'backup');\n"), 10000)
+	if got := roundTrip(t, None, 0, data); !bytes.Equal(got, data) {
+		t.Error("none modified the data")
+	}
+	if got := roundTrip(t, Gzip, 9, data); len(got) >= len(data)/10 {
+		t.Errorf("gzip output is %d byte(s) for %d", len(got), len(data))
+	}
+	roundTrip(t, Gzip, 0, nil)
+
+	if _, err := NewWriter(io.Discard, "bzip2", 0); err == nil {
+		t.Error("NewWriter accepted bzip2")
+	}
+	if _, err := NewReader(strings.NewReader(""), Gzip); err == nil {
+		t.Error("NewReader accepted an empty gzip stream")
+	}
+}
+
+func TestZstd(t *testing.T) {
+	if _, err := exec.LookPath("zstd"); err != nil {
+		t.Skip("zstd not in PATH")
+	}
+	data := bytes.Repeat([]byte("INSERT INTO t VALUES (1, 'backup');\n"), 10000)
+	compressed := roundTrip(t, Zstd, 3, data)
+
+	// 截断的数据在读到结尾时报告 zstd 的退出错误，不能当作正常结束
+	r, err := NewReader(bytes.NewReader(compressed[:len(compressed)/2]), Zstd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(r); err == nil {
+		t.Error("reading truncated zstd data succeeded")
+	}
+	r.Close()
+
+	// 提前关闭不会阻塞
+	r, err = NewReader(bytes.NewReader(compressed), Zstd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Read(make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Error(err)
+	}
+}
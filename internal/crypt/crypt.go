@@ -0,0 +1,242 @@
+// Package crypt 对备份数据流做 AES-256-GCM 分块加密，数据在写盘或发送前即被加密。
+//
+// 文件格式：
+//
+//	magic "DBBKENC1" | 密钥 ID（8 字节）| nonce 前缀（7 字节）| 密文块...
+//
+// 明文按 64 KiB 分块，每块使用 nonce = 前缀 | 4 字节块序号 | 1 字节结尾标记 单独加密，
+// 最后一块的结尾标记为 1，因此块的重排、删除和截断都会导致解密失败。
+package crypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Ext 加密文件扩展名。
+const Ext = ".enc"
+
+// Algorithm 记录在清单中的算法名。
+const Algorithm = "aes-256-gcm"
+
+const (
+	magic       = "DBBKENC1"
+	keyIDSize   = 8
+	prefixSize  = 7
+	chunkSize   = 64 * 1024
+	headerSize  = len(magic) + keyIDSize + prefixSize
+	maxChunkNum = 1<<32 - 1
+)
+
+// Key AES-256 密钥。
+type Key struct {
+	raw []byte
+}
+
+// LoadKey 读取密钥文件，支持 32 字节原始数据、64 位十六进制或 base64 编码。
+// 可用 `openssl rand -out backup.key 32` 生成。
+func LoadKey(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key file: %w", err)
+	}
+	if len(data) == 32 {
+		return &Key{raw: data}, nil
+	}
+	text := strings.TrimSpace(string(data))
+	if raw, err := hex.DecodeString(text); err == nil && len(raw) == 32 {
+		return &Key{raw: raw}, nil
+	}
+	if raw, err := base64.StdEncoding.DecodeString(text); err == nil && len(raw) == 32 {
+		return &Key{raw: raw}, nil
+	}
+	return nil, fmt.Errorf("key file %s must contain 32 bytes (raw, hex or base64)", path)
+}
+
+func (k *Key) id() []byte {
+	sum := sha256.Sum256(k.raw)
+	return sum[:keyIDSize]
+}
+
+// Fingerprint 密钥指纹，可记录在清单中用于确认恢复时使用的密钥。
+func (k *Key) Fingerprint() string {
+	return "sha256:" + hex.EncodeToString(k.id())
+}
+
+func (k *Key) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(k.raw)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func nonce(prefix []byte, counter uint32, last bool) []byte {
+	n := make([]byte, 12)
+	copy(n, prefix)
+	binary.BigEndian.PutUint32(n[prefixSize:], counter)
+	if last {
+		n[11] = 1
+	}
+	return n
+}
+
+// Writer 加密写入器，必须 Close 才会写出最后一块。
+type Writer struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint32
+	buf     []byte
+	closed  bool
+}
+
+// NewWriter 返回写入 w 的加密流，关闭返回的 Writer 不会关闭 w。
+func NewWriter(w io.Writer, k *Key) (*Writer, error) {
+	aead, err := k.aead()
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, prefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	header := make([]byte, 0, headerSize)
+	header = append(header, magic...)
+	header = append(header, k.id()...)
+	header = append(header, prefix...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, aead: aead, prefix: prefix, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+func (c *Writer) Write(p []byte) (int, error) {
+	if c.closed {
+		return 0, errors.New("crypt: write to closed writer")
+	}
+	written := 0
+	for len(p) > 0 {
+		// 缓冲区已满且还有数据，说明当前块不是最后一块
+		if len(c.buf) == chunkSize {
+			if err := c.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(c.buf[len(c.buf):chunkSize], p)
+		c.buf = c.buf[:len(c.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (c *Writer) flush(last bool) error {
+	if c.counter == maxChunkNum {
+		return errors.New("crypt: stream too large")
+	}
+	sealed := c.aead.Seal(nil, nonce(c.prefix, c.counter, last), c.buf, nil)
+	c.counter++
+	c.buf = c.buf[:0]
+	_, err := c.w.Write(sealed)
+	return err
+}
+
+// Close 写出最后一块（可能为空）。
+func (c *Writer) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.flush(true)
+}
+
+// Reader 解密读取器。
+type Reader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint32
+	block   []byte
+	plain   []byte
+	done    bool
+}
+
+// NewReader 返回从 r 读取的解密流。密钥不匹配时立即返回错误。
+func NewReader(r io.Reader, k *Key) (*Reader, error) {
+	aead, err := k.aead()
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("crypt: read header: %w", err)
+	}
+	if string(header[:len(magic)]) != magic {
+		return nil, errors.New("crypt: not an encrypted backup")
+	}
+	if !bytes.Equal(header[len(magic):len(magic)+keyIDSize], k.id()) {
+		return nil, fmt.Errorf("crypt: backup was encrypted with a different key (expected sha256:%s)", hex.EncodeToString(header[len(magic):len(magic)+keyIDSize]))
+	}
+	return &Reader{
+		r:      bufio.NewReaderSize(r, chunkSize+aead.Overhead()+1),
+		aead:   aead,
+		prefix: append([]byte(nil), header[len(magic)+keyIDSize:]...),
+		block:  make([]byte, chunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (c *Reader) Read(p []byte) (int, error) {
+	for len(c.plain) == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		if err := c.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.plain)
+	c.plain = c.plain[n:]
+	return n, nil
+}
+
+func (c *Reader) next() error {
+	n, err := io.ReadFull(c.r, c.block)
+	last := false
+	switch {
+	case err == io.ErrUnexpectedEOF || err == io.EOF:
+		last = true
+	case err != nil:
+		return err
+	default:
+		// 整块读满时向后看一个字节判断是否已到结尾
+		if _, peekErr := c.r.Peek(1); peekErr == io.EOF {
+			last = true
+		} else if peekErr != nil {
+			return peekErr
+		}
+	}
+	plain, openErr := c.aead.Open(c.block[:0], nonce(c.prefix, c.counter, last), c.block[:n], nil)
+	if openErr != nil {
+		if last {
+			return errors.New("crypt: backup is truncated or corrupted")
+		}
+		return fmt.Errorf("crypt: chunk %d is corrupted", c.counter)
+	}
+	c.counter++
+	c.plain = plain
+	c.done = last
+	return nil
+}
@@ -0,0 +1,179 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sealedSize 加密后一个整块的长度
+const sealedSize = chunkSize + 16
+
+func testKey(t *testing.T) *Key {
+	t.Helper()
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		t.Fatal(err)
+	}
+	return &Key{raw: raw}
+}
+
+func encrypt(t *testing.T, k *Key, plain []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 分多次写入，覆盖跨块的写入
+	for p := plain; len(p) > 0; {
+		n := 1000
+		if n > len(p) {
+			n = len(p)
+		}
+		if _, err := w.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decrypt(k *Key, data []byte) ([]byte, error) {
+	r, err := NewReader(bytes.NewReader(data), k)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestRoundTrip(t *testing.T) {
+	k := testKey(t)
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 2 * chunkSize, 3*chunkSize + 5} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+		data := encrypt(t, k, plain)
+		// 最后一块带结尾标记，空数据也有一个空块
+		chunks := (size + chunkSize - 1) / chunkSize
+		if chunks == 0 {
+			chunks = 1
+		}
+		if want := headerSize + size + chunks*16; len(data) != want {
+			t.Errorf("size %d: ciphertext is %d bytes, want %d", size, len(data), want)
+		}
+		got, err := decrypt(k, data)
+		if err != nil {
+			t.Errorf("size %d: %v", size, err)
+			continue
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("size %d: decrypted data differs", size)
+		}
+	}
+}
+
+func TestTampering(t *testing.T) {
+	k := testKey(t)
+	plain := make([]byte, 3*chunkSize+100)
+	rand.Read(plain)
+	data := encrypt(t, k, plain)
+	chunk := func(i int) []byte {
+		start := headerSize + i*sealedSize
+		end := start + sealedSize
+		if end > len(data) {
+			end = len(data)
+		}
+		return data[start:end]
+	}
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+	header := data[:headerSize]
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{"header only", header},
+		{"truncated in last chunk", data[:len(data)-1]},
+		{"truncated at chunk boundary", data[:headerSize+3*sealedSize]},
+		{"truncated in middle chunk", data[:headerSize+sealedSize+100]},
+		{"last chunk dropped", join(header, chunk(0), chunk(1), chunk(2))},
+		{"middle chunk dropped", join(header, chunk(0), chunk(2), chunk(3))},
+		{"chunks swapped", join(header, chunk(1), chunk(0), chunk(2), chunk(3))},
+		{"chunk duplicated", join(header, chunk(0), chunk(0), chunk(1), chunk(2), chunk(3))},
+		{"data appended", join(data, []byte{0})},
+		{"byte flipped", func() []byte {
+			d := append([]byte(nil), data...)
+			d[headerSize+sealedSize+7] ^= 1
+			return d
+		}()},
+		{"nonce prefix changed", func() []byte {
+			d := append([]byte(nil), data...)
+			d[headerSize-1] ^= 1
+			return d
+		}()},
+	} {
+		got, err := decrypt(k, tt.data)
+		if err == nil {
+			t.Errorf("%s: decrypted %d bytes, want error", tt.name, len(got))
+		}
+	}
+}
+
+func TestWrongKey(t *testing.T) {
+	data := encrypt(t, testKey(t), []byte("backup"))
+	if _, err := NewReader(bytes.NewReader(data), testKey(t)); err == nil || !strings.Contains(err.Error(), "different key") {
+		t.Errorf("NewReader with wrong key error = %v, want different key", err)
+	}
+	// 头部的密钥 ID 被改成另一个密钥的，仍然无法解密
+	other := testKey(t)
+	forged := append([]byte(nil), data...)
+	copy(forged[len(magic):], other.id())
+	if got, err := decrypt(other, forged); err == nil {
+		t.Errorf("decrypted %q with a forged key id", got)
+	}
+	if _, err := NewReader(strings.NewReader("-- plain dump, not encrypted --"), testKey(t)); err == nil {
+		t.Error("NewReader accepted an unencrypted file")
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	raw := make([]byte, 32)
+	rand.Read(raw)
+	dir := t.TempDir()
+	for _, tt := range []struct {
+		name    string
+		content []byte
+		ok      bool
+	}{
+		{"raw", raw, true},
+		{"hex", []byte(hex.EncodeToString(raw) + "\n"), true},
+		{"base64", []byte(base64.StdEncoding.EncodeToString(raw) + "\n"), true},
+		{"short", raw[:16], false},
+		{"hex short", []byte(hex.EncodeToString(raw[:20])), false},
+		{"empty", nil, false},
+	} {
+		path := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(path, tt.content, 0600); err != nil {
+			t.Fatal(err)
+		}
+		k, err := LoadKey(path)
+		if tt.ok != (err == nil) {
+			t.Errorf("%s: LoadKey error = %v, want ok %v", tt.name, err, tt.ok)
+			continue
+		}
+		if tt.ok && !bytes.Equal(k.raw, raw) {
+			t.Errorf("%s: LoadKey returned a different key", tt.name)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Package history 以追加写入的 JSONL 文件记录每次备份的结果，每行一条，供 history 模式查询。
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/LYcoding0/dbbackup/internal/manifest"
+)
+
+// 备份结果状态。
+const (
+	StatusSuccess = "success"
+	StatusFailure = "failure"
+)
+
+// Entry 一次备份的记录。
+type Entry struct {
+	Tool      string    `json:"tool"`                // dbbackup 或 mysql_xtrabackup
+	Job       string    `json:"job"`                 // 目标名或备份前缀
+	Type      string    `json:"type,omitempty"`      // 引擎或备份类型
+	Host      string    `json:"host,omitempty"`      // 数据库地址
+	Status    string    `json:"status"`              // success 或 failure
+	Start     time.Time `json:"start"`               // 开始时间
+	End       time.Time `json:"end"`                 // 结束时间
+	Seconds   float64   `json:"duration_seconds"`    // 耗时（秒）
+	Size      int64     `json:"size,omitempty"`      // 备份大小（字节）
+	Backups   []string  `json:"backups,omitempty"`   // 生成的备份名
+	Location  string    `json:"location,omitempty"`  // 备份目录、归档或存储中的位置
+	Manifests []string  `json:"manifests,omitempty"` // 清单文件
+	Log       string    `json:"log,omitempty"`       // 日志文件
+	Error     string    `json:"error,omitempty"`     // 失败原因
+	Warnings  []string  `json:"warnings,omitempty"`  // 不影响结果的问题
+}
+
+// appendMu 同一进程中的多个任务可能同时写入
+var appendMu sync.Mutex
+
+// Append 在 path 末尾追加一条记录。每条记录一次 write，多个进程同时追加也不会交错。
+func Append(path string, e *Entry) error {
+	if e.Seconds == 0 && !e.Start.IsZero() {
+		e.Seconds = e.End.Sub(e.Start).Seconds()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	appendMu.Lock()
+	defer appendMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	// 上次写入中断留下的半行没有换行，另起一行，不影响本条记录
+	if st, err := f.Stat(); err == nil && st.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, st.Size()-1); err == nil && last[0] != '\n' {
+			data = append([]byte{'\n'}, data...)
+		}
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Filter 查询条件，零值表示不限制。
+type Filter struct {
+	Jobs   []string
+	Type   string
+	Status string    // success 或 failure
+	Since  time.Time // 开始时间不早于 Since
+	Until  time.Time // 开始时间早于 Until
+	Limit  int       // 只返回最近的 Limit 条
+}
+
+// Validate 检查查询条件。
+func (f Filter) Validate() error {
+	switch f.Status {
+	case "", StatusSuccess, StatusFailure:
+	default:
+		return fmt.Errorf("unknown status %q, want %s or %s", f.Status, StatusSuccess, StatusFailure)
+	}
+	if !f.Since.IsZero() && !f.Until.IsZero() && !f.Since.Before(f.Until) {
+		return fmt.Errorf("since %s is not before until %s", f.Since.Format(time.RFC3339), f.Until.Format(time.RFC3339))
+	}
+	if f.Limit < 0 {
+		return fmt.Errorf("limit %d is negative", f.Limit)
+	}
+	return nil
+}
+
+func (f Filter) match(e *Entry) bool {
+	if len(f.Jobs) > 0 {
+		found := false
+		for _, j := range f.Jobs {
+			found = found || j == e.Job
+		}
+		if !found {
+			return false
+		}
+	}
+	switch {
+	case f.Type != "" && f.Type != e.Type,
+		f.Status != "" && f.Status != e.Status,
+		!f.Since.IsZero() && e.Start.Before(f.Since),
+		!f.Until.IsZero() && !e.Start.Before(f.Until):
+		return false
+	}
+	return true
+}
+
+// Read 按写入顺序返回满足条件的记录，文件不存在时返回空。
+// 无法解析的行（例如写入时断电留下的半行）被跳过，skipped 为跳过的行数。
+func Read(path string, f Filter) (entries []*Entry, skipped int, err error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+	sc := bufio.NewScanner(file)
+	sc.Buffer(make([]byte, 64<<10), 16<<20)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		var e Entry
+		if json.Unmarshal([]byte(line), &e) != nil {
+			skipped++
+			continue
+		}
+		if f.match(&e) {
+			entries = append(entries, &e)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, skipped, err
+	}
+	if f.Limit > 0 && len(entries) > f.Limit {
+		entries = entries[len(entries)-f.Limit:]
+	}
+	return entries, skipped, nil
+}
+
+// ParseTime 解析 2006-01-02、2006-01-02 15:04 或 RFC3339 格式的时间，前两种为本地时间。
+// end 为 true 时只有日期的时间取次日零点，用于包含当天的结束时间。
+func ParseTime(s string, end bool) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, want 2006-01-02, 2006-01-02 15:04 or RFC3339", s)
+}
+
+// Print 以表格输出记录；asJSON 为 true 时每行输出一条 JSON，便于用 jq 处理。
+func Print(w io.Writer, entries []*Entry, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "START\tJOB\tTYPE\tSTATUS\tDURATION\tSIZE\tDETAIL")
+	for _, e := range entries {
+		detail := strings.Join(e.Backups, ", ")
+		if e.Error != "" {
+			detail = e.Error
+		}
+		if len(e.Warnings) > 0 {
+			detail += fmt.Sprintf(" (%d warning(s))", len(e.Warnings))
+		}
+		size := "-"
+		if e.Size > 0 {
+			size = manifest.FormatSize(e.Size)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.Start.Local().Format("2006-01-02 15:04:05"), e.Job, e.Type, e.Status,
+			time.Duration(e.Seconds*float64(time.Second)).Round(time.Second), size, detail)
+	}
+	return tw.Flush()
+}
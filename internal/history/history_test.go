@@ -0,0 +1,176 @@
+package history
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testEntry(job, status string, start time.Time) *Entry {
+	return &Entry{Tool: "dbbackup", Job: job, Type: "mysql", Status: status, Start: start, End: start.Add(90 * time.Second)}
+}
+
+func jobs(entries []*Entry) string {
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Job+"@"+e.Start.Format("15:04"))
+	}
+	return strings.Join(names, " ")
+}
+
+func TestAppendRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log", "history.jsonl")
+	base := time.Date(2024, 5, 1, 2, 0, 0, 0, time.Local)
+	for i, e := range []*Entry{
+		testEntry("app", StatusSuccess, base),
+		testEntry("crm", StatusFailure, base.Add(time.Hour)),
+		testEntry("app", StatusFailure, base.Add(24*time.Hour)),
+		testEntry("app", StatusSuccess, base.Add(25*time.Hour)),
+	} {
+		if i == 1 {
+			e.Type = "postgres"
+		}
+		if err := Append(path, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all, skipped, err := Read(path, Filter{})
+	if err != nil || skipped != 0 {
+		t.Fatalf("Read: %v, %d skipped", err, skipped)
+	}
+	if got := jobs(all); got != "app@02:00 crm@03:00 app@02:00 app@03:00" {
+		t.Errorf("entries = %s", got)
+	}
+	if all[0].Seconds != 90 {
+		t.Errorf("duration = %vs, want 90s computed from start and end", all[0].Seconds)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		filter Filter
+		want   string
+	}{
+		{"job", Filter{Jobs: []string{"crm"}}, "crm@03:00"},
+		{"jobs", Filter{Jobs: []string{"crm", "app"}, Limit: 2}, "app@02:00 app@03:00"},
+		{"type", Filter{Type: "postgres"}, "crm@03:00"},
+		{"status", Filter{Status: StatusFailure}, "crm@03:00 app@02:00"},
+		{"since", Filter{Since: base.Add(24 * time.Hour)}, "app@02:00 app@03:00"},
+		{"until", Filter{Until: base.Add(time.Hour)}, "app@02:00"},
+		{"limit", Filter{Limit: 1}, "app@03:00"},
+		{"limit larger than result", Filter{Status: StatusSuccess, Limit: 5}, "app@02:00 app@03:00"},
+		{"no match", Filter{Jobs: []string{"mongo"}}, ""},
+	} {
+		got, _, err := Read(path, tt.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if jobs(got) != tt.want {
+			t.Errorf("%s: entries = %q, want %q", tt.name, jobs(got), tt.want)
+		}
+	}
+
+	// 文件不存在时没有记录
+	if got, _, err := Read(filepath.Join(t.TempDir(), "missing.jsonl"), Filter{}); err != nil || got != nil {
+		t.Errorf("Read of a missing file = %v, %v", got, err)
+	}
+}
+
+func TestTornLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	base := time.Date(2024, 5, 1, 2, 0, 0, 0, time.Local)
+	if err := Append(path, testEntry("app", StatusSuccess, base)); err != nil {
+		t.Fatal(err)
+	}
+	// 写入中断留下没有换行的半行
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprint(f, `{"tool":"dbbackup","job":"crm","sta`)
+	f.Close()
+	if err := Append(path, testEntry("app", StatusFailure, base.Add(time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, skipped, err := Read(path, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skipped != 1 {
+		t.Errorf("skipped = %d, want 1", skipped)
+	}
+	if got := jobs(entries); got != "app@02:00 app@03:00" {
+		t.Errorf("entries = %s, want both complete records", got)
+	}
+}
+
+func TestFilterValidate(t *testing.T) {
+	now := time.Now()
+	for _, tt := range []struct {
+		filter Filter
+		ok     bool
+	}{
+		{Filter{}, true},
+		{Filter{Status: StatusFailure, Since: now.Add(-time.Hour), Until: now, Limit: 10}, true},
+		{Filter{Status: "failed"}, false},
+		{Filter{Since: now, Until: now}, false},
+		{Filter{Limit: -1}, false},
+	} {
+		if err := tt.filter.Validate(); (err == nil) != tt.ok {
+			t.Errorf("Validate(%+v) = %v, want ok=%v", tt.filter, err, tt.ok)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)
+	for _, tt := range []struct {
+		in   string
+		end  bool
+		want time.Time
+	}{
+		{"2024-05-01", false, day},
+		{"2024-05-01", true, day.AddDate(0, 0, 1)},
+		{"2024-05-01 15:04", true, day.Add(15*time.Hour + 4*time.Minute)},
+		{"2024-05-01T15:04", false, day.Add(15*time.Hour + 4*time.Minute)},
+		{"2024-05-01T15:04:05Z", false, time.Date(2024, 5, 1, 15, 4, 5, 0, time.UTC)},
+	} {
+		got, err := ParseTime(tt.in, tt.end)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("ParseTime(%q, %v) = %v, %v, want %v", tt.in, tt.end, got, err, tt.want)
+		}
+	}
+	if _, err := ParseTime("yesterday", false); err == nil {
+		t.Error("ParseTime(yesterday) succeeded")
+	}
+}
+
+func TestPrint(t *testing.T) {
+	e := testEntry("app", StatusFailure, time.Date(2024, 5, 1, 2, 0, 0, 0, time.Local))
+	e.Seconds, e.Error, e.Warnings = 90, "mysqldump: exit status 2", []string{"upload failed"}
+	var buf bytes.Buffer
+	if err := Print(&buf, []*Entry{e}, false); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "START") {
+		t.Fatalf("table = %q", buf.String())
+	}
+	for _, want := range []string{"2024-05-01 02:00:00", "app", "failure", "1m30s", "mysqldump: exit status 2 (1 warning(s))"} {
+		if !strings.Contains(lines[1], want) {
+			t.Errorf("row %q missing %q", lines[1], want)
+		}
+	}
+	buf.Reset()
+	if err := Print(&buf, []*Entry{e}, true); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), `{"tool":"dbbackup","job":"app"`) || strings.Count(buf.String(), "\n") != 1 {
+		t.Errorf("json = %q", buf.String())
+	}
+}
@@ -0,0 +1,212 @@
+// Package manifest 描述一次备份的元数据（引擎、版本、时间、文件校验和等），
+// 以 JSON 形式写在备份旁边，供保留、校验和恢复等后续流程使用。
+package manifest
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Suffix 清单文件后缀，清单路径为 <dir>/<name><Suffix>。
+const Suffix = ".manifest.json"
+
+// 备份状态。
+const (
+	StatusSuccess = "success"
+	StatusFailed  = "failed"
+)
+
+// File 备份产生的单个文件。
+type File struct {
+	Path   string `json:"path"` // 相对于清单所在目录，使用 / 分隔
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Encryption 备份的加密信息，不包含密钥本身。
+type Encryption struct {
+	Algorithm      string `json:"algorithm"`
+	KeyFingerprint string `json:"key_fingerprint"`
+}
+
+// Manifest 一次备份的元数据。
+type Manifest struct {
+	Version       int         `json:"version"`
+	Name          string      `json:"name"`           // 备份名，例如 mysql_full_20240101_020000
+	Engine        string      `json:"engine"`         // mysql / postgresql / mongodb
+	Host          string      `json:"host"`           // host:port 或 socket
+	Databases     []string    `json:"databases"`      // 备份包含的数据库
+	Tool          string      `json:"tool"`           // mysqldump / xtrabackup / pg_dump ...
+	ToolVersion   string      `json:"tool_version"`   // 备份工具版本
+	ServerVersion string      `json:"server_version"` // 数据库服务器版本
+	BackupType    string      `json:"backup_type"`    // full / incr
+	Parent        string      `json:"parent,omitempty"`
+	Compression   string      `json:"compression,omitempty"` // gzip / zstd / xtrabackup
+	Encryption    *Encryption `json:"encryption,omitempty"`
+	StartTime     time.Time   `json:"start_time"`
+	EndTime       time.Time   `json:"end_time"`
+	Status        string      `json:"status"` // success / failed
+	Error         string      `json:"error,omitempty"`
+	Size          int64       `json:"size"` // 所有文件大小之和
+	Files         []File      `json:"files"`
+}
+
+// New 创建一个开始时间为当前时间的清单。
+func New(name string) *Manifest {
+	return &Manifest{
+		Version:   1,
+		Name:      name,
+		StartTime: time.Now(),
+	}
+}
+
+// PathFor 返回 dir 下备份 name 的清单路径。
+func PathFor(dir, name string) string {
+	return filepath.Join(dir, name+Suffix)
+}
+
+// AddPath 计算 path（文件或目录）下所有文件的 SHA-256 并记入清单，
+// 记录的路径相对于 baseDir（即清单所在目录）。
+func (m *Manifest) AddPath(baseDir, path string) error {
+	return filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		sum, size, err := HashFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(baseDir, p)
+		if err != nil {
+			return err
+		}
+		m.Files = append(m.Files, File{Path: filepath.ToSlash(rel), Size: size, SHA256: sum})
+		m.Size += size
+		return nil
+	})
+}
+
+// Finish 记录结束时间和最终状态。
+func (m *Manifest) Finish(err error) {
+	m.EndTime = time.Now()
+	if err != nil {
+		m.Status = StatusFailed
+		m.Error = err.Error()
+		return
+	}
+	m.Status = StatusSuccess
+}
+
+// Duration 备份耗时。
+func (m *Manifest) Duration() time.Duration {
+	return m.EndTime.Sub(m.StartTime)
+}
+
+// Write 原子地写入清单文件。
+func Write(path string, m *Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	return nil
+}
+
+// Read 读取清单文件。
+func Read(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parse manifest %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// HashFile 计算文件的 SHA-256 和大小。
+func HashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, bufio.NewReaderSize(f, 1<<20))
+	if err != nil {
+		return "", 0, fmt.Errorf("hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// Check 按清单校验 dir 下文件的大小和 SHA-256，top 不为空时只校验该文件或目录下的文件，
+// 返回校验的文件数。
+func (m *Manifest) Check(dir, top string) (int, error) {
+	checked := 0
+	for _, f := range m.Files {
+		if top != "" && f.Path != top && !strings.HasPrefix(f.Path, top+"/") {
+			continue
+		}
+		sum, size, err := HashFile(filepath.Join(dir, filepath.FromSlash(f.Path)))
+		if err != nil {
+			return checked, err
+		}
+		if size != f.Size {
+			return checked, fmt.Errorf("%s: size %d, manifest says %d", f.Path, size, f.Size)
+		}
+		if sum != f.SHA256 {
+			return checked, fmt.Errorf("%s: sha256 %s, manifest says %s", f.Path, sum, f.SHA256)
+		}
+		checked++
+	}
+	return checked, nil
+}
+
+// FormatSize 以 KB、MB、GB 等（1024 进制）显示字节数，供日志、通知和历史记录使用。
+func FormatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// ToolVersion 执行 `<bin> --version` 并返回包含版本号的那一行，失败时返回空字符串。
+// 部分工具（如 xtrabackup）把版本打印到 stderr 且前面带有参数提示，因此合并两路输出后查找。
+func ToolVersion(bin string) string {
+	out, err := exec.Command(bin, "--version").CombinedOutput()
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	for _, line := range lines {
+		if strings.Contains(strings.ToLower(line), "version") {
+			return strings.TrimSpace(line)
+		}
+	}
+	return strings.TrimSpace(lines[0])
+}
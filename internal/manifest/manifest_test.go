@@ -0,0 +1,127 @@
+package manifest
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAddPathCheck(t *testing.T) {
+	dir := t.TempDir()
+	backup := filepath.Join(dir, "mysql_full_20240501_020000")
+	if err := os.MkdirAll(filepath.Join(backup, "app"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"mysql_full_20240501_020000/ibdata1":    "innodb data",
+		"mysql_full_20240501_020000/app/t.ibd":  "table",
+		"mysql_app_20240501_020000.sql.gz":      "dump",
+		"mysql_app_20240501_030000.sql.gz":      "other dump",
+		"mysql_full_20240501_020000.extra.json": "{}",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := New("mysql_full_20240501_020000")
+	if err := m.AddPath(dir, backup); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddPath(dir, filepath.Join(dir, "mysql_app_20240501_020000.sql.gz")); err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, f := range m.Files {
+		paths = append(paths, f.Path)
+	}
+	want := "mysql_full_20240501_020000/app/t.ibd mysql_full_20240501_020000/ibdata1 mysql_app_20240501_020000.sql.gz"
+	if strings.Join(paths, " ") != want {
+		t.Errorf("files = %v, want %s", paths, want)
+	}
+	if m.Size != int64(len("innodb data")+len("table")+len("dump")) {
+		t.Errorf("size = %d", m.Size)
+	}
+	// sha256("dump")
+	if sum := m.Files[2].SHA256; sum != "b6ca0868bca6a2926b70aa1a71592038d9030fe26d4214edcfbd6cf41f2f4654" {
+		t.Errorf("sha256 = %s", sum)
+	}
+
+	if n, err := m.Check(dir, ""); n != 3 || err != nil {
+		t.Errorf("Check all = %d, %v, want 3 files", n, err)
+	}
+	// top 只匹配完整的路径段，mysql_full_20240501_020000.extra.json 不属于该目录
+	if n, err := m.Check(dir, "mysql_full_20240501_020000"); n != 2 || err != nil {
+		t.Errorf("Check directory = %d, %v, want 2 files", n, err)
+	}
+
+	// 大小不变的改动按 SHA-256 发现，截断按大小发现，缺少的文件报告不存在
+	os.WriteFile(filepath.Join(backup, "ibdata1"), []byte("innodb date"), 0644)
+	if _, err := m.Check(dir, ""); err == nil || !strings.Contains(err.Error(), "ibdata1: sha256") {
+		t.Errorf("Check of a modified file = %v", err)
+	}
+	os.WriteFile(filepath.Join(backup, "ibdata1"), []byte("innodb"), 0644)
+	if _, err := m.Check(dir, "mysql_full_20240501_020000"); err == nil || !strings.Contains(err.Error(), "ibdata1: size 6, manifest says 11") {
+		t.Errorf("Check of a truncated file = %v", err)
+	}
+	if n, err := m.Check(dir, "mysql_app_20240501_020000.sql.gz"); n != 1 || err != nil {
+		t.Errorf("Check of an intact file = %d, %v", n, err)
+	}
+	os.Remove(filepath.Join(dir, "mysql_app_20240501_020000.sql.gz"))
+	if _, err := m.Check(dir, "mysql_app_20240501_020000.sql.gz"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Check of a missing file = %v, want not exist", err)
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	dir := t.TempDir()
+	m := New("pg_app_20240501_020000")
+	m.Engine, m.Tool, m.Databases = "postgresql", "pg_dump", []string{"app"}
+	m.Encryption = &Encryption{Algorithm: "AES-256-GCM", KeyFingerprint: "ab12"}
+	m.Files = []File{{Path: "pg_app_20240501_020000.sql.gz", Size: 4, SHA256: "00"}}
+	m.Finish(errors.New("pg_dump: exit status 1"))
+	path := PathFor(dir, m.Name)
+	if filepath.Base(path) != "pg_app_20240501_020000.manifest.json" {
+		t.Errorf("PathFor = %s", path)
+	}
+	if err := Write(path, m); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Error("temporary file left after Write")
+	}
+	got, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != StatusFailed || got.Error != "pg_dump: exit status 1" || got.Encryption.KeyFingerprint != "ab12" ||
+		len(got.Files) != 1 || got.Files[0] != m.Files[0] || !got.EndTime.Equal(m.EndTime) || got.Duration() < 0 {
+		t.Errorf("read back %+v", got)
+	}
+
+	os.WriteFile(path, []byte("{truncated"), 0644)
+	if _, err := Read(path); err == nil || !strings.Contains(err.Error(), "parse manifest") {
+		t.Errorf("Read of a corrupt manifest = %v", err)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for _, tt := range []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KB"},
+		{1536, "1.5 KB"},
+		{5 << 20, "5.0 MB"},
+		{3<<30 + 300<<20, "3.3 GB"},
+		{2 << 40, "2.0 TB"},
+	} {
+		if got := FormatSize(tt.n); got != tt.want {
+			t.Errorf("FormatSize(%d) = %s, want %s", tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+//go:build !unix
+
+package metrics
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// staleLock 超过这个时间的锁文件认为是崩溃的进程留下的
+const staleLock = time.Minute
+
+// lockFile 没有 flock 的平台上以独占创建 path 作为锁，解锁时删除。
+func lockFile(path string) (unlock func(), err error) {
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) > staleLock {
+			os.Remove(path)
+			continue
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
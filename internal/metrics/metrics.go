@@ -0,0 +1,266 @@
+// Package metrics 记录每次备份的结果，以 Prometheus 文本格式写入 node_exporter 的
+// textfile collector 文件，daemon 模式下同时在 /metrics 提供。
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config 指标的输出位置，两个程序的配置文件中使用相同的字段。
+type Config struct {
+	Textfile string `json:"textfile"` // textfile collector 目录中的 .prom 文件，为空不写
+	Listen   string `json:"listen"`   // daemon 模式下提供 /metrics 的地址，例如 :9108，为空不监听
+}
+
+// Validate 检查配置。
+func (c Config) Validate() error {
+	if c.Textfile != "" && !strings.HasSuffix(c.Textfile, ".prom") {
+		return fmt.Errorf("textfile %s: node_exporter only reads *.prom files", c.Textfile)
+	}
+	if c.Listen != "" {
+		if _, _, err := net.SplitHostPort(c.Listen); err != nil {
+			return fmt.Errorf("listen: %w", err)
+		}
+	}
+	return nil
+}
+
+// Run 一次备份的结果。
+type Run struct {
+	Tool     string // dbbackup 或 mysql_xtrabackup
+	Job      string // 目标名或备份前缀
+	Type     string // 引擎或备份类型
+	Success  bool
+	Time     time.Time // 结束时间
+	Duration time.Duration
+	Size     int64 // 备份大小，失败时不更新
+}
+
+// 指标按此顺序输出。
+var defs = []struct {
+	name, typ, help string
+}{
+	{"dbbackup_last_run_timestamp_seconds", "gauge", "Unix time of the last backup run."},
+	{"dbbackup_last_success_timestamp_seconds", "gauge", "Unix time of the last successful backup."},
+	{"dbbackup_last_status", "gauge", "Result of the last backup run, 1 for success and 0 for failure."},
+	{"dbbackup_last_duration_seconds", "gauge", "Duration of the last backup run in seconds."},
+	{"dbbackup_last_size_bytes", "gauge", "Size of the last successful backup in bytes."},
+	{"dbbackup_runs_total", "counter", "Number of backup runs."},
+	{"dbbackup_failures_total", "counter", "Number of failed backup runs."},
+}
+
+// Registry 各指标的值，按指标名和标签保存。
+type Registry struct {
+	mu     sync.Mutex
+	series map[string]map[string]float64 // 指标名 -> 标签 -> 值
+}
+
+// New 创建空的 Registry。
+func New() *Registry {
+	return &Registry{series: map[string]map[string]float64{}}
+}
+
+// Load 读取之前写入的 textfile，计数器和时间戳在多次运行间累积；path 为空或文件不存在时返回空的 Registry。
+func Load(path string) (*Registry, error) {
+	r := New()
+	if path == "" {
+		return r, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	} else if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, d := range defs {
+		known[d.name] = true
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// 格式为 name{labels} value，只会读到本包写入的行
+		open, end := strings.IndexByte(line, '{'), strings.LastIndexByte(line, '}')
+		if open < 0 || end < open || !known[line[:open]] {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(line[end+1:]), 64)
+		if err != nil {
+			continue
+		}
+		r.set(line[:open], line[open+1:end], v)
+	}
+	return r, sc.Err()
+}
+
+func (r *Registry) set(name, labels string, v float64) {
+	if r.series[name] == nil {
+		r.series[name] = map[string]float64{}
+	}
+	r.series[name][labels] = v
+}
+
+func (r *Registry) add(name, labels string, v float64) {
+	r.set(name, labels, r.series[name][labels]+v)
+}
+
+// Record 记录一次备份。失败时也会创建失败计数，便于用 increase() 告警。
+func (r *Registry) Record(run Run) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if run.Time.IsZero() {
+		run.Time = time.Now()
+	}
+	l := labels(run)
+	ts := float64(run.Time.UnixMilli()) / 1000
+	r.set("dbbackup_last_run_timestamp_seconds", l, ts)
+	r.set("dbbackup_last_duration_seconds", l, run.Duration.Seconds())
+	r.add("dbbackup_runs_total", l, 1)
+	if run.Success {
+		r.set("dbbackup_last_success_timestamp_seconds", l, ts)
+		r.set("dbbackup_last_status", l, 1)
+		r.set("dbbackup_last_size_bytes", l, float64(run.Size))
+		r.add("dbbackup_failures_total", l, 0)
+	} else {
+		r.set("dbbackup_last_status", l, 0)
+		r.add("dbbackup_failures_total", l, 1)
+	}
+}
+
+// labels 生成 tool、job、type 标签。
+func labels(run Run) string {
+	esc := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return fmt.Sprintf(`tool="%s",job="%s",type="%s"`, esc.Replace(run.Tool), esc.Replace(run.Job), esc.Replace(run.Type))
+}
+
+// WriteTo 以 Prometheus 文本格式输出所有指标。
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var buf bytes.Buffer
+	for _, d := range defs {
+		series := r.series[d.name]
+		if len(series) == 0 {
+			continue
+		}
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n", d.name, d.help, d.name, d.typ)
+		keys := make([]string, 0, len(series))
+		for k := range series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&buf, "%s{%s} %s\n", d.name, k, strconv.FormatFloat(series[k], 'f', -1, 64))
+		}
+	}
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+// Save 写入 textfile，先写临时文件再改名，node_exporter 不会读到写了一半的文件。
+func (r *Registry) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// 每次使用不同的临时文件，不以 .prom 结尾，不会被 node_exporter 读取
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	// CreateTemp 创建的文件只有属主可读，node_exporter 通常以其他用户运行
+	err = f.Chmod(0644)
+	if err == nil {
+		_, err = r.WriteTo(f)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// fileMu 同一进程中的多个任务可能同时更新 textfile
+var fileMu sync.Mutex
+
+// Update 记录一次备份并写入 textfile。r 为 nil 时（非 daemon 模式）先从 textfile 读取之前的值；
+// textfile 为空时只记录到 r。读取到写入期间锁定 textfile 旁的 .lock 文件，
+// 同时运行的多个进程（例如 cron 中的不同任务）不会丢失彼此的计数。
+func Update(r *Registry, textfile string, run Run) error {
+	if r == nil && textfile == "" {
+		return nil
+	}
+	fileMu.Lock()
+	defer fileMu.Unlock()
+	if textfile != "" {
+		if err := os.MkdirAll(filepath.Dir(textfile), 0755); err != nil {
+			return err
+		}
+		unlock, err := lockFile(textfile + ".lock")
+		if err != nil {
+			return fmt.Errorf("lock %s: %w", textfile, err)
+		}
+		defer unlock()
+	}
+	if r == nil {
+		var err error
+		if r, err = Load(textfile); err != nil {
+			return err
+		}
+	}
+	r.Record(run)
+	if textfile == "" {
+		return nil
+	}
+	return r.Save(textfile)
+}
+
+// Handler 以 Prometheus 文本格式提供 r 中的指标。
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
+
+// Serve 在 addr 上提供 /metrics，监听失败时返回错误，关闭返回的 Server 即停止。
+func Serve(addr string, r *Registry) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", r.Handler())
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintf(os.Stderr, "metrics server: %v\n", err)
+		}
+	}()
+	return srv, nil
+}
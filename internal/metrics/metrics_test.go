@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 作为子进程运行时，METRICS_TEST_TEXTFILE 为要更新的 textfile
+func TestMain(m *testing.M) {
+	if path := os.Getenv("METRICS_TEST_TEXTFILE"); path != "" {
+		n, _ := strconv.Atoi(os.Getenv("METRICS_TEST_RUNS"))
+		for i := 0; i < n; i++ {
+			run := Run{Tool: "dbbackup", Job: "app", Type: "mysql", Success: i%2 == 0, Duration: time.Second, Size: 100}
+			if err := Update(nil, path, run); err != nil {
+				os.Stderr.WriteString(err.Error() + "\n")
+				os.Exit(1)
+			}
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// 多个进程同时更新同一个 textfile 时计数不丢失，也不留下临时文件。
+func TestUpdateConcurrentProcesses(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dbbackup.prom")
+	const procs, runs = 6, 20
+	var cmds []*exec.Cmd
+	for i := 0; i < procs; i++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^$")
+		cmd.Env = append(os.Environ(), "METRICS_TEST_TEXTFILE="+path, "METRICS_TEST_RUNS="+strconv.Itoa(runs))
+		cmd.Stderr = os.Stderr
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		cmds = append(cmds, cmd)
+	}
+	for _, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := `tool="dbbackup",job="app",type="mysql"`
+	if got := r.series["dbbackup_runs_total"][l]; got != procs*runs {
+		t.Errorf("dbbackup_runs_total = %v, want %d", got, procs*runs)
+	}
+	if got := r.series["dbbackup_failures_total"][l]; got != procs*runs/2 {
+		t.Errorf("dbbackup_failures_total = %v, want %d", got, procs*runs/2)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Name() != "dbbackup.prom" && e.Name() != "dbbackup.prom.lock" {
+			t.Errorf("unexpected file %s left in the textfile directory", e.Name())
+		}
+	}
+}
+
+func TestSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "dbbackup.prom")
+	r := New()
+	r.Record(Run{Tool: "mysql_xtrabackup", Job: `we"ird`, Type: "full", Success: true, Time: time.Unix(1700000000, 500e6), Size: 42})
+	if err := r.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm()&0044 != 0044 {
+		t.Errorf("textfile mode %v is not readable by node_exporter", fi.Mode().Perm())
+	}
+	data, _ := os.ReadFile(path)
+	want := `dbbackup_last_success_timestamp_seconds{tool="mysql_xtrabackup",job="we\"ird",type="full"} 1700000000.5`
+	if !strings.Contains(string(data), want+"\n") {
+		t.Errorf("textfile does not contain %s:\n%s", want, data)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.series["dbbackup_last_size_bytes"][`tool="mysql_xtrabackup",job="we\"ird",type="full"`]; got != 42 {
+		t.Errorf("loaded dbbackup_last_size_bytes = %v, want 42", got)
+	}
+}
@@ -0,0 +1,122 @@
+package notify
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EmailConfig SMTP 邮件通道。
+type EmailConfig struct {
+	Host     string   `json:"host"`     // SMTP 服务器
+	Port     int      `json:"port"`     // 默认 587（STARTTLS），465 使用 TLS 直连
+	Username string   `json:"username"` // 为空时不认证
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+func (c EmailConfig) validate() error {
+	if c.Host == "" {
+		return errors.New("host is required")
+	}
+	if c.From == "" {
+		return errors.New("from is required")
+	}
+	if len(c.To) == 0 {
+		return errors.New("to is required")
+	}
+	return nil
+}
+
+// email 通过 SMTP 发送纯文本邮件。
+type email struct {
+	cfg EmailConfig
+	msg *message
+}
+
+func (m *email) String() string { return "email " + m.addr() }
+
+func (m *email) addr() string {
+	port := m.cfg.Port
+	if port == 0 {
+		port = 587
+	}
+	return net.JoinHostPort(m.cfg.Host, strconv.Itoa(port))
+}
+
+func (m *email) Notify(e *Event) error {
+	subject, err := m.msg.title(e)
+	if err != nil {
+		return err
+	}
+	text, err := m.msg.text(e)
+	if err != nil {
+		return err
+	}
+	msg := strings.Join([]string{
+		"From: " + m.cfg.From,
+		"To: " + strings.Join(m.cfg.To, ", "),
+		"Subject: " + mime.BEncoding.Encode("UTF-8", subject),
+		"Date: " + e.Time.Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"Content-Transfer-Encoding: 8bit",
+		"",
+		strings.ReplaceAll(text, "\n", "\r\n"),
+	}, "\r\n")
+
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+	}
+	if m.cfg.Port != 465 {
+		// SendMail 在服务器支持时自动 STARTTLS
+		if err := smtp.SendMail(m.addr(), auth, m.cfg.From, m.cfg.To, []byte(msg)); err != nil {
+			return fmt.Errorf("send mail via %s: %w", m.addr(), err)
+		}
+		return nil
+	}
+
+	dialer := &net.Dialer{Timeout: 15 * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", m.addr(), &tls.Config{ServerName: m.cfg.Host})
+	if err != nil {
+		return fmt.Errorf("connect %s: %w", m.addr(), err)
+	}
+	c, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if auth != nil {
+		if err := c.Auth(auth); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+	if err := c.Mail(m.cfg.From); err != nil {
+		return err
+	}
+	for _, to := range m.cfg.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("rcpt %s: %w", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte(msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,164 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LYcoding0/dbbackup/internal/manifest"
+)
+
+// feishu 飞书群机器人，支持签名校验、消息卡片和失败时 @ 值班人员。
+type feishu struct {
+	url      string
+	keyword  string
+	secret   string
+	card     bool
+	mentions []string
+	msg      *message
+}
+
+func (f *feishu) String() string { return "feishu " + redact(f.url) }
+
+func (f *feishu) Notify(e *Event) error {
+	var payload map[string]interface{}
+	if f.card {
+		card, err := f.buildCard(e)
+		if err != nil {
+			return err
+		}
+		payload = map[string]interface{}{"msg_type": "interactive", "card": card}
+	} else {
+		text, err := f.msg.text(e)
+		if err != nil {
+			return err
+		}
+		if f.keyword != "" {
+			text = f.keyword + "\n" + text
+		}
+		if e.Status == StatusFailure {
+			for _, m := range f.mentions {
+				// 文本消息只支持 open_id
+				text += fmt.Sprintf(` <at user_id="%s"></at>`, m)
+			}
+		}
+		payload = map[string]interface{}{"msg_type": "text", "content": map[string]string{"text": text}}
+	}
+	if f.secret != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		payload["timestamp"] = ts
+		payload["sign"] = feishuSign(ts, f.secret)
+	}
+	return postRobot(f.url, payload)
+}
+
+// feishuSign 飞书签名：以 timestamp + "\n" + secret 为密钥对空串做 HMAC-SHA256，再 base64。
+func feishuSign(timestamp, secret string) string {
+	h := hmac.New(sha256.New, []byte(timestamp+"\n"+secret))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// cardLabels 卡片字段名的英文
+var cardLabels = map[string]string{
+	"任务": "Job", "主机": "Host", "类型": "Type", "备份名": "Backup", "大小": "Size", "耗时": "Duration",
+	"链路": "Chain", "文件": "Location", "日志": "Log", "时间": "Time", "清理": "Pruned", "错误": "Error", "告警": "Warning",
+}
+
+// buildCard 生成消息卡片：标题按状态着色，字段两列排列，失败时附上错误和 @ 提醒。
+// 设置了自定义模板时，卡片正文为模板渲染的内容（支持 lark_md）。
+func (f *feishu) buildCard(e *Event) (map[string]interface{}, error) {
+	title, err := f.msg.title(e)
+	if err != nil {
+		return nil, err
+	}
+	color := "green"
+	switch {
+	case e.Status == StatusFailure:
+		color = "red"
+	case len(e.Warnings) > 0:
+		color = "orange"
+	}
+	if f.keyword != "" {
+		// 关键字需出现在消息中
+		title = f.keyword + " " + title
+	}
+
+	label := func(name string) string {
+		if f.msg.lang == "en" {
+			return cardLabels[name]
+		}
+		return name
+	}
+	var fields []interface{}
+	field := func(name, value string) {
+		if value == "" {
+			return
+		}
+		fields = append(fields, map[string]interface{}{
+			"is_short": true,
+			"text":     larkMD(fmt.Sprintf("**%s**\n%s", label(name), value)),
+		})
+	}
+	field("任务", e.Job)
+	field("主机", e.Host)
+	field("类型", e.Type)
+	field("备份名", strings.Join(e.Backups, "\n"))
+	if e.Size > 0 {
+		field("大小", manifest.FormatSize(e.Size))
+	}
+	if e.Duration > 0 {
+		field("耗时", e.Duration.Round(time.Second).String())
+	}
+	if len(e.Chain) > 1 {
+		field("链路", strings.Join(e.Chain, " → "))
+	}
+	field("文件", e.Location)
+	field("日志", e.Log)
+	field("时间", e.Time.Format("2006-01-02 15:04:05"))
+
+	var elements []interface{}
+	if f.msg.custom {
+		text, err := f.msg.text(e)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, map[string]interface{}{"tag": "div", "text": larkMD(text)})
+	} else {
+		elements = append(elements, map[string]interface{}{"tag": "div", "fields": fields})
+		block := func(name, value string) {
+			if value != "" {
+				elements = append(elements, map[string]interface{}{"tag": "div", "text": larkMD("**" + label(name) + "**\n" + value)})
+			}
+		}
+		block("清理", strings.Join(e.Pruned, "\n"))
+		block("错误", e.Error)
+		block("告警", strings.Join(e.Warnings, "\n"))
+	}
+	if e.Status == StatusFailure && len(f.mentions) > 0 {
+		var ats []string
+		for _, m := range f.mentions {
+			if strings.Contains(m, "@") {
+				ats = append(ats, fmt.Sprintf("<at email=%s></at>", m))
+			} else {
+				ats = append(ats, fmt.Sprintf("<at id=%s></at>", m))
+			}
+		}
+		elements = append(elements, map[string]interface{}{"tag": "div", "text": larkMD(strings.Join(ats, " "))})
+	}
+	return map[string]interface{}{
+		"config": map[string]interface{}{"wide_screen_mode": true},
+		"header": map[string]interface{}{
+			"title":    map[string]string{"tag": "plain_text", "content": title},
+			"template": color,
+		},
+		"elements": elements,
+	}, nil
+}
+
+func larkMD(content string) map[string]string {
+	return map[string]string{"tag": "lark_md", "content": content}
+}
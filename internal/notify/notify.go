@@ -0,0 +1,215 @@
+// Package notify 将备份结果发送到飞书、钉钉、企业微信、Slack 兼容 webhook、通用 JSON webhook
+// 或邮件，每个通道可以单独设置发送条件（总是、仅失败、恢复等）。
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LYcoding0/dbbackup/internal/manifest"
+)
+
+// 备份结果状态。
+const (
+	StatusSuccess = "success"
+	StatusFailure = "failure"
+)
+
+// 通道的发送条件。
+const (
+	WhenAlways   = "always"   // 每次都发送
+	WhenSuccess  = "success"  // 成功时发送（包括恢复）
+	WhenFailure  = "failure"  // 失败时发送
+	WhenRecovery = "recovery" // 上一次失败、本次成功时发送
+)
+
+// Event 一次备份任务的结果。
+type Event struct {
+	Tool      string        `json:"tool"`               // dbbackup 或 mysql_xtrabackup
+	Job       string        `json:"job"`                // 目标名或备份前缀
+	Host      string        `json:"host,omitempty"`     // 数据库地址
+	Type      string        `json:"type,omitempty"`     // 备份类型，例如 full、incr
+	Status    string        `json:"status"`             // success 或 failure
+	Recovered bool          `json:"recovered"`          // 上一次失败、本次成功
+	Backups   []string      `json:"backups,omitempty"`  // 本次生成的备份名
+	Size      int64         `json:"size,omitempty"`     // 备份大小（字节）
+	Chain     []string      `json:"chain,omitempty"`    // 增量备份从全量备份开始的链路，最后一项为本次备份
+	Location  string        `json:"location,omitempty"` // 备份文件、目录或存储中的位置
+	Log       string        `json:"log,omitempty"`      // 日志文件
+	Duration  time.Duration `json:"-"`                  // 耗时
+	Error     string        `json:"error,omitempty"`    // 失败原因
+	Warnings  []string      `json:"warnings,omitempty"` // 不影响结果的问题，例如可选目的地上传失败
+	Pruned    []string      `json:"pruned,omitempty"`   // 按保留策略删除的备份，格式为 "位置: 备份名"
+	Time      time.Time     `json:"time"`               // 结束时间
+	Seconds   float64       `json:"duration_seconds"`   // 耗时（秒），发送前由 Duration 填写
+
+	Manifests []*manifest.Manifest `json:"-"` // 本次备份的清单，供模板使用
+}
+
+// Config 一个通知通道，两个程序的配置文件中使用相同的字段。
+type Config struct {
+	Type    string            `json:"type"`    // feishu、dingtalk、wecom、slack、webhook 或 email
+	When    []string          `json:"when"`    // 发送条件：always、success、failure、recovery，可组合，默认 always
+	URL     string            `json:"url"`     // 机器人或 webhook 地址（email 以外）
+	Keyword string            `json:"keyword"` // 机器人的安全关键字，放在消息第一行
+	Headers map[string]string `json:"headers"` // webhook：附加的请求头，例如 Authorization
+	Email   EmailConfig       `json:"email"`   // email：SMTP 服务器和收件人
+
+	// 消息内容，见 template.go
+	Lang         string `json:"lang"`          // 内置模板的语言：zh（默认）或 en
+	Template     string `json:"template"`      // 自定义正文模板（text/template），webhook 为请求体
+	TemplateFile string `json:"template_file"` // 从文件读取正文模板，与 template 二选一
+	Subject      string `json:"subject"`       // 自定义标题模板，用于邮件标题和飞书卡片标题
+
+	// 以下仅用于飞书
+	Secret   string   `json:"secret"`   // 签名校验的密钥
+	Card     bool     `json:"card"`     // 发送消息卡片而不是纯文本
+	Mentions []string `json:"mentions"` // 失败时 @ 的用户：open_id、邮箱（仅卡片）或 all
+}
+
+// Notifier 通知通道。
+type Notifier interface {
+	// Notify 发送一次备份结果。
+	Notify(e *Event) error
+	// String 用于日志的描述，不含密钥。
+	String() string
+}
+
+// New 根据通道类型创建 Notifier。
+func New(cfg Config) (Notifier, error) {
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+	msg, err := newMessage(cfg)
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.Type {
+	case "email":
+		return &email{cfg: cfg.Email, msg: msg}, nil
+	case "webhook":
+		return &webhook{url: cfg.URL, headers: cfg.Headers, msg: msg}, nil
+	case "feishu":
+		return &feishu{url: cfg.URL, keyword: cfg.Keyword, secret: cfg.Secret, card: cfg.Card, mentions: cfg.Mentions, msg: msg}, nil
+	}
+	return &robot{kind: cfg.Type, url: cfg.URL, keyword: cfg.Keyword, msg: msg}, nil
+}
+
+// Validate 检查配置，不发送消息。
+func Validate(cfg Config) error {
+	switch cfg.Type {
+	case "feishu", "dingtalk", "wecom", "slack", "webhook":
+		if cfg.URL == "" {
+			return fmt.Errorf("%s: url is required", cfg.Type)
+		}
+	case "email":
+		if err := cfg.Email.validate(); err != nil {
+			return fmt.Errorf("email: %w", err)
+		}
+	case "":
+		return errors.New("notify type is required")
+	default:
+		return fmt.Errorf("unsupported notify type %q", cfg.Type)
+	}
+	if cfg.Type != "feishu" && (cfg.Secret != "" || cfg.Card || len(cfg.Mentions) > 0) {
+		return fmt.Errorf("%s: secret, card and mentions are only supported by feishu", cfg.Type)
+	}
+	if !cfg.Card {
+		for _, m := range cfg.Mentions {
+			if strings.Contains(m, "@") {
+				return fmt.Errorf("feishu: mention %s by email requires card", m)
+			}
+		}
+	}
+	if _, err := newMessage(cfg); err != nil {
+		return fmt.Errorf("%s: %w", cfg.Type, err)
+	}
+	for _, w := range cfg.When {
+		switch w {
+		case WhenAlways, WhenSuccess, WhenFailure, WhenRecovery:
+		default:
+			return fmt.Errorf("%s: unknown when %q, want always, success, failure or recovery", cfg.Type, w)
+		}
+	}
+	return nil
+}
+
+// Match 通道的发送条件是否包含 e。
+func (cfg Config) Match(e *Event) bool {
+	if len(cfg.When) == 0 {
+		return true
+	}
+	for _, w := range cfg.When {
+		switch {
+		case w == WhenAlways,
+			w == WhenSuccess && e.Status == StatusSuccess,
+			w == WhenFailure && e.Status == StatusFailure,
+			w == WhenRecovery && e.Recovered:
+			return true
+		}
+	}
+	return false
+}
+
+// Send 将 e 发送到满足发送条件的通道，各通道独立发送，返回失败通道的错误。
+// statePath 不为空时在其中记录每个任务上一次的状态，用于判断本次是否为恢复。
+func Send(channels []Config, e *Event, statePath string) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Seconds = e.Duration.Seconds()
+	if statePath != "" {
+		prev, err := swapState(statePath, e.Job, e.Status)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "notify state: %v\n", err)
+		}
+		e.Recovered = prev == StatusFailure && e.Status == StatusSuccess
+	}
+	var errs []string
+	for _, c := range channels {
+		if !c.Match(e) {
+			continue
+		}
+		n, err := New(c)
+		if err == nil {
+			err = n.Notify(e)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", c.Type, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// stateMu 同一进程中的多个任务可能共用一个状态文件
+var stateMu sync.Mutex
+
+// swapState 记录任务 job 本次的状态，返回上一次的状态。
+func swapState(path, job, status string) (string, error) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	state := map[string]string{}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &state); err != nil {
+			state = map[string]string{}
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+	prev := state[job]
+	state[job] = status
+	data, _ := json.Marshal(state)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return prev, err
+	}
+	return prev, os.Rename(tmp, path)
+}
@@ -0,0 +1,196 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFeishuSign(t *testing.T) {
+	// HMAC-SHA256(key="1599360473\ntestsecret", msg="")，用 Python hmac 模块计算
+	if got, want := feishuSign("1599360473", "testsecret"), "363UeKLKin0EeG+hrOQd23TNUSH+orqAFf6mWFdhcD4="; got != want {
+		t.Errorf("feishuSign = %s, want %s", got, want)
+	}
+}
+
+// cardTexts 返回卡片 elements 中每个 div 的 lark_md 内容，fields 的内容以换行连接
+func cardTexts(t *testing.T, card map[string]interface{}) []string {
+	t.Helper()
+	var texts []string
+	for _, el := range card["elements"].([]interface{}) {
+		div := el.(map[string]interface{})
+		if text, ok := div["text"].(map[string]string); ok {
+			texts = append(texts, text["content"])
+			continue
+		}
+		var fields []string
+		for _, f := range div["fields"].([]interface{}) {
+			fields = append(fields, f.(map[string]interface{})["text"].(map[string]string)["content"])
+		}
+		texts = append(texts, strings.Join(fields, "\n"))
+	}
+	return texts
+}
+
+func TestFeishuCard(t *testing.T) {
+	n, err := New(Config{Type: "feishu", URL: "https://open.feishu.cn/hook/x", Keyword: "备份", Card: true, Lang: "en",
+		Mentions: []string{"ou_123", "dba@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := n.(*feishu)
+	e := &Event{Tool: "dbbackup", Job: "app", Host: "db1:3306", Status: StatusFailure, Size: 2048,
+		Backups: []string{"mysql_app_20240501_020000"}, Error: "mysqldump: exit status 2", Time: time.Now()}
+	card, err := f.buildCard(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := card["header"].(map[string]interface{})
+	if header["template"] != "red" {
+		t.Errorf("failure card color = %v, want red", header["template"])
+	}
+	if title := header["title"].(map[string]string)["content"]; title != "备份 [dbbackup] app backup failed" {
+		t.Errorf("title = %q", title)
+	}
+	texts := cardTexts(t, card)
+	if len(texts) != 3 {
+		t.Fatalf("%d element(s), want fields, error and mentions: %q", len(texts), texts)
+	}
+	for _, want := range []string{"**Job**\napp", "**Host**\ndb1:3306", "**Backup**\nmysql_app_20240501_020000", "**Size**\n2.0 KB"} {
+		if !strings.Contains(texts[0], want) {
+			t.Errorf("fields %q missing %q", texts[0], want)
+		}
+	}
+	if texts[1] != "**Error**\nmysqldump: exit status 2" {
+		t.Errorf("error block = %q", texts[1])
+	}
+	if texts[2] != "<at id=ou_123></at> <at email=dba@example.com></at>" {
+		t.Errorf("mentions = %q", texts[2])
+	}
+
+	// 成功但有告警：橙色，不 @
+	e.Status, e.Error, e.Warnings = StatusSuccess, "", []string{"upload to s3 failed"}
+	card, err = f.buildCard(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := card["header"].(map[string]interface{})["template"]; c != "orange" {
+		t.Errorf("warning card color = %v, want orange", c)
+	}
+	texts = cardTexts(t, card)
+	if len(texts) != 2 || texts[1] != "**Warning**\nupload to s3 failed" {
+		t.Errorf("warning card elements = %q", texts)
+	}
+}
+
+// fakeRobot 记录收到的请求，按顺序返回 replies 中的状态码和内容，用完后重复最后一个
+type fakeRobot struct {
+	mu       sync.Mutex
+	replies  []reply
+	requests []map[string]interface{}
+}
+
+type reply struct {
+	status int
+	body   string
+}
+
+func (f *fakeRobot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var payload map[string]interface{}
+	data, _ := io.ReadAll(r.Body)
+	json.Unmarshal(data, &payload)
+	f.requests = append(f.requests, payload)
+	rp := f.replies[len(f.replies)-1]
+	if len(f.requests) <= len(f.replies) {
+		rp = f.replies[len(f.requests)-1]
+	}
+	if rp.status == 0 {
+		// 模拟网络错误：不应答直接断开连接
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+		return
+	}
+	w.WriteHeader(rp.status)
+	io.WriteString(w, rp.body)
+}
+
+func TestRobotReplies(t *testing.T) {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = time.Millisecond
+
+	tests := []struct {
+		name     string
+		kind     string
+		replies  []reply
+		err      string // 为空表示成功
+		requests int
+	}{
+		{"feishu ok", "feishu", []reply{{200, `{"code":0,"msg":"success"}`}}, "", 1},
+		{"feishu keyword", "feishu", []reply{{200, `{"code":19024,"msg":"Key Words Not Found"}`}}, "code 19024: Key Words Not Found", 1},
+		{"feishu sign", "feishu", []reply{{200, `{"code":19021,"msg":"sign match fail or timestamp is not within one hour from current time"}`}}, "code 19021", 1},
+		{"feishu legacy", "feishu", []reply{{200, `{"StatusCode":9499,"StatusMessage":"Bad Request"}`}}, "StatusCode 9499: Bad Request", 1},
+		{"dingtalk keyword", "dingtalk", []reply{{200, `{"errcode":310000,"errmsg":"keywords not in content"}`}}, "errcode 310000", 1},
+		{"wecom ok", "wecom", []reply{{200, `{"errcode":0,"errmsg":"ok"}`}}, "", 1},
+		{"slack ok", "slack", []reply{{200, `ok`}}, "", 1},
+		{"client error", "slack", []reply{{404, `no_service`}}, "404 Not Found: no_service", 1},
+		{"server error then ok", "dingtalk", []reply{{502, ``}, {503, ``}, {200, `{"errcode":0}`}}, "", 3},
+		{"server error", "wecom", []reply{{500, `busy`}}, "(after 3 attempts)", 3},
+		{"network error then ok", "feishu", []reply{{0, ``}, {200, `{"code":0}`}}, "", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeRobot{replies: tt.replies}
+			srv := httptest.NewServer(fake)
+			defer srv.Close()
+			n, err := New(Config{Type: tt.kind, URL: srv.URL + "/hook/token"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = n.Notify(&Event{Tool: "dbbackup", Job: "app", Status: StatusSuccess})
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("Notify: %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("Notify = %v, want %q", err, tt.err)
+			}
+			if err != nil && strings.Contains(err.Error(), "token") {
+				t.Errorf("error %q contains the webhook path", err)
+			}
+			if len(fake.requests) != tt.requests {
+				t.Errorf("%d request(s), want %d", len(fake.requests), tt.requests)
+			}
+		})
+	}
+}
+
+func TestFeishuPayload(t *testing.T) {
+	fake := &fakeRobot{replies: []reply{{200, `{"code":0}`}}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	n, err := New(Config{Type: "feishu", URL: srv.URL, Keyword: "备份", Secret: "testsecret", Mentions: []string{"ou_123"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify(&Event{Tool: "dbbackup", Job: "app", Status: StatusFailure, Error: "boom"}); err != nil {
+		t.Fatal(err)
+	}
+	p := fake.requests[0]
+	if p["msg_type"] != "text" {
+		t.Errorf("msg_type = %v, want text", p["msg_type"])
+	}
+	text := p["content"].(map[string]interface{})["text"].(string)
+	if !strings.HasPrefix(text, "备份\n状态: 失败") || !strings.HasSuffix(text, `<at user_id="ou_123"></at>`) {
+		t.Errorf("text = %q", text)
+	}
+	ts, _ := p["timestamp"].(string)
+	if ts == "" || p["sign"] != feishuSign(ts, "testsecret") {
+		t.Errorf("timestamp = %v, sign = %v", p["timestamp"], p["sign"])
+	}
+}
@@ -0,0 +1,160 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/LYcoding0/dbbackup/internal/manifest"
+)
+
+// 内置的消息模板，按 lang 选择，默认中文。模板的数据为 *Event。
+var defaultTemplates = map[string]string{
+	"zh": `状态: {{if eq .Status "failure"}}失败{{else if .Recovered}}成功（已恢复）{{else}}成功{{end}}
+任务: {{.Job}}
+{{- if .Host}}
+主机: {{.Host}}{{end}}
+{{- if .Type}}
+类型: {{.Type}}{{end}}
+{{- if .Backups}}
+备份名: {{join .Backups ", "}}{{end}}
+{{- if .Size}}
+大小: {{size .Size}}{{end}}
+{{- if gt (len .Chain) 1}}
+链路: {{join .Chain " → "}}{{end}}
+{{- if .Location}}
+文件: {{.Location}}{{end}}
+{{- if .Log}}
+日志: {{.Log}}{{end}}
+{{- if .Duration}}
+耗时: {{duration .Duration}}{{end}}
+{{- if .Pruned}}
+清理: {{join .Pruned ", "}}{{end}}
+{{- if .Error}}
+错误: {{.Error}}{{end}}
+{{- range .Warnings}}
+告警: {{.}}{{end}}`,
+
+	"en": `Status: {{if eq .Status "failure"}}FAILED{{else if .Recovered}}success (recovered){{else}}success{{end}}
+Job: {{.Job}}
+{{- if .Host}}
+Host: {{.Host}}{{end}}
+{{- if .Type}}
+Type: {{.Type}}{{end}}
+{{- if .Backups}}
+Backup: {{join .Backups ", "}}{{end}}
+{{- if .Size}}
+Size: {{size .Size}}{{end}}
+{{- if gt (len .Chain) 1}}
+Chain: {{join .Chain " → "}}{{end}}
+{{- if .Location}}
+Location: {{.Location}}{{end}}
+{{- if .Log}}
+Log: {{.Log}}{{end}}
+{{- if .Duration}}
+Duration: {{duration .Duration}}{{end}}
+{{- if .Pruned}}
+Pruned: {{join .Pruned ", "}}{{end}}
+{{- if .Error}}
+Error: {{.Error}}{{end}}
+{{- range .Warnings}}
+Warning: {{.}}{{end}}`,
+}
+
+// 内置的单行标题模板，用于邮件标题和飞书卡片标题。
+var defaultSubjects = map[string]string{
+	"zh": `[{{.Tool}}] {{.Job}} 备份{{if eq .Status "failure"}}失败{{else if .Recovered}}已恢复{{else}}成功{{end}}`,
+	"en": `[{{.Tool}}] {{.Job}} backup {{if eq .Status "failure"}}failed{{else if .Recovered}}recovered{{else}}succeeded{{end}}`,
+}
+
+// templateFuncs 模板中可用的函数。
+var templateFuncs = template.FuncMap{
+	"join":     strings.Join,
+	"size":     manifest.FormatSize,
+	"duration": func(d time.Duration) string { return d.Round(time.Second).String() },
+	"time":     func(t time.Time) string { return t.Format("2006-01-02 15:04:05") },
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+}
+
+// message 通道的正文和标题模板。
+type message struct {
+	lang    string
+	custom  bool // 正文使用自定义模板
+	body    *template.Template
+	subject *template.Template
+}
+
+// newMessage 按通道配置解析模板：template 或 template_file 为自定义正文，subject 为自定义标题，
+// 未设置时使用 lang 对应的内置模板。用空的 Event 试执行一次，提前发现字段名错误。
+func newMessage(cfg Config) (*message, error) {
+	lang := cfg.Lang
+	if lang == "" {
+		lang = "zh"
+	}
+	if _, ok := defaultTemplates[lang]; !ok {
+		return nil, fmt.Errorf("unsupported lang %q, want zh or en", cfg.Lang)
+	}
+	if cfg.Template != "" && cfg.TemplateFile != "" {
+		return nil, fmt.Errorf("template and template_file are mutually exclusive")
+	}
+	m := &message{lang: lang}
+	text := cfg.Template
+	if cfg.TemplateFile != "" {
+		data, err := os.ReadFile(cfg.TemplateFile)
+		if err != nil {
+			return nil, fmt.Errorf("read template_file: %w", err)
+		}
+		text = string(data)
+	}
+	m.custom = text != ""
+	if !m.custom {
+		text = defaultTemplates[lang]
+	}
+	subject := cfg.Subject
+	if subject == "" {
+		subject = defaultSubjects[lang]
+	}
+	var err error
+	if m.body, err = parseTemplate("template", text); err != nil {
+		return nil, err
+	}
+	if m.subject, err = parseTemplate("subject", subject); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.Execute(io.Discard, &Event{}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// text 渲染正文。
+func (m *message) text(e *Event) (string, error) {
+	return render(m.body, e)
+}
+
+// title 渲染单行标题，换行替换为空格。
+func (m *message) title(e *Event) (string, error) {
+	s, err := render(m.subject, e)
+	return strings.Join(strings.Fields(s), " "), err
+}
+
+func render(t *template.Template, e *Event) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, e); err != nil {
+		return "", fmt.Errorf("render %s: %w", t.Name(), err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
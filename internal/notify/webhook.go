@@ -0,0 +1,184 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// httpClient 发送 webhook 使用的客户端，避免对端无响应时阻塞备份任务
+var httpClient = &http.Client{Timeout: 15 * time.Second}
+
+// robot 群机器人：钉钉、企业微信和 Slack 兼容的 incoming webhook，发送文本消息。飞书见 feishu.go。
+type robot struct {
+	kind    string
+	url     string
+	keyword string
+	msg     *message
+}
+
+func (r *robot) String() string { return r.kind + " " + redact(r.url) }
+
+func (r *robot) Notify(e *Event) error {
+	text, err := r.msg.text(e)
+	if err != nil {
+		return err
+	}
+	if r.keyword != "" {
+		text = r.keyword + "\n" + text
+	}
+	var payload interface{}
+	switch r.kind {
+	case "dingtalk", "wecom":
+		payload = map[string]interface{}{"msgtype": "text", "text": map[string]string{"content": text}}
+	default:
+		payload = map[string]string{"text": text}
+	}
+	return postRobot(r.url, payload)
+}
+
+// 网络错误或 5xx 时重试的次数和间隔，间隔逐次加倍
+var (
+	retryAttempts = 3
+	retryDelay    = 2 * time.Second
+)
+
+// permanentError 重试也不会成功的错误：4xx、机器人返回的错误码（关键字不匹配、签名错误等）。
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// postRobot 发送机器人消息并检查应答，失败时重试。
+func postRobot(u string, payload interface{}) error {
+	return retry(func() error {
+		body, err := postJSON(u, payload, nil)
+		if err != nil {
+			return err
+		}
+		if err := checkReply(body); err != nil {
+			return &permanentError{err}
+		}
+		return nil
+	})
+}
+
+// retry 执行 fn，失败时重试，permanentError 直接返回。
+func retry(fn func() error) error {
+	var err error
+	delay := retryDelay
+	for i := 0; i < retryAttempts; i++ {
+		if i > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		if err = fn(); err == nil {
+			return nil
+		}
+		var perm *permanentError
+		if errors.As(err, &perm) {
+			return err
+		}
+	}
+	if retryAttempts > 1 {
+		return fmt.Errorf("%w (after %d attempts)", err, retryAttempts)
+	}
+	return err
+}
+
+// webhook 通用 JSON webhook，请求体为 Event，设置了 template 时为模板渲染的内容。
+type webhook struct {
+	url     string
+	headers map[string]string
+	msg     *message
+}
+
+func (w *webhook) String() string { return "webhook " + redact(w.url) }
+
+func (w *webhook) Notify(e *Event) error {
+	var payload interface{} = e
+	if w.msg.custom {
+		text, err := w.msg.text(e)
+		if err != nil {
+			return err
+		}
+		payload = json.RawMessage(text)
+	}
+	return retry(func() error {
+		_, err := postJSON(w.url, payload, w.headers)
+		return err
+	})
+}
+
+// postJSON 以 JSON 发送 payload，非 2xx 时返回错误（4xx 为 permanentError），返回响应内容。
+func postJSON(u string, payload interface{}, headers map[string]string) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, &permanentError{err}
+	}
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(data))
+	if err != nil {
+		return nil, &permanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("post %s: %w", redact(u), err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		err := fmt.Errorf("post %s: %s: %s", redact(u), resp.Status, strings.TrimSpace(string(body)))
+		if resp.StatusCode/100 == 4 {
+			return body, &permanentError{err}
+		}
+		return body, err
+	}
+	return body, nil
+}
+
+// checkReply 检查机器人的应答：飞书为 code（旧版为 StatusCode），钉钉和企业微信为 errcode，
+// 非 0 表示失败（例如关键字不匹配、签名错误），HTTP 状态码仍为 200。Slack 的应答不是 JSON，不检查。
+func checkReply(body []byte) error {
+	var reply struct {
+		Code          *int   `json:"code"`
+		Msg           string `json:"msg"`
+		StatusCode    *int   `json:"StatusCode"`
+		StatusMessage string `json:"StatusMessage"`
+		ErrCode       *int   `json:"errcode"`
+		ErrMsg        string `json:"errmsg"`
+	}
+	if json.Unmarshal(body, &reply) != nil {
+		return nil
+	}
+	if reply.Code != nil && *reply.Code != 0 {
+		return fmt.Errorf("code %d: %s", *reply.Code, reply.Msg)
+	}
+	if reply.StatusCode != nil && *reply.StatusCode != 0 {
+		return fmt.Errorf("StatusCode %d: %s", *reply.StatusCode, reply.StatusMessage)
+	}
+	if reply.ErrCode != nil && *reply.ErrCode != 0 {
+		return fmt.Errorf("errcode %d: %s", *reply.ErrCode, reply.ErrMsg)
+	}
+	return nil
+}
+
+// redact 去掉 URL 中的路径和参数，webhook 的 token 通常在其中。
+func redact(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Host == "" {
+		return "webhook"
+	}
+	return parsed.Scheme + "://" + parsed.Host + "/..."
+}
@@ -0,0 +1,198 @@
+// Package pool 并发执行一组任务，同时限制总并发数和同一分组（例如同一台数据库主机）的并发数。
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrCanceled 因其他任务失败（FailFast）而未执行的任务返回此错误。
+var ErrCanceled = errors.New("canceled after an earlier failure")
+
+// Task 一个待执行的任务。
+type Task struct {
+	Group string // 分组键，相同分组的任务受 PerGroup 限制
+	Run   func() error
+}
+
+// Options 并发限制。
+type Options struct {
+	Workers  int  // 总并发数，<=0 视为 1
+	PerGroup int  // 同一分组的并发数，<=0 表示不限制
+	FailFast bool // 有任务失败后不再启动剩余任务
+}
+
+// Run 执行全部任务并等待结束，返回与 tasks 一一对应的错误。
+// 任务按顺序启动，分组已满的任务让位给后面可以执行的任务。
+// ctx 取消或 FailFast 生效后，尚未开始的任务不再执行，已经开始的任务会执行完。
+func Run(ctx context.Context, tasks []Task, opts Options) []error {
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	s := &scheduler{
+		ctx:     ctx,
+		tasks:   tasks,
+		opts:    opts,
+		errs:    make([]error, len(tasks)),
+		started: make([]bool, len(tasks)),
+		running: map[string]int{},
+	}
+	s.cond = sync.NewCond(&s.mu)
+
+	stop := context.AfterFunc(ctx, func() { s.halt(ctx.Err()) })
+	defer stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Workers && i < len(tasks); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work()
+		}()
+	}
+	wg.Wait()
+
+	for i := range tasks {
+		if !s.started[i] {
+			s.errs[i] = s.stopErr
+		}
+	}
+	return s.errs
+}
+
+type scheduler struct {
+	ctx   context.Context
+	tasks []Task
+	opts  Options
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	errs    []error
+	started []bool
+	running map[string]int // 各分组正在执行的任务数
+	stopErr error          // 不为空时不再启动新任务
+}
+
+// halt 停止启动新任务，未启动的任务返回 err。
+func (s *scheduler) halt(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopErr == nil {
+		s.stopErr = err
+	}
+	s.cond.Broadcast()
+}
+
+func (s *scheduler) work() {
+	for {
+		i, ok := s.next()
+		if !ok {
+			return
+		}
+		err := s.tasks[i].Run()
+
+		// 在同一临界区内记录错误并停止，被唤醒的任务不会在 FailFast 生效前领到新任务
+		s.mu.Lock()
+		s.errs[i] = err
+		s.running[s.tasks[i].Group]--
+		if err != nil && s.opts.FailFast && s.stopErr == nil {
+			s.stopErr = ErrCanceled
+		}
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	}
+}
+
+// next 等待并领取下一个可执行的任务，没有剩余任务或已停止时返回 false。
+func (s *scheduler) next() (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		if err := s.ctx.Err(); err != nil && s.stopErr == nil {
+			s.stopErr = err
+		}
+		if s.stopErr != nil {
+			return 0, false
+		}
+		pending := false
+		for i, task := range s.tasks {
+			if s.started[i] {
+				continue
+			}
+			pending = true
+			if s.opts.PerGroup > 0 && s.running[task.Group] >= s.opts.PerGroup {
+				continue
+			}
+			s.started[i] = true
+			s.running[task.Group]++
+			return i, true
+		}
+		if !pending {
+			return 0, false
+		}
+		s.cond.Wait()
+	}
+}
+
+// Limiter 与 Run 相同的并发限制，供 daemon 模式下各自触发的任务共享。
+type Limiter struct {
+	workers, perGroup int
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	total   int
+	running map[string]int
+}
+
+// NewLimiter 创建 Limiter，参数含义同 Options 的 Workers 和 PerGroup。
+func NewLimiter(workers, perGroup int) *Limiter {
+	if workers <= 0 {
+		workers = 1
+	}
+	l := &Limiter{workers: workers, perGroup: perGroup, running: map[string]int{}}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// SetLimits 修改并发限制，已占用的名额不受影响，超出新限制时后续的 Acquire 等待名额降下来。
+func (l *Limiter) SetLimits(workers, perGroup int) {
+	if workers <= 0 {
+		workers = 1
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.workers, l.perGroup = workers, perGroup
+	l.cond.Broadcast()
+}
+
+// Acquire 等待 group 和全局都有空闲名额，ctx 取消时返回其错误。成功后必须调用 Release。
+func (l *Limiter) Acquire(ctx context.Context, group string) error {
+	stop := context.AfterFunc(ctx, func() {
+		l.mu.Lock()
+		l.cond.Broadcast()
+		l.mu.Unlock()
+	})
+	defer stop()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.total >= l.workers || (l.perGroup > 0 && l.running[group] >= l.perGroup) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		l.cond.Wait()
+	}
+	l.total++
+	l.running[group]++
+	return nil
+}
+
+// Release 归还 Acquire 占用的名额。
+func (l *Limiter) Release(group string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total--
+	l.running[group]--
+	l.cond.Broadcast()
+}
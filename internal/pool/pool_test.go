@@ -0,0 +1,319 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tracker 记录全局和各分组同时执行的最大任务数
+type tracker struct {
+	mu        sync.Mutex
+	total     int
+	maxTotal  int
+	groups    map[string]int
+	maxGroups map[string]int
+}
+
+func newTracker() *tracker {
+	return &tracker{groups: map[string]int{}, maxGroups: map[string]int{}}
+}
+
+func (tr *tracker) enter(group string) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.total++
+	tr.groups[group]++
+	if tr.total > tr.maxTotal {
+		tr.maxTotal = tr.total
+	}
+	if tr.groups[group] > tr.maxGroups[group] {
+		tr.maxGroups[group] = tr.groups[group]
+	}
+}
+
+func (tr *tracker) leave(group string) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.total--
+	tr.groups[group]--
+}
+
+func TestRunLimits(t *testing.T) {
+	tr := newTracker()
+	var tasks []Task
+	for i := 0; i < 30; i++ {
+		group := fmt.Sprintf("db%d:3306", i%3)
+		tasks = append(tasks, Task{Group: group, Run: func() error {
+			tr.enter(group)
+			time.Sleep(2 * time.Millisecond)
+			tr.leave(group)
+			return nil
+		}})
+	}
+	errs := Run(context.Background(), tasks, Options{Workers: 4, PerGroup: 2})
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("task %d: %v", i, err)
+		}
+	}
+	if tr.maxTotal > 4 || tr.maxTotal < 2 {
+		t.Errorf("max concurrent tasks = %d, want 2-4", tr.maxTotal)
+	}
+	for group, n := range tr.maxGroups {
+		if n > 2 {
+			t.Errorf("max concurrent tasks on %s = %d, want <= 2", group, n)
+		}
+	}
+}
+
+func TestRunGroupYields(t *testing.T) {
+	// a 的分组已满时，后面的 b 先执行；a1 等到 b 开始后才结束
+	bStarted := make(chan struct{})
+	var order []string
+	var mu sync.Mutex
+	record := func(name string) {
+		mu.Lock()
+		order = append(order, name)
+		mu.Unlock()
+	}
+	tasks := []Task{
+		{Group: "a", Run: func() error {
+			record("a1")
+			select {
+			case <-bStarted:
+				return nil
+			case <-time.After(5 * time.Second):
+				return errors.New("b did not start while a1 was running")
+			}
+		}},
+		{Group: "a", Run: func() error { record("a2"); return nil }},
+		{Group: "b", Run: func() error { record("b"); close(bStarted); return nil }},
+	}
+	errs := Run(context.Background(), tasks, Options{Workers: 2, PerGroup: 1})
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("task %d: %v", i, err)
+		}
+	}
+	if fmt.Sprint(order) != "[a1 b a2]" {
+		t.Errorf("order = %v, want [a1 b a2]", order)
+	}
+}
+
+func TestRunFailFast(t *testing.T) {
+	boom := errors.New("boom")
+	ran := make([]bool, 5)
+	var tasks []Task
+	for i := range ran {
+		i := i
+		tasks = append(tasks, Task{Run: func() error {
+			ran[i] = true
+			if i == 1 {
+				return boom
+			}
+			return nil
+		}})
+	}
+	errs := Run(context.Background(), tasks, Options{Workers: 1, FailFast: true})
+	if errs[0] != nil || errs[1] != boom {
+		t.Errorf("errs[0:2] = %v, want [nil boom]", errs[:2])
+	}
+	for i := 2; i < len(tasks); i++ {
+		if ran[i] || !errors.Is(errs[i], ErrCanceled) {
+			t.Errorf("task %d: ran = %v, err = %v, want skipped with ErrCanceled", i, ran[i], errs[i])
+		}
+	}
+
+	// 并发执行时，失败前已经开始的任务执行完，之后不再启动新任务
+	var mu sync.Mutex
+	started := 0
+	running, failed := make(chan struct{}), make(chan struct{})
+	tasks = nil
+	for i := 0; i < 6; i++ {
+		i := i
+		tasks = append(tasks, Task{Run: func() error {
+			mu.Lock()
+			started++
+			mu.Unlock()
+			switch i {
+			case 0:
+				<-running
+				close(failed)
+				return boom
+			case 1:
+				// 在任务 0 的失败记录之后才结束
+				close(running)
+				<-failed
+				time.Sleep(20 * time.Millisecond)
+			}
+			return nil
+		}})
+	}
+	errs = Run(context.Background(), tasks, Options{Workers: 2, FailFast: true})
+	if started != 2 || errs[0] != boom || errs[1] != nil {
+		t.Errorf("started %d task(s), errs = %v, want 2 started and [boom nil ...]", started, errs)
+	}
+	for i := 2; i < len(tasks); i++ {
+		if !errors.Is(errs[i], ErrCanceled) {
+			t.Errorf("task %d: %v, want ErrCanceled", i, errs[i])
+		}
+	}
+
+	// 不设置 FailFast 时失败不影响其他任务
+	errs = Run(context.Background(), []Task{{Run: func() error { return boom }}, {Run: func() error { return nil }}}, Options{})
+	if errs[0] != boom || errs[1] != nil {
+		t.Errorf("errs = %v, want [boom nil]", errs)
+	}
+}
+
+func TestRunCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	tasks := []Task{
+		{Run: func() error { cancel(); return nil }},
+		{Run: func() error { return nil }},
+	}
+	errs := Run(ctx, tasks, Options{Workers: 1})
+	if errs[0] != nil || !errors.Is(errs[1], context.Canceled) {
+		t.Errorf("errs = %v, want [nil context.Canceled]", errs)
+	}
+}
+
+// acquireAsync 在后台调用 Acquire，结果写入返回的 channel
+func acquireAsync(ctx context.Context, l *Limiter, group string) <-chan error {
+	ch := make(chan error, 1)
+	go func() { ch <- l.Acquire(ctx, group) }()
+	return ch
+}
+
+func expectBlocked(t *testing.T, ch <-chan error, what string) {
+	t.Helper()
+	select {
+	case err := <-ch:
+		t.Fatalf("%s: Acquire returned %v, want it to wait", what, err)
+	case <-time.After(30 * time.Millisecond):
+	}
+}
+
+func expectAcquired(t *testing.T, ch <-chan error, what string) {
+	t.Helper()
+	select {
+	case err := <-ch:
+		if err != nil {
+			t.Fatalf("%s: %v", what, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s: Acquire still waiting", what)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := NewLimiter(2, 1)
+	if err := l.Acquire(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	// 同一分组已满
+	a2 := acquireAsync(ctx, l, "a")
+	expectBlocked(t, a2, "second holder of group a")
+	if err := l.Acquire(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	// 全局已满
+	c := acquireAsync(ctx, l, "c")
+	expectBlocked(t, c, "third holder")
+
+	// ctx 取消时放弃等待
+	cctx, cancel := context.WithCancel(ctx)
+	d := acquireAsync(cctx, l, "d")
+	cancel()
+	select {
+	case err := <-d:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("canceled Acquire = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("canceled Acquire still waiting")
+	}
+
+	l.Release("b")
+	expectAcquired(t, c, "after releasing b")
+	expectBlocked(t, a2, "second holder of group a")
+	l.Release("a")
+	expectAcquired(t, a2, "after releasing a")
+	l.Release("a")
+	l.Release("c")
+}
+
+func TestLimiterSetLimits(t *testing.T) {
+	ctx := context.Background()
+	l := NewLimiter(2, 0)
+	for i := 0; i < 2; i++ {
+		if err := l.Acquire(ctx, "a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	third := acquireAsync(ctx, l, "a")
+	expectBlocked(t, third, "third holder with workers=2")
+
+	// 调大后等待的任务立即拿到名额
+	l.SetLimits(3, 0)
+	expectAcquired(t, third, "third holder after SetLimits(3, 0)")
+
+	// 调小后已占用的名额不受影响，新的 Acquire 等到占用数降到新限制以下
+	l.SetLimits(1, 0)
+	fourth := acquireAsync(ctx, l, "b")
+	expectBlocked(t, fourth, "fourth holder with workers=1")
+	l.Release("a")
+	l.Release("a")
+	expectBlocked(t, fourth, "fourth holder with one of one slots held")
+	l.Release("a")
+	expectAcquired(t, fourth, "fourth holder after all releases")
+
+	// 同时修改分组限制
+	l.SetLimits(4, 1)
+	fifth := acquireAsync(ctx, l, "b")
+	expectBlocked(t, fifth, "second holder of group b with per-group=1")
+	if err := l.Acquire(ctx, "c"); err != nil {
+		t.Fatal(err)
+	}
+	l.SetLimits(4, 0)
+	expectAcquired(t, fifth, "second holder of group b after SetLimits(4, 0)")
+}
+
+func TestLimiterConcurrent(t *testing.T) {
+	l := NewLimiter(3, 2)
+	tr := newTracker()
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		group := fmt.Sprintf("db%d", i%4)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.Acquire(context.Background(), group); err != nil {
+				t.Error(err)
+				return
+			}
+			tr.enter(group)
+			time.Sleep(time.Millisecond)
+			tr.leave(group)
+			l.Release(group)
+		}()
+		if i == 20 {
+			// 持有者仍在执行时调整限制
+			l.SetLimits(2, 1)
+		}
+	}
+	wg.Wait()
+	if tr.maxTotal > 3 {
+		t.Errorf("max holders = %d, want <= 3", tr.maxTotal)
+	}
+	for group, n := range tr.maxGroups {
+		if n > 2 {
+			t.Errorf("max holders of %s = %d, want <= 2", group, n)
+		}
+	}
+}
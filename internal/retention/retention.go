@@ -0,0 +1,140 @@
+// Package retention 按保留策略决定删除哪些备份，支持按天数保留和 GFS
+// （祖父-父-子：最近 N 天、N 周、N 月、N 年各保留一份）策略。
+// 备份时间取自备份名或清单，不依赖文件修改时间；增量备份依赖的基线随之保留。
+package retention
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Policy 保留策略，各规则取并集，满足任一规则的备份即保留；所有规则为 0 时不删除任何备份。
+type Policy struct {
+	Days    int `json:"days"`    // 保留最近这么多天内的所有备份
+	Daily   int `json:"daily"`   // 保留最近 N 个有备份的日子，每天最新的一份
+	Weekly  int `json:"weekly"`  // 保留最近 N 个有备份的周（周一开始），每周最新的一份
+	Monthly int `json:"monthly"` // 保留最近 N 个有备份的月份，每月最新的一份
+	Yearly  int `json:"yearly"`  // 保留最近 N 个有备份的年份，每年最新的一份
+}
+
+// Backup 参与保留计算的一份备份。
+type Backup struct {
+	Name     string
+	Series   string // 同一系列（例如同一数据库）的备份一起计算，不同系列互不影响
+	Time     time.Time
+	Complete bool   // 成功完成的备份才占用日、周、月、年的名额
+	Parent   string // 增量备份的基线备份名，全量备份为空
+}
+
+// IsZero 策略是否为空，即不删除任何备份。
+func (p Policy) IsZero() bool {
+	return p == Policy{}
+}
+
+// Validate 检查各规则不为负数。
+func (p Policy) Validate() error {
+	if p.Days < 0 || p.Daily < 0 || p.Weekly < 0 || p.Monthly < 0 || p.Yearly < 0 {
+		return errors.New("retention values must not be negative")
+	}
+	return nil
+}
+
+func (p Policy) String() string {
+	if p.IsZero() {
+		return "keep all"
+	}
+	var parts []string
+	for _, r := range []struct {
+		name string
+		n    int
+	}{{"days", p.Days}, {"daily", p.Daily}, {"weekly", p.Weekly}, {"monthly", p.Monthly}, {"yearly", p.Yearly}} {
+		if r.n > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%d", r.name, r.n))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Expired 返回按策略应删除的备份，按时间排序。每个系列中最新的完整备份始终保留，
+// 比它更新的未完成备份可能仍在进行中，也会保留。保留的增量备份沿 Parent 依赖的
+// 全量和增量备份都会保留，只有依赖它的备份都过期后基线才会被删除。
+func (p Policy) Expired(backups []Backup, now time.Time) []Backup {
+	if p.IsZero() {
+		return nil
+	}
+	series := map[string][]Backup{}
+	parent := map[string]string{}
+	for _, b := range backups {
+		series[b.Series] = append(series[b.Series], b)
+		parent[b.Name] = b.Parent
+	}
+	keep := map[string]bool{}
+	var kept []string
+	for _, list := range series {
+		for name := range p.keep(list, now) {
+			keep[name] = true
+			kept = append(kept, name)
+		}
+	}
+	for _, name := range kept {
+		for n := parent[name]; n != "" && !keep[n]; n = parent[n] {
+			keep[n] = true
+		}
+	}
+	var expired []Backup
+	for _, b := range backups {
+		if !keep[b.Name] {
+			expired = append(expired, b)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i].Time.Before(expired[j].Time) })
+	return expired
+}
+
+// keep 返回一个系列中要保留的备份名。
+func (p Policy) keep(list []Backup, now time.Time) map[string]bool {
+	sort.Slice(list, func(i, j int) bool { return list[i].Time.After(list[j].Time) })
+	keep := map[string]bool{}
+	cutoff := now.AddDate(0, 0, -p.Days)
+	newest := true
+	for _, b := range list {
+		if p.Days > 0 && b.Time.After(cutoff) {
+			keep[b.Name] = true
+		}
+		if newest {
+			keep[b.Name] = true
+			newest = !b.Complete
+		}
+	}
+	rules := []struct {
+		n   int
+		key func(t time.Time) string
+	}{
+		{p.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{p.Weekly, func(t time.Time) string {
+			y, w := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", y, w)
+		}},
+		{p.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+		{p.Yearly, func(t time.Time) string { return t.Format("2006") }},
+	}
+	for _, r := range rules {
+		seen := map[string]bool{}
+		for _, b := range list {
+			if len(seen) >= r.n {
+				break
+			}
+			if !b.Complete {
+				continue
+			}
+			if k := r.key(b.Time); !seen[k] {
+				seen[k] = true
+				keep[b.Name] = true
+			}
+		}
+	}
+	return keep
+}
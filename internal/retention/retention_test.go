@@ -0,0 +1,128 @@
+package retention
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// bk 返回一份备份，备份名为“系列@时间”。
+func bk(series, at string, complete bool) Backup {
+	t, err := time.Parse("2006-01-02 15:04", at)
+	if err != nil {
+		panic(err)
+	}
+	return Backup{Name: series + "@" + at, Series: series, Time: t, Complete: complete}
+}
+
+func full(at string) Backup { return bk("db", at, true) }
+
+// incr 返回一份基线为 parent 的增量备份。
+func incr(at string, complete bool, parent string) Backup {
+	b := bk("db", at, complete)
+	b.Parent = parent
+	return b
+}
+
+func TestExpired(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		policy  Policy
+		now     string
+		backups []Backup
+		want    []string // 过期的备份名，按时间排序
+	}{
+		{"keep all", Policy{}, "2024-03-31 12:00", []Backup{
+			full("2020-01-01 02:00"), full("2024-03-31 02:00"),
+		}, nil},
+		// 截止时间本身不在保留范围内
+		{"days boundary", Policy{Days: 7}, "2024-03-31 12:00", []Backup{
+			full("2024-03-24 11:59"), full("2024-03-24 12:00"), full("2024-03-24 12:01"), full("2024-03-31 02:00"),
+		}, []string{"db@2024-03-24 11:59", "db@2024-03-24 12:00"}},
+		{"daily newest of each day", Policy{Daily: 2}, "2024-03-31 12:00", []Backup{
+			full("2024-03-29 01:00"), full("2024-03-29 23:00"), full("2024-03-30 00:00"), full("2024-03-30 23:59"), full("2024-03-31 01:00"),
+		}, []string{"db@2024-03-29 01:00", "db@2024-03-29 23:00", "db@2024-03-30 00:00"}},
+		// 只计算有备份的日子，中间没有备份的日子不占名额
+		{"daily skips empty days", Policy{Daily: 2}, "2024-03-31 12:00", []Backup{
+			full("2024-03-01 02:00"), full("2024-03-10 02:00"), full("2024-03-31 02:00"),
+		}, []string{"db@2024-03-01 02:00"}},
+		// 2024-03-31 是周日，周一 03-25 起为新的一周
+		{"weekly monday start", Policy{Weekly: 2}, "2024-03-31 12:00", []Backup{
+			full("2024-03-23 02:00"), full("2024-03-24 23:00"), full("2024-03-25 00:30"), full("2024-03-31 01:00"),
+		}, []string{"db@2024-03-23 02:00", "db@2024-03-25 00:30"}},
+		// 2024-12-30 属于 ISO 2025-W01
+		{"weekly across years", Policy{Weekly: 2}, "2025-01-06 12:00", []Backup{
+			full("2024-12-29 02:00"), full("2024-12-30 02:00"), full("2025-01-05 02:00"),
+		}, []string{"db@2024-12-30 02:00"}},
+		{"monthly boundary", Policy{Monthly: 2}, "2024-03-31 12:00", []Backup{
+			full("2024-01-31 23:59"), full("2024-02-01 00:00"), full("2024-02-29 23:00"), full("2024-03-01 00:00"),
+		}, []string{"db@2024-01-31 23:59", "db@2024-02-01 00:00"}},
+		{"yearly boundary", Policy{Yearly: 2}, "2024-03-31 12:00", []Backup{
+			full("2022-12-31 23:00"), full("2023-01-01 00:00"), full("2023-12-31 23:00"), full("2024-01-01 00:00"),
+		}, []string{"db@2022-12-31 23:00", "db@2023-01-01 00:00"}},
+		// 各规则取并集
+		{"union of rules", Policy{Daily: 1, Monthly: 2}, "2024-03-31 12:00", []Backup{
+			full("2024-02-10 02:00"), full("2024-02-20 02:00"), full("2024-03-30 02:00"), full("2024-03-31 02:00"),
+		}, []string{"db@2024-02-10 02:00", "db@2024-03-30 02:00"}},
+		// 失败的备份不占用名额，也不会因为是当天最新的而保留
+		{"incomplete not counted", Policy{Daily: 2}, "2024-03-31 12:00", []Backup{
+			full("2024-03-28 02:00"), full("2024-03-29 02:00"), bk("db", "2024-03-30 02:00", false), full("2024-03-31 02:00"),
+		}, []string{"db@2024-03-28 02:00", "db@2024-03-30 02:00"}},
+		// 比最新完整备份更新的未完成备份可能还在进行中
+		{"running backups kept", Policy{Daily: 1}, "2024-03-31 12:00", []Backup{
+			full("2024-03-29 02:00"), full("2024-03-30 02:00"), bk("db", "2024-03-31 01:00", false), bk("db", "2024-03-31 02:00", false),
+		}, []string{"db@2024-03-29 02:00"}},
+		// 超出天数的最新完整备份仍然保留
+		{"newest complete kept", Policy{Days: 1}, "2024-03-31 12:00", []Backup{
+			full("2024-01-01 02:00"), full("2024-01-02 02:00"),
+		}, []string{"db@2024-01-01 02:00"}},
+		{"series independent", Policy{Daily: 1}, "2024-03-31 12:00", []Backup{
+			full("2024-03-30 02:00"), full("2024-03-31 02:00"), bk("other", "2024-03-01 02:00", true),
+		}, []string{"db@2024-03-30 02:00"}},
+		// 保留的增量备份依赖的整条链都保留
+		{"parent chain kept", Policy{Daily: 1}, "2024-03-31 12:00", []Backup{
+			full("2024-03-28 02:00"),
+			full("2024-03-29 02:00"),
+			incr("2024-03-30 02:00", true, "db@2024-03-29 02:00"),
+			incr("2024-03-31 02:00", true, "db@2024-03-30 02:00"),
+		}, []string{"db@2024-03-28 02:00"}},
+		// 差异备份只依赖全量备份，之前的差异备份可以删除
+		{"differential", Policy{Daily: 1}, "2024-03-31 12:00", []Backup{
+			full("2024-03-29 02:00"),
+			incr("2024-03-30 02:00", true, "db@2024-03-29 02:00"),
+			incr("2024-03-31 02:00", true, "db@2024-03-29 02:00"),
+		}, []string{"db@2024-03-30 02:00"}},
+		// 依赖它的备份都过期后，基线一起删除
+		{"chain expires together", Policy{Daily: 1}, "2024-03-31 12:00", []Backup{
+			full("2024-03-01 02:00"),
+			incr("2024-03-02 02:00", true, "db@2024-03-01 02:00"),
+			full("2024-03-31 02:00"),
+		}, []string{"db@2024-03-01 02:00", "db@2024-03-02 02:00"}},
+		// 保留的未完成增量备份也保留其基线
+		{"running incremental keeps parent", Policy{Daily: 1}, "2024-03-31 12:00", []Backup{
+			full("2024-03-29 02:00"),
+			full("2024-03-30 02:00"),
+			incr("2024-03-31 02:00", false, "db@2024-03-29 02:00"),
+		}, nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			now, _ := time.Parse("2006-01-02 15:04", tt.now)
+			var got []string
+			for _, b := range tt.policy.Expired(tt.backups, now) {
+				got = append(got, b.Name)
+			}
+			if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("Expired = [%s], want [%s]", strings.Join(got, ", "), strings.Join(tt.want, ", "))
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := (Policy{Days: 7, Weekly: 4}).Validate(); err != nil {
+		t.Error(err)
+	}
+	if err := (Policy{Monthly: -1}).Validate(); err == nil {
+		t.Error("negative monthly accepted")
+	}
+}
@@ -0,0 +1,235 @@
+// Package schedule 解析 cron 表达式，并按表达式定时执行任务，供两个程序的 daemon 模式使用。
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule 解析后的 cron 表达式（分 时 日 月 周）。
+type Schedule struct {
+	spec                          string
+	minute, hour, dom, month, dow uint64 // 每个取值对应一位
+	domAny, dowAny                bool   // 日、周字段以 * 开头（如 * 或 */2），用于判断两者是“或”还是“且”
+}
+
+type field struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = field{min: 0, max: 59}
+	hourField   = field{min: 0, max: 23}
+	domField    = field{min: 1, max: 31}
+	monthField  = field{min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = field{min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse 解析标准 5 段 cron 表达式，支持 *、列表、范围、步长、月份和星期英文缩写，
+// 以及 @daily、@hourly 等简写。日和周都不以 * 开头时，满足其一即触发；否则两者都需满足
+// （与 cron 相同，例如 "0 0 */2 * 1" 为单数日且是周一）。
+func Parse(spec string) (*Schedule, error) {
+	expr := strings.TrimSpace(spec)
+	if d, ok := descriptors[strings.ToLower(expr)]; ok {
+		expr = d
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron %q: want 5 fields (minute hour day month weekday), got %d", spec, len(fields))
+	}
+	s := &Schedule{spec: spec}
+	var err error
+	if s.minute, err = minuteField.parse(fields[0]); err != nil {
+		return nil, fmt.Errorf("cron %q minute: %w", spec, err)
+	}
+	if s.hour, err = hourField.parse(fields[1]); err != nil {
+		return nil, fmt.Errorf("cron %q hour: %w", spec, err)
+	}
+	if s.dom, err = domField.parse(fields[2]); err != nil {
+		return nil, fmt.Errorf("cron %q day: %w", spec, err)
+	}
+	if s.month, err = monthField.parse(fields[3]); err != nil {
+		return nil, fmt.Errorf("cron %q month: %w", spec, err)
+	}
+	if s.dow, err = dowField.parse(fields[4]); err != nil {
+		return nil, fmt.Errorf("cron %q weekday: %w", spec, err)
+	}
+	// 周日可以写成 0 或 7
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny = isAny(fields[2])
+	s.dowAny = isAny(fields[4])
+	return s, nil
+}
+
+// isAny 字段是否以 * 或 ? 开头，与 cron 一样 */2 这类带步长的写法也算作不限制。
+func isAny(expr string) bool {
+	return strings.HasPrefix(expr, "*") || strings.HasPrefix(expr, "?")
+}
+
+// String 返回原始表达式。
+func (s *Schedule) String() string {
+	return s.spec
+}
+
+func (f field) parse(expr string) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(expr, ",") {
+		rng, stepStr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+		}
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*" || rng == "?":
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(a); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(b); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q", rng)
+			}
+		default:
+			v, err := f.value(rng)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			// 5/15 表示从 5 开始每 15 个单位
+			hi = v
+			if hasStep {
+				hi = f.max
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (f field) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("value %d out of range %d-%d", v, f.min, f.max)
+	}
+	return v, nil
+}
+
+// allHours 小时字段为 * 时的取值
+const allHours = 1<<24 - 1
+
+// Next 返回 t 之后（不含 t 所在的分钟）第一个满足表达式的时间，5 年内没有时返回零值。
+// 按 t 所在时区计算：夏令时开始时被跳过的时刻（例如 02:00-02:59）应执行的任务，在跳变后立即执行；
+// 夏令时结束时重复的一小时内，只有小时为 * 的表达式再次执行，固定时刻的任务不会执行两次。
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = midnight(t, t.Year(), t.Month()+1, 1)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = midnight(t, t.Year(), t.Month(), t.Day()+1)
+			continue
+		}
+		if s.skippedHour(t) {
+			return t
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = nextHour(t)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		if s.hour != allHours && repeatedHour(t) {
+			t = nextHour(t)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// midnight 返回 year-month-day 的零点。零点在夏令时跳过的时段内时，time.Date 可能换算到
+// 跳变前（不晚于 t），此时顺延到跳变后，保证 Next 总是向前查找。
+func midnight(t time.Time, year int, month time.Month, day int) time.Time {
+	next := time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	for !next.After(t) {
+		next = next.Add(time.Hour)
+	}
+	return next
+}
+
+// nextHour 返回 t 之后的下一个整点。按经过的分钟计算而不用 time.Date，
+// 后者对夏令时跳过的时刻可能换算到更早的时间。
+func nextHour(t time.Time) time.Time {
+	return t.Add(time.Duration(60-t.Minute()) * time.Minute)
+}
+
+// skippedHour t 是否紧接在夏令时跳过的时段之后，且被跳过的某个小时满足表达式。
+func (s *Schedule) skippedHour(t time.Time) bool {
+	prev := t.Add(-time.Minute)
+	from := prev.Hour() + 1
+	if prev.Day() != t.Day() {
+		from = 0
+	}
+	for h := from; h < t.Hour(); h++ {
+		if s.hour&(1<<uint(h)) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// repeatedHour t 是否在夏令时结束时第二次经过的一小时内。
+func repeatedHour(t time.Time) bool {
+	prev := t.Add(-time.Hour)
+	return prev.Hour() == t.Hour() && prev.Day() == t.Day()
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
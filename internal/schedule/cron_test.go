@@ -0,0 +1,122 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // 测试夏令时不依赖系统的时区数据
+)
+
+func TestParse(t *testing.T) {
+	for _, tt := range []struct {
+		spec string
+		ok   bool
+	}{
+		{"0 2 * * *", true},
+		{"*/15 * * * *", true},
+		{"0 2 1-7 * mon", true},
+		{"0 0 1,15 jan-jun,DEC *", true},
+		{"5/10 1-5/2 ? * sun,7", true},
+		{"@daily", true},
+		{"@Weekly", true},
+		{"0 2 * *", false},
+		{"0 2 * * * *", false},
+		{"60 * * * *", false},
+		{"* 24 * * *", false},
+		{"* * 0 * *", false},
+		{"* * 32 * *", false},
+		{"* * * 13 *", false},
+		{"* * * * 8", false},
+		{"*/0 * * * *", false},
+		{"*/x * * * *", false},
+		{"5-1 * * * *", false},
+		{"* * * foo *", false},
+		{"@reboot", false},
+	} {
+		_, err := Parse(tt.spec)
+		if tt.ok != (err == nil) {
+			t.Errorf("Parse(%q) error = %v, want ok %v", tt.spec, err, tt.ok)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	santiago, err := time.LoadLocation("America/Santiago")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(loc *time.Location, s string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04", s, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	for _, tt := range []struct {
+		name string
+		spec string
+		loc  *time.Location
+		from string
+		want []string // 依次调用 Next 得到的时间（UTC）
+	}{
+		{"daily", "0 2 * * *", time.UTC, "2024-01-01 00:00", []string{"2024-01-01 02:00", "2024-01-02 02:00"}},
+		{"not the same minute", "0 2 * * *", time.UTC, "2024-01-01 02:00", []string{"2024-01-02 02:00"}},
+		{"step", "*/20 9 * * *", time.UTC, "2024-01-01 09:30", []string{"2024-01-01 09:40", "2024-01-02 09:00"}},
+		{"start with step", "5/20 * * * *", time.UTC, "2024-01-01 00:00", []string{"2024-01-01 00:05", "2024-01-01 00:25", "2024-01-01 00:45", "2024-01-01 01:05"}},
+		{"month end", "0 0 31 * *", time.UTC, "2024-02-01 00:00", []string{"2024-03-31 00:00", "2024-05-31 00:00"}},
+		{"leap day", "0 0 29 2 *", time.UTC, "2024-03-01 00:00", []string{"2028-02-29 00:00"}},
+		{"sunday as 7", "0 0 * * 7", time.UTC, "2024-01-01 00:00", []string{"2024-01-07 00:00"}},
+		// 2024-01-01 是周一
+		{"weekday range", "30 1 * * mon-fri", time.UTC, "2024-01-05 02:00", []string{"2024-01-08 01:30"}},
+		// 日和周都有限制时满足其一即可
+		{"dom or dow", "0 0 13 * fri", time.UTC, "2024-01-01 00:00", []string{"2024-01-05 00:00", "2024-01-12 00:00", "2024-01-13 00:00", "2024-01-19 00:00"}},
+		// 日为 * 时只看周
+		{"dow only", "0 0 * * fri", time.UTC, "2024-01-01 00:00", []string{"2024-01-05 00:00", "2024-01-12 00:00"}},
+		// 周为 * 时只看日
+		{"dom only", "0 0 13 * *", time.UTC, "2024-01-01 00:00", []string{"2024-01-13 00:00", "2024-02-13 00:00"}},
+		// */2 与 * 一样算作不限制，与周的条件同时满足：单数日且是周一
+		{"stepped dom and dow", "0 0 */2 * mon", time.UTC, "2023-12-31 23:00", []string{"2024-01-01 00:00", "2024-01-15 00:00", "2024-01-29 00:00", "2024-02-05 00:00"}},
+		// */7 为周日：每月 1 日且是周日
+		{"dom and stepped dow", "0 0 1 * */7", time.UTC, "2024-01-02 00:00", []string{"2024-09-01 00:00", "2024-12-01 00:00"}},
+		{"question mark", "0 0 ? * mon", time.UTC, "2024-01-02 00:00", []string{"2024-01-08 00:00"}},
+		{"never", "0 0 30 2 *", time.UTC, "2024-01-01 00:00", []string{""}},
+		// 纽约 2024-03-10 02:00 跳到 03:00，02:30 的任务在 03:00 执行
+		{"spring forward gap", "30 2 * * *", newYork, "2024-03-09 03:00", []string{"2024-03-10 07:00", "2024-03-11 06:30"}},
+		{"spring forward hourly", "30 * * * *", newYork, "2024-03-10 01:00", []string{"2024-03-10 06:30", "2024-03-10 07:00", "2024-03-10 07:30"}},
+		{"spring forward unaffected", "0 4 * * *", newYork, "2024-03-10 00:00", []string{"2024-03-10 08:00"}},
+		// 纽约 2024-11-03 02:00 回到 01:00，01:30 的任务只执行一次
+		{"fall back fixed", "30 1 * * *", newYork, "2024-11-03 00:00", []string{"2024-11-03 05:30", "2024-11-04 06:30"}},
+		{"fall back hourly", "30 * * * *", newYork, "2024-11-03 00:40", []string{"2024-11-03 05:30", "2024-11-03 06:30", "2024-11-03 07:30"}},
+		// 柏林 2024-03-31 02:00 跳到 03:00，配置示例中 0 2 * * * 的备份不会漏掉
+		{"berlin spring forward", "0 2 * * *", berlin, "2024-03-30 03:00", []string{"2024-03-31 01:00", "2024-04-01 00:00"}},
+		// 圣地亚哥 2024-09-08 00:00 跳到 01:00，当天没有零点
+		{"midnight gap", "0 0 * * *", santiago, "2024-09-07 12:00", []string{"2024-09-08 04:00", "2024-09-09 03:00"}},
+		{"midnight gap daily at 3", "0 3 * * *", santiago, "2024-09-07 12:00", []string{"2024-09-08 06:00"}},
+		{"berlin fall back", "0 2 * * *", berlin, "2024-10-27 00:00", []string{"2024-10-27 00:00", "2024-10-28 01:00"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cur := at(tt.loc, tt.from)
+			for i, want := range tt.want {
+				cur = s.Next(cur)
+				got := ""
+				if !cur.IsZero() {
+					got = cur.UTC().Format("2006-01-02 15:04")
+				}
+				if got != want {
+					t.Fatalf("Next #%d = %s (%s), want %s UTC", i+1, got, cur, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 上一次执行尚未结束时的处理方式。
+const (
+	OverlapSkip  = "skip"  // 跳过本次
+	OverlapQueue = "queue" // 排队，上一次结束后立即执行（同一任务最多排队一次）
+)
+
+// ValidateOverlap 检查重叠策略，空字符串视为 skip。
+func ValidateOverlap(policy string) error {
+	switch policy {
+	case "", OverlapSkip, OverlapQueue:
+		return nil
+	}
+	return fmt.Errorf("overlap must be %s or %s, got %q", OverlapSkip, OverlapQueue, policy)
+}
+
+// Job 一个定时任务。
+type Job struct {
+	Name     string
+	Schedule *Schedule
+	Lock     string // 相同 Lock 的任务不会同时执行，为空时使用 Name
+	Overlap  string // OverlapSkip 或 OverlapQueue，为空视为 skip
+	Run      func()
+}
+
+func (j *Job) lock() string {
+	if j.Lock != "" {
+		return j.Lock
+	}
+	return j.Name
+}
+
+type entry struct {
+	job  *Job
+	next time.Time
+}
+
+type lockState struct {
+	running bool
+	queue   []*Job
+}
+
+// Runner 按 cron 表达式执行任务，可在运行中用 Set 替换任务列表（例如收到 SIGHUP 重新加载配置）。
+type Runner struct {
+	logf func(format string, args ...interface{})
+
+	mu      sync.Mutex
+	entries []*entry
+	locks   map[string]*lockState
+	wake    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewRunner 创建 Runner，logf 用于输出调度日志。
+func NewRunner(logf func(format string, args ...interface{})) *Runner {
+	return &Runner{
+		logf:  logf,
+		locks: map[string]*lockState{},
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+// Set 替换全部任务。正在执行的任务不受影响，排队中的任务仍会执行。
+func (r *Runner) Set(jobs []Job) {
+	now := time.Now()
+	entries := make([]*entry, 0, len(jobs))
+	for i := range jobs {
+		job := jobs[i]
+		e := &entry{job: &job, next: job.Schedule.Next(now)}
+		entries = append(entries, e)
+		r.logf("scheduled %s (%s), next run %s", job.Name, job.Schedule, e.next.Format("2006-01-02 15:04"))
+	}
+	r.mu.Lock()
+	r.entries = entries
+	r.mu.Unlock()
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run 执行调度直到 ctx 取消，然后等待正在执行和排队的任务结束。
+func (r *Runner) Run(ctx context.Context) {
+	for {
+		r.mu.Lock()
+		var next time.Time
+		for _, e := range r.entries {
+			if !e.next.IsZero() && (next.IsZero() || e.next.Before(next)) {
+				next = e.next
+			}
+		}
+		r.mu.Unlock()
+
+		// 没有任务时只等待 Set 或退出
+		var timer *time.Timer
+		var due <-chan time.Time
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			due = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			r.logf("stopping, waiting for running jobs")
+			r.wg.Wait()
+			return
+		case <-r.wake:
+		case now := <-due:
+			r.fireDue(now)
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// fireDue 触发所有已到时间的任务并计算下一次时间。
+func (r *Runner) fireDue(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.entries {
+		if e.next.IsZero() || e.next.After(now) {
+			continue
+		}
+		r.fire(e.job)
+		e.next = e.job.Schedule.Next(now)
+	}
+}
+
+// fire 执行任务或按重叠策略跳过/排队，调用时需持有 r.mu。
+func (r *Runner) fire(job *Job) {
+	st := r.locks[job.lock()]
+	if st == nil {
+		st = &lockState{}
+		r.locks[job.lock()] = st
+	}
+	if !st.running {
+		st.running = true
+		r.start(job, st)
+		return
+	}
+	if job.Overlap != OverlapQueue {
+		r.logf("skip %s: previous run of %s still in progress", job.Name, job.lock())
+		return
+	}
+	for _, queued := range st.queue {
+		if queued.Name == job.Name {
+			r.logf("skip %s: already queued", job.Name)
+			return
+		}
+	}
+	r.logf("queue %s: previous run of %s still in progress", job.Name, job.lock())
+	st.queue = append(st.queue, job)
+}
+
+func (r *Runner) start(job *Job, st *lockState) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.logf("run %s", job.Name)
+		job.Run()
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if len(st.queue) > 0 {
+			next := st.queue[0]
+			st.queue = st.queue[1:]
+			r.start(next, st)
+			return
+		}
+		st.running = false
+	}()
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Local 本地目录（也可以是挂载的 NFS 等）。
+type Local struct {
+	root string
+}
+
+// NewLocal 返回以 root 为根目录的本地存储，root 不存在时自动创建。
+func NewLocal(root string) (*Local, error) {
+	if root == "" {
+		return nil, fmt.Errorf("local storage needs a directory")
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("create storage dir: %w", err)
+	}
+	return &Local{root: root}, nil
+}
+
+func (l *Local) path(name string) string {
+	return filepath.Join(l.root, filepath.FromSlash(path.Clean("/"+name)))
+}
+
+func (l *Local) Put(name string, r io.Reader) error {
+	dst := l.path(name)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	tmp := dst + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// PutFile 从上次中断留下的 .part 继续写入。
+func (l *Local) PutFile(name string, f *os.File) error {
+	dst := l.path(name)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	tmp := dst + ".part"
+	var offset int64
+	if st, err := os.Stat(tmp); err == nil && st.Size() <= info.Size() {
+		offset = st.Size()
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err := out.Truncate(offset); err != nil {
+		out.Close()
+		return err
+	}
+	if _, err := out.Seek(offset, io.SeekStart); err != nil {
+		out.Close()
+		return err
+	}
+	if _, err := io.Copy(out, f); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+func (l *Local) Get(name string) (io.ReadCloser, error) {
+	return os.Open(l.path(name))
+}
+
+func (l *Local) List(prefix string) ([]Object, error) {
+	var objects []Object
+	err := filepath.WalkDir(l.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(l.root, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if d.IsDir() {
+			if name != "." && !matchPrefix(name+"/", prefix) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasPrefix(name, prefix) || strings.HasSuffix(name, ".part") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, Object{Name: name, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Name < objects[j].Name })
+	return objects, err
+}
+
+// Delete 删除对象，并删除因此变空的上级目录。
+func (l *Local) Delete(name string) error {
+	p := l.path(name)
+	if err := os.Remove(p); err != nil {
+		return err
+	}
+	for dir := filepath.Dir(p); dir != filepath.Clean(l.root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (l *Local) Stat(name string) (*Object, error) {
+	info, err := os.Stat(l.path(name))
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory: %w", name, ErrNotExist)
+	}
+	return &Object{Name: name, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (l *Local) Close() error { return nil }
+
+func (l *Local) String() string { return l.root }
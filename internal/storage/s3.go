@@ -0,0 +1,581 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 默认分片大小，分片在内存中缓存并计算 SHA-256
+	s3DefaultPartSize = 16 << 20
+	// S3 要求除最后一片外每片至少 5 MiB
+	s3MinPartSize = 5 << 20
+	// 每上传这么多片分片大小翻倍，单个对象最多 10000 片
+	s3PartsPerStep = 1000
+	s3Retries      = 3
+)
+
+// S3 S3 兼容的对象存储（AWS S3、MinIO 等），对象名为 <prefix>/<name>。
+type S3 struct {
+	endpoint  *url.URL
+	bucket    string
+	prefix    string
+	pathStyle bool
+	partSize  int
+	signer    *signer
+	client    *http.Client
+
+	mu sync.Mutex
+	// 本进程分片上传且 S3 返回的组合校验和与上传的数据一致的对象：key -> 组合校验和和整个对象的 SHA-256
+	verified map[string][2]string
+}
+
+// S3Config S3 存储的参数，未填写的密钥和区域从 AWS_ACCESS_KEY_ID、AWS_SECRET_ACCESS_KEY、
+// AWS_SESSION_TOKEN、AWS_REGION 环境变量读取。
+type S3Config struct {
+	Endpoint   string `json:"endpoint"`     // 例如 http://minio:9000，为空时使用 AWS
+	Region     string `json:"region"`       // 默认 us-east-1
+	AccessKey  string `json:"access_key"`   // 访问密钥 ID
+	SecretKey  string `json:"secret_key"`   // 访问密钥
+	PathStyle  bool   `json:"path_style"`   // 使用 endpoint/bucket/key 形式的地址，MinIO 通常需要
+	PartSizeMB int    `json:"part_size_mb"` // 分片大小，默认 16，最小 5
+}
+
+// newS3 由 s3://bucket/prefix 形式的 URL 创建存储。URL 的查询参数 endpoint、region、
+// path_style 可代替配置，便于命令行使用。
+func newS3(u *url.URL, cfg S3Config) (*S3, error) {
+	if u.Host == "" {
+		return nil, errors.New("s3 url needs a bucket, e.g. s3://bucket/prefix")
+	}
+	q := u.Query()
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = q.Get("endpoint")
+	}
+	if cfg.Region == "" {
+		cfg.Region = q.Get("region")
+	}
+	if !cfg.PathStyle {
+		cfg.PathStyle, _ = strconv.ParseBool(q.Get("path_style"))
+	}
+	if cfg.Region == "" {
+		cfg.Region = firstEnv("AWS_REGION", "AWS_DEFAULT_REGION")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.AccessKey == "" {
+		cfg.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if cfg.SecretKey == "" {
+		cfg.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("s3 needs access_key and secret_key (or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY)")
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", cfg.Endpoint)
+	}
+	partSize := s3DefaultPartSize
+	if cfg.PartSizeMB > 0 {
+		partSize = cfg.PartSizeMB << 20
+	}
+	if partSize < s3MinPartSize {
+		return nil, fmt.Errorf("s3 part_size_mb must be at least %d", s3MinPartSize>>20)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = 5 * time.Minute
+	return &S3{
+		endpoint:  endpoint,
+		bucket:    u.Host,
+		prefix:    strings.Trim(u.Path, "/"),
+		pathStyle: cfg.PathStyle,
+		partSize:  partSize,
+		verified:  map[string][2]string{},
+		signer: &signer{
+			accessKey:    cfg.AccessKey,
+			secretKey:    cfg.SecretKey,
+			sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+			region:       cfg.Region,
+			service:      "s3",
+		},
+		client: &http.Client{Transport: transport},
+	}, nil
+}
+
+// validateS3 检查 bucket、endpoint 和分片大小，密钥在连接时才检查（可能来自运行时的环境变量）。
+func validateS3(u *url.URL, cfg S3Config) error {
+	if u.Host == "" {
+		return errors.New("s3 url needs a bucket, e.g. s3://bucket/prefix")
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = u.Query().Get("endpoint")
+	}
+	if endpoint != "" {
+		e, err := url.Parse(endpoint)
+		if err != nil || e.Host == "" || (e.Scheme != "http" && e.Scheme != "https") {
+			return fmt.Errorf("invalid s3 endpoint %q", endpoint)
+		}
+	}
+	if cfg.PartSizeMB != 0 && cfg.PartSizeMB < s3MinPartSize>>20 {
+		return fmt.Errorf("s3 part_size_mb must be at least %d", s3MinPartSize>>20)
+	}
+	return nil
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (s *S3) key(name string) string {
+	return strings.TrimPrefix(path.Join(s.prefix, path.Clean("/"+name)), "/")
+}
+
+// url 返回对象 key 的地址，key 为空时为 bucket 本身。
+func (s *S3) url(key string, query url.Values) *url.URL {
+	u := *s.endpoint
+	p := strings.TrimSuffix(u.Path, "/")
+	if s.pathStyle {
+		p += "/" + s.bucket
+	} else {
+		u.Host = s.bucket + "." + u.Host
+	}
+	if key != "" || !s.pathStyle {
+		p += "/" + key
+	}
+	u.Path = p
+	u.RawPath = uriEncode(p, false)
+	u.RawQuery = encodeQuery(query)
+	return &u
+}
+
+// Put 小于一个分片的对象直接上传，否则使用分片上传，内存中最多缓存一个分片。
+// 直接上传时附带 x-amz-checksum-sha256，分片上传时每个分片附带各自的 SHA-256，都由 S3 校验后保存。
+func (s *S3) Put(name string, r io.Reader) error {
+	key := s.key(name)
+	buf := make([]byte, s.partSize)
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		sum := sha256.Sum256(buf[:n])
+		header := http.Header{"X-Amz-Checksum-Sha256": {base64.StdEncoding.EncodeToString(sum[:])}}
+		_, err = s.do(http.MethodPut, key, nil, header, buf[:n], nil)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	uploadID, err := s.createMultipart(key)
+	if err != nil {
+		return err
+	}
+	if err := s.uploadParts(key, uploadID, r, buf, nil); err != nil {
+		// 未完成的分片会一直占用空间，尽量清理
+		s.do(http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil, nil)
+		return err
+	}
+	return nil
+}
+
+// PutFile 小于一个分片的文件直接上传；否则继续同名对象未完成的分片上传，已上传且 S3 保存的
+// SHA-256 与本地一致的分片不再重传。失败时不取消分片上传，以便下次继续，
+// 放弃的分片上传需要用 bucket 的生命周期规则（AbortIncompleteMultipartUpload）清理。
+func (s *S3) PutFile(name string, f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if info.Size() < int64(s.partSize) {
+		return s.Put(name, f)
+	}
+
+	key := s.key(name)
+	uploadID, err := s.findMultipart(key)
+	if err != nil {
+		return err
+	}
+	var uploaded map[int]completedPart
+	if uploadID != "" {
+		if uploaded, err = s.listParts(key, uploadID); errors.Is(err, ErrNotExist) {
+			uploadID = "" // 刚好被清理
+		} else if err != nil {
+			return err
+		}
+	}
+	if uploadID == "" {
+		if uploadID, err = s.createMultipart(key); err != nil {
+			return err
+		}
+	}
+	buf := make([]byte, s.partSize)
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return err
+	}
+	return s.uploadParts(key, uploadID, f, buf, uploaded)
+}
+
+// findMultipart 返回 key 最近一次使用 SHA-256 校验的未完成分片上传 ID，没有时返回空。
+// 其他分片上传（旧版本或其他工具创建的）的分片没有校验和，不能确认内容，不续传。
+func (s *S3) findMultipart(key string) (string, error) {
+	var result struct {
+		Uploads []struct {
+			Key               string    `xml:"Key"`
+			UploadID          string    `xml:"UploadId"`
+			Initiated         time.Time `xml:"Initiated"`
+			ChecksumAlgorithm string    `xml:"ChecksumAlgorithm"`
+		} `xml:"Upload"`
+	}
+	if _, err := s.do(http.MethodGet, "", url.Values{"uploads": {""}, "prefix": {key}}, nil, nil, &result); err != nil {
+		return "", fmt.Errorf("list multipart uploads: %w", err)
+	}
+	var id string
+	var latest time.Time
+	for _, u := range result.Uploads {
+		if u.Key == key && u.ChecksumAlgorithm == "SHA256" && (id == "" || u.Initiated.After(latest)) {
+			id, latest = u.UploadID, u.Initiated
+		}
+	}
+	return id, nil
+}
+
+// listParts 返回分片上传中已上传的分片。
+func (s *S3) listParts(key, uploadID string) (map[int]completedPart, error) {
+	parts := map[int]completedPart{}
+	marker := ""
+	for {
+		query := url.Values{"uploadId": {uploadID}}
+		if marker != "" {
+			query.Set("part-number-marker", marker)
+		}
+		var result struct {
+			Parts                []completedPart `xml:"Part"`
+			IsTruncated          bool            `xml:"IsTruncated"`
+			NextPartNumberMarker string          `xml:"NextPartNumberMarker"`
+		}
+		if _, err := s.do(http.MethodGet, key, query, nil, nil, &result); err != nil {
+			return nil, fmt.Errorf("list parts: %w", err)
+		}
+		for _, p := range result.Parts {
+			parts[p.PartNumber] = p
+		}
+		if !result.IsTruncated || result.NextPartNumberMarker == "" {
+			return parts, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
+
+type completedPart struct {
+	PartNumber     int    `xml:"PartNumber"`
+	ETag           string `xml:"ETag"`
+	ChecksumSHA256 string `xml:"ChecksumSHA256"`
+}
+
+// uploadParts 依次上传分片并完成分片上传，buf 中已有第一片的数据。uploaded 为续传时
+// 已上传的分片，S3 保存的 SHA-256 与本地一致的跳过。S3 返回的组合校验和与上传的各分片
+// 一致时，记录整个对象的 SHA-256 供 SHA256 使用；不一致时返回包装了 ErrMismatch 的错误。
+func (s *S3) uploadParts(key, uploadID string, r io.Reader, buf []byte, uploaded map[int]completedPart) error {
+	var parts []completedPart
+	// 对象由这里读到的数据组成：h 为整个对象的 SHA-256，sums 为各分片的 SHA-256
+	h := sha256.New()
+	var sums []byte
+	n := len(buf)
+	for number := 1; ; number++ {
+		h.Write(buf[:n])
+		sum := sha256.Sum256(buf[:n])
+		sums = append(sums, sum[:]...)
+		checksum := base64.StdEncoding.EncodeToString(sum[:])
+		if p, ok := uploaded[number]; ok && p.ChecksumSHA256 == checksum {
+			parts = append(parts, p)
+		} else {
+			query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+			header := http.Header{"X-Amz-Checksum-Sha256": {checksum}}
+			resp, err := s.do(http.MethodPut, key, query, header, buf[:n], nil)
+			if err != nil {
+				return fmt.Errorf("upload part %d: %w", number, err)
+			}
+			parts = append(parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag"), ChecksumSHA256: checksum})
+		}
+		if n < len(buf) {
+			break
+		}
+		if number%s3PartsPerStep == 0 {
+			buf = make([]byte, 2*len(buf))
+		}
+		var err error
+		n, err = io.ReadFull(r, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	// CompleteMultipartUpload 出错时也可能返回 200，需要检查响应体
+	var result struct {
+		XMLName        xml.Name
+		Code           string `xml:"Code"`
+		Message        string `xml:"Message"`
+		ChecksumSHA256 string `xml:"ChecksumSHA256"`
+	}
+	if _, err := s.do(http.MethodPost, key, url.Values{"uploadId": {uploadID}}, nil, body, &result); err != nil {
+		return fmt.Errorf("complete multipart upload: %w", err)
+	}
+	if result.XMLName.Local == "Error" {
+		return fmt.Errorf("complete multipart upload: %s: %s", result.Code, result.Message)
+	}
+	// 不支持校验和的 S3 兼容存储不返回组合校验和，校验时下载对象
+	if result.ChecksumSHA256 == "" {
+		return nil
+	}
+	composite := compositeChecksum(sums, len(parts))
+	if result.ChecksumSHA256 != composite {
+		return fmt.Errorf("complete multipart upload %s: checksum %s, want %s: %w", key, result.ChecksumSHA256, composite, ErrMismatch)
+	}
+	s.mu.Lock()
+	s.verified[key] = [2]string{composite, hex.EncodeToString(h.Sum(nil))}
+	s.mu.Unlock()
+	return nil
+}
+
+// compositeChecksum 返回 S3 分片上传对象的组合校验和：各分片 SHA-256 拼接后的 SHA-256，后接分片数。
+func compositeChecksum(sums []byte, parts int) string {
+	sum := sha256.Sum256(sums)
+	return base64.StdEncoding.EncodeToString(sum[:]) + "-" + strconv.Itoa(parts)
+}
+
+// SHA256 返回对象的十六进制 SHA-256，不下载对象：直接上传的对象取 S3 校验过的
+// x-amz-checksum-sha256；分片上传的对象只有组合校验和，仅当对象是本进程上传、S3 的组合校验和
+// 与上传时一致时返回上传数据的 SHA-256。其他情况返回 errors.ErrUnsupported，由调用方下载计算。
+func (s *S3) SHA256(name string) (string, error) {
+	key := s.key(name)
+	resp, err := s.do(http.MethodHead, key, nil, http.Header{"X-Amz-Checksum-Mode": {"ENABLED"}}, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	v := resp.Header.Get("X-Amz-Checksum-Sha256")
+	if v == "" {
+		return "", errors.ErrUnsupported
+	}
+	if strings.Contains(v, "-") {
+		s.mu.Lock()
+		up, ok := s.verified[key]
+		s.mu.Unlock()
+		if ok && up[0] == v {
+			return up[1], nil
+		}
+		return "", errors.ErrUnsupported
+	}
+	sum, err := base64.StdEncoding.DecodeString(v)
+	if err != nil || len(sum) != sha256.Size {
+		return "", errors.ErrUnsupported
+	}
+	return hex.EncodeToString(sum), nil
+}
+
+func (s *S3) createMultipart(key string) (string, error) {
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	// 要求 S3 按 SHA-256 校验各分片并保存组合校验和
+	header := http.Header{"X-Amz-Checksum-Algorithm": {"SHA256"}}
+	if _, err := s.do(http.MethodPost, key, url.Values{"uploads": {""}}, header, nil, &result); err != nil {
+		return "", fmt.Errorf("create multipart upload: %w", err)
+	}
+	if result.UploadID == "" {
+		return "", errors.New("create multipart upload: empty upload id")
+	}
+	return result.UploadID, nil
+}
+
+func (s *S3) Get(name string) (io.ReadCloser, error) {
+	resp, err := s.send(http.MethodGet, s.key(name), nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3) List(prefix string) ([]Object, error) {
+	base := ""
+	if s.prefix != "" {
+		base = s.prefix + "/"
+	}
+	var objects []Object
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {base + prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		var result struct {
+			Contents []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		if _, err := s.do(http.MethodGet, "", query, nil, nil, &result); err != nil {
+			return nil, err
+		}
+		for _, c := range result.Contents {
+			if strings.HasSuffix(c.Key, "/") {
+				continue // 控制台创建的“目录”
+			}
+			objects = append(objects, Object{Name: strings.TrimPrefix(c.Key, base), Size: c.Size, ModTime: c.LastModified})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Name < objects[j].Name })
+	return objects, nil
+}
+
+func (s *S3) Delete(name string) error {
+	_, err := s.do(http.MethodDelete, s.key(name), nil, nil, nil, nil)
+	return err
+}
+
+func (s *S3) Stat(name string) (*Object, error) {
+	resp, err := s.do(http.MethodHead, s.key(name), nil, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &Object{Name: name, Size: resp.ContentLength, ModTime: modTime}, nil
+}
+
+func (s *S3) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+func (s *S3) String() string {
+	return "s3://" + path.Join(s.bucket, s.prefix)
+}
+
+// do 发送请求并读取响应体，result 不为空时按 XML 解析。
+func (s *S3) do(method, key string, query url.Values, header http.Header, body []byte, result interface{}) (*http.Response, error) {
+	resp, err := s.send(method, key, query, header, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if result != nil {
+		if err := xml.Unmarshal(data, result); err != nil {
+			return nil, fmt.Errorf("parse s3 response: %w", err)
+		}
+	}
+	return resp, nil
+}
+
+// send 发送签名后的请求，header 为额外的请求头，网络错误和 5xx 时重试，返回状态码为 2xx 的响应。
+func (s *S3) send(method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	payloadHash := emptySHA256
+	if body != nil {
+		payloadHash = hexSHA256(body)
+	}
+	var lastErr error
+	for attempt := 0; attempt < s3Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		req, err := http.NewRequest(method, s.url(key, query).String(), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		req.ContentLength = int64(len(body))
+		if len(body) == 0 {
+			req.Body = http.NoBody
+		}
+		s.signer.sign(req, payloadHash, time.Now())
+		resp, err := s.client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode/100 == 2 {
+			return resp, nil
+		}
+		lastErr = responseError(resp, path.Join(s.bucket, key))
+		resp.Body.Close()
+		if resp.StatusCode < 500 {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// s3Error S3 返回的错误。
+type s3Error struct {
+	status  int
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+	key     string
+}
+
+func (e *s3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3 %s: HTTP %d", e.key, e.status)
+	}
+	return fmt.Sprintf("s3 %s: %s: %s", e.key, e.Code, e.Message)
+}
+
+func (e *s3Error) Is(target error) bool {
+	return target == ErrNotExist && e.status == http.StatusNotFound
+}
+
+// responseError 由非 2xx 响应生成错误，key 用于错误信息。
+func responseError(resp *http.Response, key string) error {
+	e := &s3Error{status: resp.StatusCode, key: key}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	xml.Unmarshal(data, e)
+	return e
+}
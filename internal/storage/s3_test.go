@@ -0,0 +1,510 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 实现测试用到的 S3 接口（path style），只检查请求已签名，不校验签名本身。
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string]*fakeObject
+	uploads  map[string]*fakeUpload
+	nextID   int
+	failPart int            // 不为 0 时该分片号的上传返回 403，模拟中断
+	failDone bool           // CompleteMultipartUpload 返回 200 和错误内容
+	badSum   bool           // CompleteMultipartUpload 返回错误的组合校验和
+	noSums   bool           // 模拟不支持校验和的 S3 兼容存储，忽略校验和相关的请求头
+	requests map[string]int // 各类请求的次数
+}
+
+type fakeObject struct {
+	data     []byte
+	checksum string // x-amz-checksum-sha256，分片上传的对象为组合校验和
+}
+
+type fakeUpload struct {
+	key       string
+	initiated time.Time
+	checksum  bool // 以 x-amz-checksum-algorithm: SHA256 创建
+	parts     map[int][]byte
+}
+
+func base64SHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: map[string]*fakeObject{}, uploads: map[string]*fakeUpload{}, requests: map[string]int{}}
+}
+
+// newTestS3 启动 fakeS3 并返回连接它的 S3，分片大小为 partSize。
+func newTestS3(t *testing.T, fake *fakeS3, partSize int) *S3 {
+	t.Helper()
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse("s3://bkt/backups")
+	s, err := newS3(u, S3Config{Endpoint: srv.URL, AccessKey: "AKID", SecretKey: "SECRET", PathStyle: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.partSize = partSize
+	return s
+}
+
+func md5ETag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		http.Error(w, "unsigned", http.StatusForbidden)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	if hexSHA256(body) != r.Header.Get("X-Amz-Content-Sha256") {
+		http.Error(w, "bad payload hash", http.StatusBadRequest)
+		return
+	}
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/bkt"), "/")
+	q := r.URL.Query()
+	_, hasUploads := q["uploads"]
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	xmlReply := func(v interface{}) {
+		data, _ := xml.Marshal(v)
+		w.Write(data)
+	}
+	switch {
+	case r.Method == http.MethodGet && key == "" && hasUploads:
+		f.requests["ListMultipartUploads"]++
+		type upload struct {
+			Key               string
+			UploadId          string
+			Initiated         time.Time
+			ChecksumAlgorithm string `xml:",omitempty"`
+		}
+		var res struct {
+			XMLName xml.Name `xml:"ListMultipartUploadsResult"`
+			Upload  []upload
+		}
+		for id, u := range f.uploads {
+			if strings.HasPrefix(u.key, q.Get("prefix")) {
+				alg := ""
+				if u.checksum {
+					alg = "SHA256"
+				}
+				res.Upload = append(res.Upload, upload{u.key, id, u.initiated, alg})
+			}
+		}
+		xmlReply(res)
+	case r.Method == http.MethodGet && key == "":
+		f.requests["ListObjects"]++
+		type content struct {
+			Key          string
+			Size         int64
+			LastModified time.Time
+		}
+		var res struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Contents []content
+		}
+		for k, o := range f.objects {
+			if strings.HasPrefix(k, q.Get("prefix")) {
+				res.Contents = append(res.Contents, content{k, int64(len(o.data)), time.Now()})
+			}
+		}
+		sort.Slice(res.Contents, func(i, j int) bool { return res.Contents[i].Key < res.Contents[j].Key })
+		xmlReply(res)
+	case r.Method == http.MethodPost && hasUploads:
+		f.requests["CreateMultipartUpload"]++
+		f.nextID++
+		id := fmt.Sprintf("upload-%d", f.nextID)
+		checksum := !f.noSums && r.Header.Get("X-Amz-Checksum-Algorithm") == "SHA256"
+		f.uploads[id] = &fakeUpload{key: key, initiated: time.Now(), checksum: checksum, parts: map[int][]byte{}}
+		xmlReply(struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			UploadId string
+		}{UploadId: id})
+	case r.Method == http.MethodPut && q.Get("uploadId") != "":
+		f.requests["UploadPart"]++
+		u := f.uploads[q.Get("uploadId")]
+		number, _ := strconv.Atoi(q.Get("partNumber"))
+		if u == nil {
+			http.Error(w, "NoSuchUpload", http.StatusNotFound)
+			return
+		}
+		if number == f.failPart {
+			http.Error(w, "AccessDenied", http.StatusForbidden)
+			return
+		}
+		if v := r.Header.Get("X-Amz-Checksum-Sha256"); v != "" && !f.noSums && v != base64SHA256(body) {
+			http.Error(w, "BadDigest", http.StatusBadRequest)
+			return
+		}
+		u.parts[number] = body
+		w.Header().Set("ETag", md5ETag(body))
+	case r.Method == http.MethodGet && q.Get("uploadId") != "":
+		f.requests["ListParts"]++
+		u := f.uploads[q.Get("uploadId")]
+		if u == nil {
+			http.Error(w, "NoSuchUpload", http.StatusNotFound)
+			return
+		}
+		type part struct {
+			PartNumber     int
+			ETag           string
+			ChecksumSHA256 string `xml:",omitempty"`
+		}
+		var res struct {
+			XMLName xml.Name `xml:"ListPartsResult"`
+			Part    []part
+		}
+		for n, data := range u.parts {
+			p := part{PartNumber: n, ETag: md5ETag(data)}
+			if u.checksum {
+				p.ChecksumSHA256 = base64SHA256(data)
+			}
+			res.Part = append(res.Part, p)
+		}
+		sort.Slice(res.Part, func(i, j int) bool { return res.Part[i].PartNumber < res.Part[j].PartNumber })
+		xmlReply(res)
+	case r.Method == http.MethodPost && q.Get("uploadId") != "":
+		f.requests["CompleteMultipartUpload"]++
+		u := f.uploads[q.Get("uploadId")]
+		var req struct {
+			Part []struct {
+				PartNumber     int
+				ETag           string
+				ChecksumSHA256 string
+			}
+		}
+		if u == nil || xml.Unmarshal(body, &req) != nil {
+			http.Error(w, "bad complete", http.StatusBadRequest)
+			return
+		}
+		if f.failDone {
+			xmlReply(struct {
+				XMLName xml.Name `xml:"Error"`
+				Code    string
+				Message string
+			}{Code: "InternalError", Message: "try again"})
+			return
+		}
+		var data, sums []byte
+		for i, p := range req.Part {
+			part, ok := u.parts[p.PartNumber]
+			badSum := u.checksum && p.ChecksumSHA256 != base64SHA256(part)
+			if !ok || p.PartNumber != i+1 || p.ETag != md5ETag(part) || badSum {
+				// S3 出错时也可能返回 200
+				xmlReply(struct {
+					XMLName xml.Name `xml:"Error"`
+					Code    string
+					Message string
+				}{Code: "InvalidPart", Message: fmt.Sprintf("part %d", p.PartNumber)})
+				return
+			}
+			data = append(data, part...)
+			sum := sha256.Sum256(part)
+			sums = append(sums, sum[:]...)
+		}
+		delete(f.uploads, q.Get("uploadId"))
+		o := &fakeObject{data: data}
+		if u.checksum {
+			// 分片上传的对象只有组合校验和
+			o.checksum = base64SHA256(sums) + "-" + strconv.Itoa(len(req.Part))
+		}
+		f.objects[key] = o
+		res := struct {
+			XMLName        xml.Name `xml:"CompleteMultipartUploadResult"`
+			ChecksumSHA256 string   `xml:",omitempty"`
+		}{ChecksumSHA256: o.checksum}
+		if f.badSum {
+			res.ChecksumSHA256 = base64SHA256(nil) + "-" + strconv.Itoa(len(req.Part))
+		}
+		xmlReply(res)
+	case r.Method == http.MethodDelete && q.Get("uploadId") != "":
+		f.requests["AbortMultipartUpload"]++
+		delete(f.uploads, q.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		f.requests["PutObject"]++
+		o := &fakeObject{data: body}
+		if v := r.Header.Get("X-Amz-Checksum-Sha256"); v != "" && !f.noSums {
+			if v != base64SHA256(body) {
+				http.Error(w, "BadDigest", http.StatusBadRequest)
+				return
+			}
+			o.checksum = v
+		}
+		f.objects[key] = o
+	case r.Method == http.MethodHead || r.Method == http.MethodGet:
+		f.requests[r.Method+"Object"]++
+		o := f.objects[key]
+		if o == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if o.checksum != "" && r.Header.Get("X-Amz-Checksum-Mode") == "ENABLED" {
+			w.Header().Set("X-Amz-Checksum-Sha256", o.checksum)
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(o.data)))
+		if r.Method == http.MethodGet {
+			w.Write(o.data)
+		}
+	case r.Method == http.MethodDelete:
+		f.requests["DeleteObject"]++
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unsupported", http.StatusNotImplemented)
+	}
+}
+
+// testData 返回 n 字节不重复的测试数据。
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i/251)
+	}
+	return data
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestS3SHA256(t *testing.T) {
+	fake := newFakeS3()
+	s := newTestS3(t, fake, 1024)
+	small, large := testData(100), testData(3*1024+10)
+	if err := s.Put("small", bytes.NewReader(small)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("large", bytes.NewReader(large)); err != nil {
+		t.Fatal(err)
+	}
+	// 其他工具上传、没有校验和的对象
+	fake.objects["backups/other"] = &fakeObject{data: small}
+	// 另一个进程（例如 verify 模式）只能看到组合校验和
+	other := newTestS3(t, fake, 1024)
+
+	for _, tt := range []struct {
+		name string
+		s    *S3
+		data []byte
+		err  error
+	}{
+		{"small", s, small, nil},
+		{"large", s, large, nil},
+		{"other", s, nil, errors.ErrUnsupported},
+		{"small", other, small, nil},
+		{"large", other, nil, errors.ErrUnsupported},
+	} {
+		got, err := tt.s.SHA256(tt.name)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("SHA256(%s) error = %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if tt.err == nil && got != sha256Hex(tt.data) {
+			t.Errorf("SHA256(%s) = %s, want %s", tt.name, got, sha256Hex(tt.data))
+		}
+	}
+	if _, err := s.SHA256("missing"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("SHA256(missing) error = %v, want ErrNotExist", err)
+	}
+
+	// S3 确认过校验和时 Verify 不下载对象，不能确认时下载后计算
+	for _, tt := range []struct {
+		name      string
+		s         *S3
+		downloads int
+	}{
+		{"large", s, 0},
+		{"large", other, 1},
+		{"other", s, 1},
+	} {
+		before := fake.requests["GETObject"]
+		data := large
+		if tt.name == "other" {
+			data = small
+		}
+		if err := Verify(tt.s, tt.name, int64(len(data)), sha256Hex(data)); err != nil {
+			t.Errorf("Verify(%s): %v", tt.name, err)
+		}
+		if n := fake.requests["GETObject"] - before; n != tt.downloads {
+			t.Errorf("Verify(%s) downloaded the object %d time(s), want %d", tt.name, n, tt.downloads)
+		}
+	}
+	if err := Verify(s, "small", int64(len(small)), sha256Hex(large)); !errors.Is(err, ErrMismatch) {
+		t.Errorf("Verify(small) with wrong sum error = %v, want ErrMismatch", err)
+	}
+	// 对象被覆盖后组合校验和与上传时不同，下载后比对
+	o := fake.objects["backups/large"]
+	o.data = append([]byte{0xff}, o.data[1:]...)
+	o.checksum = base64SHA256(nil) + "-4"
+	if err := Verify(s, "large", int64(len(large)), sha256Hex(large)); !errors.Is(err, ErrMismatch) {
+		t.Errorf("Verify(large) after overwrite error = %v, want ErrMismatch", err)
+	}
+
+	// 组合校验和与上传的分片不一致时上传失败
+	fake.badSum = true
+	if err := s.Put("bad", bytes.NewReader(large)); !errors.Is(err, ErrMismatch) {
+		t.Errorf("Put with a wrong composite checksum error = %v, want ErrMismatch", err)
+	}
+}
+
+// 不支持校验和的存储照常上传，校验时下载对象
+func TestS3WithoutChecksums(t *testing.T) {
+	fake := newFakeS3()
+	fake.noSums = true
+	s := newTestS3(t, fake, 1024)
+	data := testData(2*1024 + 1)
+	if err := s.Put("large", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SHA256("large"); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("SHA256 error = %v, want ErrUnsupported", err)
+	}
+	before := fake.requests["GETObject"]
+	if err := Verify(s, "large", int64(len(data)), sha256Hex(data)); err != nil {
+		t.Error(err)
+	}
+	if fake.requests["GETObject"] == before {
+		t.Error("Verify did not download the object")
+	}
+}
+
+func TestS3Multipart(t *testing.T) {
+	fake := newFakeS3()
+	s := newTestS3(t, fake, 1024)
+	data := testData(3*1024 + 512)
+	if err := s.Put("db/backup.sql", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if fake.requests["CreateMultipartUpload"] != 1 || fake.requests["UploadPart"] != 4 || fake.requests["CompleteMultipartUpload"] != 1 {
+		t.Errorf("requests = %v, want 1 create, 4 parts and 1 complete", fake.requests)
+	}
+	r, err := s.Get("db/backup.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(r)
+	r.Close()
+	if !bytes.Equal(got, data) {
+		t.Errorf("Get returned %d bytes, want the uploaded %d bytes", len(got), len(data))
+	}
+	if o, err := s.Stat("db/backup.sql"); err != nil || o.Size != int64(len(data)) {
+		t.Errorf("Stat = %+v, %v", o, err)
+	}
+	objects, err := s.List("db/")
+	if err != nil || len(objects) != 1 || objects[0].Name != "db/backup.sql" {
+		t.Errorf("List = %+v, %v", objects, err)
+	}
+
+	// 流式上传失败时取消分片上传
+	fake.failPart = 2
+	if err := s.Put("db/failed.sql", bytes.NewReader(data)); err == nil {
+		t.Error("Put succeeded with a failing part")
+	}
+	if len(fake.uploads) != 0 {
+		t.Errorf("%d multipart upload(s) left after a failed Put", len(fake.uploads))
+	}
+
+	// CompleteMultipartUpload 返回 200 但内容是错误
+	fake.failPart, fake.failDone = 0, true
+	if err := s.Put("db/incomplete.sql", bytes.NewReader(data)); err == nil || !strings.Contains(err.Error(), "InternalError") {
+		t.Errorf("Put error = %v, want InternalError", err)
+	}
+}
+
+func TestS3PutFileResume(t *testing.T) {
+	fake := newFakeS3()
+	s := newTestS3(t, fake, 1024)
+	data := testData(4*1024 + 100)
+	path := t.TempDir() + "/backup.xbstream"
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// 第 3 片失败，已上传的分片保留以便续传
+	fake.failPart = 3
+	if err := s.PutFile("backup.xbstream", f); err == nil {
+		t.Fatal("PutFile succeeded with a failing part")
+	}
+	if len(fake.uploads) != 1 {
+		t.Fatalf("%d multipart upload(s) after an interrupted PutFile, want 1", len(fake.uploads))
+	}
+	// 已上传的第 2 片与本地不一致（例如上次写入了一半），续传时重传
+	for _, u := range fake.uploads {
+		u.parts[2] = u.parts[2][:10]
+	}
+
+	fake.failPart = 0
+	fake.requests = map[string]int{}
+	if err := s.PutFile("backup.xbstream", f); err != nil {
+		t.Fatal(err)
+	}
+	if fake.requests["CreateMultipartUpload"] != 0 {
+		t.Error("resume created a new multipart upload")
+	}
+	// 第 1 片跳过，第 2 片重传，第 3-5 片上传
+	if n := fake.requests["UploadPart"]; n != 4 {
+		t.Errorf("resume uploaded %d part(s), want 4", n)
+	}
+	if !bytes.Equal(fake.objects["backups/backup.xbstream"].data, data) {
+		t.Error("resumed object differs from the file")
+	}
+	if err := Verify(s, "backup.xbstream", int64(len(data)), sha256Hex(data)); err != nil {
+		t.Error(err)
+	}
+
+	// 小于一个分片的文件直接上传
+	small := t.TempDir() + "/manifest.json"
+	os.WriteFile(small, []byte("{}"), 0644)
+	sf, _ := os.Open(small)
+	defer sf.Close()
+	fake.requests = map[string]int{}
+	if err := s.PutFile("manifest.json", sf); err != nil {
+		t.Fatal(err)
+	}
+	if fake.requests["PutObject"] != 1 || fake.requests["CreateMultipartUpload"] != 0 {
+		t.Errorf("small file requests = %v, want a single PutObject", fake.requests)
+	}
+
+	// 没有校验和的分片上传（旧版本创建的）不能确认已上传的分片，重新上传
+	fake.uploads["old"] = &fakeUpload{key: "backups/old.xbstream", initiated: time.Now(), parts: map[int][]byte{1: data[:1024]}}
+	fake.requests = map[string]int{}
+	if err := s.PutFile("old.xbstream", f); err != nil {
+		t.Fatal(err)
+	}
+	if fake.requests["CreateMultipartUpload"] != 1 || fake.requests["UploadPart"] != 5 {
+		t.Errorf("requests = %v, want a new upload of 5 parts", fake.requests)
+	}
+}
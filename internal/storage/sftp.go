@@ -0,0 +1,796 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SFTP 使用 SFTP v3 协议访问远端目录。传输层交给系统的 ssh 命令（ssh -s sftp），
+// 因此认证方式、known_hosts 和跳板机等都沿用 ssh 的配置。
+type SFTP struct {
+	desc    string
+	root    string
+	sshArgs []string // 连接远端 host 的 ssh 参数，不含 -s sftp
+	host    string
+
+	cmd    *exec.Cmd
+	w      io.WriteCloser
+	r      *bufio.Reader
+	stderr *bytes.Buffer
+
+	mu     sync.Mutex // 同一时间只有一个请求在收发
+	nextID uint32
+	exts   map[string]string
+	broken bool // 连接已中断，PutFile 重试前重新连接
+}
+
+// SFTP 报文类型。
+const (
+	fxpInit     = 1
+	fxpVersion  = 2
+	fxpOpen     = 3
+	fxpClose    = 4
+	fxpRead     = 5
+	fxpWrite    = 6
+	fxpOpendir  = 11
+	fxpReaddir  = 12
+	fxpRemove   = 13
+	fxpMkdir    = 14
+	fxpRmdir    = 15
+	fxpStat     = 17
+	fxpRename   = 18
+	fxpStatus   = 101
+	fxpHandle   = 102
+	fxpData     = 103
+	fxpName     = 104
+	fxpAttrs    = 105
+	fxpExtended = 200
+)
+
+// SFTP 打开标志、属性标志和状态码。
+const (
+	fxfRead  = 0x01
+	fxfWrite = 0x02
+	fxfCreat = 0x08
+	fxfTrunc = 0x10
+
+	attrSize        = 0x01
+	attrUIDGID      = 0x02
+	attrPermissions = 0x04
+	attrACModTime   = 0x08
+	attrExtended    = 0x80000000
+
+	fxOK         = 0
+	fxEOF        = 1
+	fxNoSuchFile = 2
+
+	// 单个 READ/WRITE 的数据量，所有服务端都支持 32 KiB
+	sftpChunk = 32 * 1024
+	// 上传时同时在途的 WRITE 请求数
+	sftpWindow = 16
+
+	modeDir = 0o040000
+	modeFmt = 0o170000
+)
+
+// statusError 服务端返回的错误状态。
+type statusError struct {
+	code uint32
+	msg  string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("sftp: %s (code %d)", e.msg, e.code)
+}
+
+func (e *statusError) Is(target error) bool {
+	return target == ErrNotExist && e.code == fxNoSuchFile
+}
+
+func dialSFTP(u *url.URL, cfg Config) (*SFTP, error) {
+	if u.Host == "" {
+		return nil, errors.New("sftp url needs a host")
+	}
+	args := []string{"-o", "BatchMode=yes"}
+	if port := u.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+	if cfg.IdentityFile != "" {
+		args = append(args, "-i", cfg.IdentityFile)
+	}
+	for _, opt := range cfg.SSHOptions {
+		args = append(args, "-o", opt)
+	}
+	host := u.Hostname()
+	if u.User != nil && u.User.Username() != "" {
+		host = u.User.Username() + "@" + host
+	}
+
+	// sftp://host/~/backup 表示登录用户家目录下的 backup
+	root := u.Path
+	if root == "" || root == "/~" {
+		root = "."
+	} else if strings.HasPrefix(root, "/~/") {
+		root = root[3:]
+	}
+	s := &SFTP{
+		desc:    "sftp://" + host + ":" + portOrDefault(u) + root,
+		root:    root,
+		sshArgs: args,
+		host:    host,
+	}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	if err := s.mkdirAll(root); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// connect 启动 ssh 并完成 SFTP 握手。
+func (s *SFTP) connect() error {
+	cmd := s.ssh("-s", s.host, "sftp")
+	w, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	r, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start ssh: %w", err)
+	}
+	s.cmd, s.w, s.r, s.stderr = cmd, w, bufio.NewReaderSize(r, 64*1024), stderr
+	s.exts = map[string]string{}
+	s.broken = false
+	if err := s.init(); err != nil {
+		s.Close()
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("sftp %s: %v: %s", s.desc, err, msg)
+		}
+		return fmt.Errorf("sftp %s: %v", s.desc, err)
+	}
+	return nil
+}
+
+func portOrDefault(u *url.URL) string {
+	if p := u.Port(); p != "" {
+		return p
+	}
+	return "22"
+}
+
+func (s *SFTP) init() error {
+	if err := s.writePacket(fxpInit, newPacket().uint32(3)); err != nil {
+		return err
+	}
+	typ, data, err := s.readPacket()
+	if err != nil {
+		return err
+	}
+	if typ != fxpVersion {
+		return fmt.Errorf("unexpected packet %d during init", typ)
+	}
+	rd := &reader{data: data}
+	if version := rd.uint32(); version < 3 {
+		return fmt.Errorf("server speaks sftp version %d, need 3", version)
+	}
+	for len(rd.data) > 0 && rd.err == nil {
+		name, value := rd.string(), rd.string()
+		s.exts[name] = value
+	}
+	return rd.err
+}
+
+func (s *SFTP) path(name string) string {
+	return path.Join(s.root, path.Clean("/"+name))
+}
+
+func (s *SFTP) Put(name string, r io.Reader) error {
+	full := s.path(name)
+	if err := s.mkdirAll(path.Dir(full)); err != nil {
+		return err
+	}
+	tmp := full + ".part"
+	handle, err := s.open(tmp, fxfWrite|fxfCreat|fxfTrunc)
+	if err != nil {
+		return err
+	}
+	writeErr := s.writeAll(handle, r, 0)
+	closeErr := s.closeHandle(handle)
+	if writeErr == nil {
+		writeErr = closeErr
+	}
+	if writeErr != nil {
+		s.remove(tmp)
+		return writeErr
+	}
+	return s.rename(tmp, full)
+}
+
+// PutFile 从上次中断留下的 .part 继续上传，连接已中断时先重新连接。
+func (s *SFTP) PutFile(name string, f *os.File) error {
+	if s.broken {
+		s.Close()
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	full := s.path(name)
+	if err := s.mkdirAll(path.Dir(full)); err != nil {
+		return err
+	}
+	tmp := full + ".part"
+	var offset int64
+	if a, err := s.stat(tmp); err == nil && a.size <= info.Size() {
+		// 连接中断时在途的 WRITE 可能没有全部落盘，回退一个窗口重传
+		offset = a.size - sftpWindow*sftpChunk
+		if offset < 0 {
+			offset = 0
+		}
+	}
+	flags := uint32(fxfWrite | fxfCreat)
+	if offset == 0 {
+		flags |= fxfTrunc
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	handle, err := s.open(tmp, flags)
+	if err != nil {
+		return err
+	}
+	writeErr := s.writeAll(handle, f, uint64(offset))
+	closeErr := s.closeHandle(handle)
+	if writeErr == nil {
+		writeErr = closeErr
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	return s.rename(tmp, full)
+}
+
+// SHA256 在远端执行 sha256sum，远端不允许执行命令（例如只开放 sftp 的账号）时返回 errors.ErrUnsupported。
+func (s *SFTP) SHA256(name string) (string, error) {
+	cmd := s.ssh(s.host, "sha256sum -- "+shellQuote(s.path(name)))
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("remote sha256sum: %v: %w", err, errors.ErrUnsupported)
+	}
+	sum, _, _ := strings.Cut(strings.TrimSpace(string(out)), " ")
+	if len(sum) != 64 {
+		return "", fmt.Errorf("remote sha256sum: unexpected output %q: %w", out, errors.ErrUnsupported)
+	}
+	return sum, nil
+}
+
+// ssh 返回带有连接参数的 ssh 命令。
+func (s *SFTP) ssh(args ...string) *exec.Cmd {
+	return exec.Command("ssh", append(append([]string{}, s.sshArgs...), args...)...)
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// writeAll 从 offset 开始上传 r 的全部内容，最多 sftpWindow 个 WRITE 请求同时在途。
+func (s *SFTP) writeAll(handle string, r io.Reader, offset uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buf := make([]byte, sftpChunk)
+	pending := 0
+	var firstErr error
+	// wait 读取一个 WRITE 的应答，连接出错时返回错误
+	wait := func() error {
+		typ, data, err := s.readPacket()
+		if err != nil {
+			return err
+		}
+		if typ != fxpStatus {
+			return fmt.Errorf("unexpected packet %d, want status", typ)
+		}
+		pending--
+		rd := &reader{data: data}
+		rd.uint32()
+		if err := statusErr(rd); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return nil
+	}
+	for firstErr == nil {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			s.nextID++
+			p := newPacket().uint32(s.nextID).string(handle).uint64(offset).bytes(buf[:n])
+			if werr := s.writePacket(fxpWrite, p); werr != nil {
+				return werr
+			}
+			pending++
+			offset += uint64(n)
+			if pending >= sftpWindow {
+				if werr := wait(); werr != nil {
+					return werr
+				}
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			firstErr = err
+		}
+	}
+	for pending > 0 {
+		if err := wait(); err != nil {
+			return err
+		}
+	}
+	return firstErr
+}
+
+func (s *SFTP) Get(name string) (io.ReadCloser, error) {
+	handle, err := s.open(s.path(name), fxfRead)
+	if err != nil {
+		return nil, err
+	}
+	return &sftpFile{s: s, handle: handle}, nil
+}
+
+// sftpFile 顺序读取远端文件。
+type sftpFile struct {
+	s      *SFTP
+	handle string
+	offset uint64
+	buf    []byte
+	eof    bool
+	closed bool
+}
+
+func (f *sftpFile) Read(p []byte) (int, error) {
+	for len(f.buf) == 0 {
+		if f.eof {
+			return 0, io.EOF
+		}
+		typ, rd, err := f.s.request(fxpRead, newPacket().string(f.handle).uint64(f.offset).uint32(sftpChunk))
+		if err != nil {
+			return 0, err
+		}
+		switch typ {
+		case fxpData:
+			f.buf = []byte(rd.string())
+			f.offset += uint64(len(f.buf))
+			if rd.err != nil {
+				return 0, rd.err
+			}
+		case fxpStatus:
+			if err := statusErr(rd); err != nil {
+				return 0, err
+			}
+			f.eof = true
+		default:
+			return 0, fmt.Errorf("unexpected packet %d, want data", typ)
+		}
+	}
+	n := copy(p, f.buf)
+	f.buf = f.buf[n:]
+	return n, nil
+}
+
+func (f *sftpFile) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	return f.s.closeHandle(f.handle)
+}
+
+func (s *SFTP) List(prefix string) ([]Object, error) {
+	var objects []Object
+	var walk func(dir, key string) error
+	walk = func(dir, key string) error {
+		entries, err := s.readDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			name := key + e.name
+			if e.mode&modeFmt == modeDir {
+				if matchPrefix(name+"/", prefix) {
+					if err := walk(path.Join(dir, e.name), name+"/"); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if strings.HasPrefix(name, prefix) && !strings.HasSuffix(name, ".part") {
+				objects = append(objects, Object{Name: name, Size: e.size, ModTime: e.mtime})
+			}
+		}
+		return nil
+	}
+	if err := walk(s.root, ""); err != nil {
+		return nil, err
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Name < objects[j].Name })
+	return objects, nil
+}
+
+// Delete 删除对象，并删除因此变空的上级目录。
+func (s *SFTP) Delete(name string) error {
+	full := s.path(name)
+	if err := s.remove(full); err != nil {
+		return err
+	}
+	for dir := path.Dir(full); dir != path.Clean(s.root) && dir != "/" && dir != "."; dir = path.Dir(dir) {
+		if s.simple(fxpRmdir, newPacket().string(dir)) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *SFTP) Stat(name string) (*Object, error) {
+	a, err := s.stat(s.path(name))
+	if err != nil {
+		return nil, err
+	}
+	if a.mode&modeFmt == modeDir {
+		return nil, fmt.Errorf("%s is a directory: %w", name, ErrNotExist)
+	}
+	return &Object{Name: name, Size: a.size, ModTime: a.mtime}, nil
+}
+
+func (s *SFTP) Close() error {
+	s.w.Close()
+	done := make(chan error, 1)
+	go func() { done <- s.cmd.Wait() }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		s.cmd.Process.Kill()
+		<-done
+	}
+	return nil
+}
+
+func (s *SFTP) String() string { return s.desc }
+
+func (s *SFTP) open(p string, flags uint32) (string, error) {
+	typ, rd, err := s.request(fxpOpen, newPacket().string(p).uint32(flags).uint32(0))
+	if err != nil {
+		return "", err
+	}
+	return handleReply(typ, rd, p)
+}
+
+func handleReply(typ byte, rd *reader, p string) (string, error) {
+	switch typ {
+	case fxpHandle:
+		h := rd.string()
+		return h, rd.err
+	case fxpStatus:
+		if err := statusErr(rd); err != nil {
+			return "", fmt.Errorf("%s: %w", p, err)
+		}
+	}
+	return "", fmt.Errorf("%s: unexpected packet %d, want handle", p, typ)
+}
+
+func (s *SFTP) closeHandle(handle string) error {
+	return s.simple(fxpClose, newPacket().string(handle))
+}
+
+func (s *SFTP) remove(p string) error {
+	if err := s.simple(fxpRemove, newPacket().string(p)); err != nil {
+		return fmt.Errorf("%s: %w", p, err)
+	}
+	return nil
+}
+
+// rename 用新文件替换 newPath。SFTP v3 的 RENAME 不覆盖已有文件，优先使用 OpenSSH 的 posix-rename 扩展。
+func (s *SFTP) rename(oldPath, newPath string) error {
+	if _, ok := s.exts["posix-rename@openssh.com"]; ok {
+		return s.simple(fxpExtended, newPacket().string("posix-rename@openssh.com").string(oldPath).string(newPath))
+	}
+	if err := s.remove(newPath); err != nil && !errors.Is(err, ErrNotExist) {
+		return err
+	}
+	return s.simple(fxpRename, newPacket().string(oldPath).string(newPath))
+}
+
+func (s *SFTP) mkdirAll(dir string) error {
+	if dir == "" || dir == "." || dir == "/" {
+		return nil
+	}
+	a, err := s.stat(dir)
+	if err == nil {
+		if a.mode&modeFmt != modeDir {
+			return fmt.Errorf("%s exists and is not a directory", dir)
+		}
+		return nil
+	}
+	if !errors.Is(err, ErrNotExist) {
+		return err
+	}
+	if err := s.mkdirAll(path.Dir(dir)); err != nil {
+		return err
+	}
+	if err := s.simple(fxpMkdir, newPacket().string(dir).uint32(attrPermissions).uint32(0o755)); err != nil {
+		// 并发创建时目录可能已经存在
+		if a, statErr := s.stat(dir); statErr == nil && a.mode&modeFmt == modeDir {
+			return nil
+		}
+		return fmt.Errorf("mkdir %s: %w", dir, err)
+	}
+	return nil
+}
+
+type attrs struct {
+	name  string
+	size  int64
+	mode  uint32
+	mtime time.Time
+}
+
+func (s *SFTP) stat(p string) (*attrs, error) {
+	typ, rd, err := s.request(fxpStat, newPacket().string(p))
+	if err != nil {
+		return nil, err
+	}
+	switch typ {
+	case fxpAttrs:
+		a := rd.attrs()
+		return &a, rd.err
+	case fxpStatus:
+		if err := statusErr(rd); err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+	}
+	return nil, fmt.Errorf("%s: unexpected packet %d, want attrs", p, typ)
+}
+
+func (s *SFTP) readDir(dir string) ([]attrs, error) {
+	typ, rd, err := s.request(fxpOpendir, newPacket().string(dir))
+	if err != nil {
+		return nil, err
+	}
+	handle, err := handleReply(typ, rd, dir)
+	if err != nil {
+		return nil, err
+	}
+	defer s.closeHandle(handle)
+
+	var entries []attrs
+	for {
+		typ, rd, err := s.request(fxpReaddir, newPacket().string(handle))
+		if err != nil {
+			return nil, err
+		}
+		if typ == fxpStatus {
+			if err := statusErr(rd); err != nil {
+				return nil, fmt.Errorf("%s: %w", dir, err)
+			}
+			return entries, nil
+		}
+		if typ != fxpName {
+			return nil, fmt.Errorf("%s: unexpected packet %d, want name", dir, typ)
+		}
+		count := rd.uint32()
+		for i := uint32(0); i < count && rd.err == nil; i++ {
+			name := rd.string()
+			rd.string() // longname
+			a := rd.attrs()
+			a.name = name
+			if name != "." && name != ".." {
+				entries = append(entries, a)
+			}
+		}
+		if rd.err != nil {
+			return nil, rd.err
+		}
+	}
+}
+
+// simple 发送只返回 STATUS 的请求。
+func (s *SFTP) simple(typ byte, p *packet) error {
+	respType, rd, err := s.request(typ, p)
+	if err != nil {
+		return err
+	}
+	if respType != fxpStatus {
+		return fmt.Errorf("unexpected packet %d, want status", respType)
+	}
+	return statusErr(rd)
+}
+
+// request 发送一个请求并等待对应的应答，p 不含请求 ID。
+func (s *SFTP) request(typ byte, p *packet) (byte, *reader, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	id := s.nextID
+	if err := s.writePacket(typ, newPacket().uint32(id).raw(p.buf)); err != nil {
+		return 0, nil, err
+	}
+	respType, data, err := s.readPacket()
+	if err != nil {
+		return 0, nil, err
+	}
+	rd := &reader{data: data}
+	if respID := rd.uint32(); respID != id {
+		return 0, nil, fmt.Errorf("sftp: response id %d, want %d", respID, id)
+	}
+	return respType, rd, nil
+}
+
+func (s *SFTP) writePacket(typ byte, p *packet) error {
+	hdr := make([]byte, 5)
+	binary.BigEndian.PutUint32(hdr, uint32(len(p.buf)+1))
+	hdr[4] = typ
+	if _, err := s.w.Write(hdr); err != nil {
+		return s.connErr(err)
+	}
+	if _, err := s.w.Write(p.buf); err != nil {
+		return s.connErr(err)
+	}
+	return nil
+}
+
+func (s *SFTP) readPacket() (byte, []byte, error) {
+	hdr := make([]byte, 5)
+	if _, err := io.ReadFull(s.r, hdr); err != nil {
+		return 0, nil, s.connErr(err)
+	}
+	length := binary.BigEndian.Uint32(hdr)
+	if length < 1 || length > 1<<20 {
+		return 0, nil, fmt.Errorf("sftp: bad packet length %d", length)
+	}
+	data := make([]byte, length-1)
+	if _, err := io.ReadFull(s.r, data); err != nil {
+		return 0, nil, s.connErr(err)
+	}
+	return hdr[4], data, nil
+}
+
+// connErr 连接中断时附上 ssh 的错误输出。
+func (s *SFTP) connErr(err error) error {
+	s.broken = true
+	if msg := strings.TrimSpace(s.stderr.String()); msg != "" {
+		return fmt.Errorf("sftp connection: %v: %s", err, msg)
+	}
+	return fmt.Errorf("sftp connection: %v", err)
+}
+
+func statusErr(rd *reader) error {
+	code := rd.uint32()
+	msg := rd.string()
+	if rd.err != nil {
+		return rd.err
+	}
+	if code == fxOK || code == fxEOF {
+		return nil
+	}
+	return &statusError{code: code, msg: msg}
+}
+
+// packet 构造 SFTP 报文内容。
+type packet struct {
+	buf []byte
+}
+
+func newPacket() *packet { return &packet{} }
+
+func (p *packet) uint32(v uint32) *packet {
+	p.buf = binary.BigEndian.AppendUint32(p.buf, v)
+	return p
+}
+
+func (p *packet) uint64(v uint64) *packet {
+	p.buf = binary.BigEndian.AppendUint64(p.buf, v)
+	return p
+}
+
+func (p *packet) string(v string) *packet {
+	p.uint32(uint32(len(v)))
+	p.buf = append(p.buf, v...)
+	return p
+}
+
+func (p *packet) bytes(v []byte) *packet {
+	p.uint32(uint32(len(v)))
+	p.buf = append(p.buf, v...)
+	return p
+}
+
+func (p *packet) raw(v []byte) *packet {
+	p.buf = append(p.buf, v...)
+	return p
+}
+
+// reader 解析 SFTP 报文内容，出错后后续读取都返回零值。
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < n {
+		r.err = errors.New("sftp: short packet")
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *reader) uint32() uint32 {
+	if b := r.take(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *reader) uint64() uint64 {
+	if b := r.take(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *reader) string() string {
+	n := r.uint32()
+	return string(r.take(int(n)))
+}
+
+func (r *reader) attrs() attrs {
+	var a attrs
+	flags := r.uint32()
+	if flags&attrSize != 0 {
+		a.size = int64(r.uint64())
+	}
+	if flags&attrUIDGID != 0 {
+		r.uint32()
+		r.uint32()
+	}
+	if flags&attrPermissions != 0 {
+		a.mode = r.uint32()
+	}
+	if flags&attrACModTime != 0 {
+		r.uint32()
+		a.mtime = time.Unix(int64(r.uint32()), 0)
+	}
+	if flags&attrExtended != 0 {
+		count := r.uint32()
+		for i := uint32(0); i < count && r.err == nil; i++ {
+			r.string()
+			r.string()
+		}
+	}
+	return a
+}
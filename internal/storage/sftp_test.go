@@ -0,0 +1,511 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSFTP 是内存中的 SFTP v3 服务端，只实现客户端用到的请求。
+type fakeSFTP struct {
+	mu          sync.Mutex
+	files       map[string][]byte
+	dirs        map[string]bool
+	posixRename bool // 在 VERSION 中声明 posix-rename@openssh.com 扩展
+	dropAfter   int  // 不为 0 时处理完这么多个 WRITE 后断开连接，模拟上传中断
+	requests    map[string]int
+	openFlags   []uint32 // 每次 OPEN 的标志
+	writeOffset []uint64 // 每个 WRITE 的偏移
+}
+
+func newFakeSFTP() *fakeSFTP {
+	return &fakeSFTP{files: map[string][]byte{}, dirs: map[string]bool{".": true}, requests: map[string]int{}}
+}
+
+// newTestSFTP 通过一对内存管道连接 fake，返回根目录为 backup 的 SFTP。
+func newTestSFTP(t *testing.T, fake *fakeSFTP) *SFTP {
+	t.Helper()
+	cr, cw := io.Pipe() // 客户端到服务端
+	sr, sw := io.Pipe() // 服务端到客户端
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fake.serve(cr, sw)
+	}()
+	t.Cleanup(func() {
+		cw.Close()
+		sr.Close()
+		<-done
+	})
+	s := &SFTP{
+		desc:   "sftp://test/backup",
+		root:   "backup",
+		w:      cw,
+		r:      bufio.NewReader(sr),
+		stderr: &bytes.Buffer{},
+		exts:   map[string]string{},
+	}
+	if err := s.init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.mkdirAll(s.root); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// serve 处理一个连接上的请求直到连接关闭。应答经由缓冲的 channel 发出，
+// 这样客户端可以像对真实的 ssh 连接一样连续发送多个 WRITE 再读应答。
+func (f *fakeSFTP) serve(r *io.PipeReader, w *io.PipeWriter) {
+	replies := make(chan []byte, 256)
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		for b := range replies {
+			if _, err := w.Write(b); err != nil {
+				break
+			}
+		}
+		w.Close()
+		for range replies {
+		}
+	}()
+	defer func() {
+		close(replies)
+		<-sent
+	}()
+	reply := func(typ byte, p *packet) {
+		b := binary.BigEndian.AppendUint32(nil, uint32(len(p.buf)+1))
+		replies <- append(append(b, typ), p.buf...)
+	}
+	status := func(id, code uint32) {
+		reply(fxpStatus, newPacket().uint32(id).uint32(code).string("status "+strconv.Itoa(int(code))).string(""))
+	}
+
+	handles := map[string]string{}
+	listed := map[string]bool{}
+	nextHandle, writes := 0, 0
+	hdr := make([]byte, 5)
+	for {
+		if _, err := io.ReadFull(r, hdr); err != nil {
+			return
+		}
+		data := make([]byte, binary.BigEndian.Uint32(hdr)-1)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return
+		}
+		rd := &reader{data: data}
+		if hdr[4] == fxpInit {
+			p := newPacket().uint32(3)
+			if f.posixRename {
+				p.string("posix-rename@openssh.com").string("1")
+			}
+			reply(fxpVersion, p)
+			continue
+		}
+		id := rd.uint32()
+
+		f.mu.Lock()
+		switch hdr[4] {
+		case fxpOpen:
+			name, flags := path.Clean(rd.string()), rd.uint32()
+			f.requests["open"]++
+			f.openFlags = append(f.openFlags, flags)
+			_, exists := f.files[name]
+			switch {
+			case !f.dirs[path.Dir(name)] || !exists && flags&fxfCreat == 0:
+				status(id, fxNoSuchFile)
+			default:
+				if !exists || flags&fxfTrunc != 0 {
+					f.files[name] = nil
+				}
+				nextHandle++
+				h := "h" + strconv.Itoa(nextHandle)
+				handles[h] = name
+				reply(fxpHandle, newPacket().uint32(id).string(h))
+			}
+		case fxpWrite:
+			name, offset, b := handles[rd.string()], rd.uint64(), []byte(rd.string())
+			f.requests["write"]++
+			f.writeOffset = append(f.writeOffset, offset)
+			file := f.files[name]
+			if end := int(offset) + len(b); end > len(file) {
+				file = append(file, make([]byte, end-len(file))...)
+			}
+			copy(file[offset:], b)
+			f.files[name] = file
+			status(id, fxOK)
+			writes++
+			if f.dropAfter > 0 && writes >= f.dropAfter {
+				f.mu.Unlock()
+				r.CloseWithError(errors.New("connection reset"))
+				return
+			}
+		case fxpRead:
+			file, offset, n := f.files[handles[rd.string()]], rd.uint64(), rd.uint32()
+			if offset >= uint64(len(file)) {
+				status(id, fxEOF)
+				break
+			}
+			end := offset + uint64(n)
+			if end > uint64(len(file)) {
+				end = uint64(len(file))
+			}
+			reply(fxpData, newPacket().uint32(id).bytes(file[offset:end]))
+		case fxpClose:
+			delete(handles, rd.string())
+			status(id, fxOK)
+		case fxpOpendir:
+			name := path.Clean(rd.string())
+			if !f.dirs[name] {
+				status(id, fxNoSuchFile)
+				break
+			}
+			nextHandle++
+			h := "d" + strconv.Itoa(nextHandle)
+			handles[h] = name
+			reply(fxpHandle, newPacket().uint32(id).string(h))
+		case fxpReaddir:
+			h := rd.string()
+			if listed[h] {
+				status(id, fxEOF)
+				break
+			}
+			listed[h] = true
+			dir := handles[h]
+			p := newPacket()
+			count := 0
+			for name, file := range f.files {
+				if path.Dir(name) == dir {
+					p.string(path.Base(name)).string("").raw(fakeAttrs(int64(len(file)), 0o100644))
+					count++
+				}
+			}
+			for name := range f.dirs {
+				if name != dir && path.Dir(name) == dir {
+					p.string(path.Base(name)).string("").raw(fakeAttrs(0, 0o040755))
+					count++
+				}
+			}
+			reply(fxpName, newPacket().uint32(id).uint32(uint32(count)).raw(p.buf))
+		case fxpRemove:
+			name := path.Clean(rd.string())
+			f.requests["remove"]++
+			if _, ok := f.files[name]; !ok {
+				status(id, fxNoSuchFile)
+				break
+			}
+			delete(f.files, name)
+			status(id, fxOK)
+		case fxpMkdir:
+			name := path.Clean(rd.string())
+			if f.dirs[name] || !f.dirs[path.Dir(name)] {
+				status(id, 4)
+				break
+			}
+			f.dirs[name] = true
+			status(id, fxOK)
+		case fxpRmdir:
+			name := path.Clean(rd.string())
+			if f.hasChildren(name) {
+				status(id, 4)
+				break
+			}
+			delete(f.dirs, name)
+			status(id, fxOK)
+		case fxpStat:
+			name := path.Clean(rd.string())
+			if file, ok := f.files[name]; ok {
+				reply(fxpAttrs, newPacket().uint32(id).raw(fakeAttrs(int64(len(file)), 0o100644)))
+			} else if f.dirs[name] {
+				reply(fxpAttrs, newPacket().uint32(id).raw(fakeAttrs(0, 0o040755)))
+			} else {
+				status(id, fxNoSuchFile)
+			}
+		case fxpRename:
+			// SFTP v3 的 RENAME 在目标已存在时失败
+			oldPath, newPath := path.Clean(rd.string()), path.Clean(rd.string())
+			f.requests["rename"]++
+			_, exists := f.files[newPath]
+			file, ok := f.files[oldPath]
+			switch {
+			case !ok:
+				status(id, fxNoSuchFile)
+			case exists:
+				status(id, 4)
+			default:
+				delete(f.files, oldPath)
+				f.files[newPath] = file
+				status(id, fxOK)
+			}
+		case fxpExtended:
+			if ext := rd.string(); ext != "posix-rename@openssh.com" || !f.posixRename {
+				status(id, 8)
+				break
+			}
+			oldPath, newPath := path.Clean(rd.string()), path.Clean(rd.string())
+			f.requests["posix-rename"]++
+			file, ok := f.files[oldPath]
+			if !ok {
+				status(id, fxNoSuchFile)
+				break
+			}
+			delete(f.files, oldPath)
+			f.files[newPath] = file
+			status(id, fxOK)
+		default:
+			status(id, 8)
+		}
+		f.mu.Unlock()
+	}
+}
+
+func (f *fakeSFTP) hasChildren(dir string) bool {
+	for name := range f.files {
+		if path.Dir(name) == dir {
+			return true
+		}
+	}
+	for name := range f.dirs {
+		if name != dir && path.Dir(name) == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// fakeAttrs 编码包含大小、权限和修改时间的 ATTRS。
+func fakeAttrs(size int64, mode uint32) []byte {
+	mtime := uint32(time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC).Unix())
+	return newPacket().uint32(attrSize | attrPermissions | attrACModTime).uint64(uint64(size)).uint32(mode).uint32(mtime).uint32(mtime).buf
+}
+
+func (f *fakeSFTP) file(name string) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.files[name]
+}
+
+func TestSFTPPacket(t *testing.T) {
+	p := newPacket().uint32(7).uint64(1<<40 + 3).string("posix-rename@openssh.com").bytes([]byte{0, 1, 2})
+	p.uint32(attrSize | attrUIDGID | attrPermissions | attrACModTime | attrExtended).
+		uint64(12345).uint32(1000).uint32(1000).uint32(0o100644).uint32(1).uint32(1714528800).
+		uint32(1).string("name").string("value")
+	rd := &reader{data: p.buf}
+	if v := rd.uint32(); v != 7 {
+		t.Errorf("uint32 = %d, want 7", v)
+	}
+	if v := rd.uint64(); v != 1<<40+3 {
+		t.Errorf("uint64 = %d, want %d", v, uint64(1<<40+3))
+	}
+	if v := rd.string(); v != "posix-rename@openssh.com" {
+		t.Errorf("string = %q", v)
+	}
+	if v := rd.string(); v != "\x00\x01\x02" {
+		t.Errorf("bytes = %q", v)
+	}
+	a := rd.attrs()
+	if a.size != 12345 || a.mode != 0o100644 || !a.mtime.Equal(time.Unix(1714528800, 0)) {
+		t.Errorf("attrs = %+v", a)
+	}
+	if rd.err != nil || len(rd.data) != 0 {
+		t.Errorf("err = %v, %d byte(s) left", rd.err, len(rd.data))
+	}
+
+	// 报文不完整时报错，之后的读取都返回零值
+	rd = &reader{data: newPacket().string("truncated").buf[:6]}
+	if v := rd.string(); v != "" || rd.err == nil {
+		t.Errorf("string of a short packet = %q, %v", v, rd.err)
+	}
+	if v := rd.uint32(); v != 0 {
+		t.Errorf("uint32 after an error = %d, want 0", v)
+	}
+
+	// 状态码 EOF 不是错误，NO_SUCH_FILE 对应 ErrNotExist
+	if err := statusErr(&reader{data: newPacket().uint32(fxEOF).string("eof").buf}); err != nil {
+		t.Errorf("EOF status = %v, want nil", err)
+	}
+	err := statusErr(&reader{data: newPacket().uint32(fxNoSuchFile).string("no such file").buf})
+	if !errors.Is(err, ErrNotExist) {
+		t.Errorf("NO_SUCH_FILE status = %v, want ErrNotExist", err)
+	}
+}
+
+func TestSFTPRoundTrip(t *testing.T) {
+	fake := newFakeSFTP()
+	s := newTestSFTP(t, fake)
+	data := testData(3*sftpChunk + 100)
+	if err := s.Put("mysql/app/backup.sql.gz", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("mysql/app/backup.manifest.json", strings.NewReader("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.file("backup/mysql/app/backup.sql.gz"); !bytes.Equal(got, data) {
+		t.Fatalf("stored %d byte(s), want %d", len(got), len(data))
+	}
+	if got := fake.file("backup/mysql/app/backup.sql.gz.part"); got != nil {
+		t.Error(".part file left after Put")
+	}
+
+	rc, err := s.Get("mysql/app/backup.sql.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Get returned %d byte(s), want %d", len(got), len(data))
+	}
+	if _, err := s.Get("mysql/app/missing"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Get of a missing file = %v, want ErrNotExist", err)
+	}
+
+	obj, err := s.Stat("mysql/app/backup.sql.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.Size != int64(len(data)) || obj.ModTime.IsZero() {
+		t.Errorf("Stat = %+v", obj)
+	}
+	if _, err := s.Stat("mysql/app"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Stat of a directory = %v, want ErrNotExist", err)
+	}
+
+	objects, err := s.List("mysql/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, o := range objects {
+		names = append(names, o.Name)
+	}
+	want := "mysql/app/backup.manifest.json,mysql/app/backup.sql.gz"
+	if strings.Join(names, ",") != want {
+		t.Errorf("List = %v, want %s", names, want)
+	}
+
+	// 删除最后一个文件后清理空目录，但保留根目录
+	for _, name := range names {
+		if err := s.Delete(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fake.mu.Lock()
+	if fake.dirs["backup/mysql"] || !fake.dirs["backup"] {
+		t.Errorf("directories after Delete = %v", fake.dirs)
+	}
+	fake.mu.Unlock()
+}
+
+func TestSFTPPutFileResume(t *testing.T) {
+	fake := newFakeSFTP()
+	data := testData(40*sftpChunk + 100)
+	name := t.TempDir() + "/backup.xbstream"
+	if err := os.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// 写入 20 个分块后连接中断，.part 保留以便续传
+	fake.dropAfter = 20
+	s := newTestSFTP(t, fake)
+	if err := s.PutFile("backup.xbstream", f); err == nil {
+		t.Fatal("PutFile succeeded over a dropped connection")
+	}
+	if !s.broken {
+		t.Error("connection not marked broken")
+	}
+	if n := len(fake.file("backup/backup.xbstream.part")); n != 20*sftpChunk {
+		t.Fatalf(".part has %d byte(s), want %d", n, 20*sftpChunk)
+	}
+
+	// 新连接从 .part 的大小回退一个窗口开始续传，不截断
+	fake.mu.Lock()
+	fake.dropAfter = 0
+	fake.openFlags, fake.writeOffset = nil, nil
+	fake.mu.Unlock()
+	s = newTestSFTP(t, fake)
+	if err := s.PutFile("backup.xbstream", f); err != nil {
+		t.Fatal(err)
+	}
+	fake.mu.Lock()
+	if len(fake.openFlags) != 1 || fake.openFlags[0]&fxfTrunc != 0 {
+		t.Errorf("open flags = %v, want one open without TRUNC", fake.openFlags)
+	}
+	if want := uint64((20 - sftpWindow) * sftpChunk); len(fake.writeOffset) == 0 || fake.writeOffset[0] != want {
+		t.Errorf("resume started at %v, want %d", fake.writeOffset, want)
+	}
+	if n := len(fake.writeOffset); n != 40-(20-sftpWindow)+1 {
+		t.Errorf("resume sent %d WRITE(s), want %d", n, 40-(20-sftpWindow)+1)
+	}
+	fake.mu.Unlock()
+	if !bytes.Equal(fake.file("backup/backup.xbstream"), data) {
+		t.Error("resumed file differs from the source")
+	}
+
+	// .part 小于一个窗口或比本地文件大时从头上传
+	for _, part := range [][]byte{data[:sftpChunk], append(append([]byte{}, data...), 1, 2, 3)} {
+		fake.mu.Lock()
+		fake.files["backup/backup.xbstream.part"] = part
+		fake.openFlags, fake.writeOffset = nil, nil
+		fake.mu.Unlock()
+		if err := s.PutFile("backup.xbstream", f); err != nil {
+			t.Fatal(err)
+		}
+		fake.mu.Lock()
+		if len(fake.openFlags) != 1 || fake.openFlags[0]&fxfTrunc == 0 || fake.writeOffset[0] != 0 {
+			t.Errorf("%d byte .part: open flags %v, first offset %v, want a truncating upload from 0", len(part), fake.openFlags, fake.writeOffset)
+		}
+		fake.mu.Unlock()
+		if !bytes.Equal(fake.file("backup/backup.xbstream"), data) {
+			t.Errorf("%d byte .part: uploaded file differs from the source", len(part))
+		}
+	}
+}
+
+func TestSFTPRenameOverwrite(t *testing.T) {
+	for _, posix := range []bool{true, false} {
+		fake := newFakeSFTP()
+		fake.posixRename = posix
+		s := newTestSFTP(t, fake)
+		if err := s.Put("latest.json", strings.NewReader("old")); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Put("latest.json", strings.NewReader("new")); err != nil {
+			t.Fatalf("posix-rename=%v: overwrite: %v", posix, err)
+		}
+		if got := string(fake.file("backup/latest.json")); got != "new" {
+			t.Errorf("posix-rename=%v: content = %q, want new", posix, got)
+		}
+		fake.mu.Lock()
+		if posix {
+			// 扩展可用时原子替换，不删除旧文件
+			if fake.requests["posix-rename"] != 2 || fake.requests["rename"] != 0 || fake.requests["remove"] != 0 {
+				t.Errorf("posix-rename=true: requests = %v", fake.requests)
+			}
+		} else {
+			// 普通 RENAME 不覆盖，先删除已有的目标
+			if fake.requests["posix-rename"] != 0 || fake.requests["rename"] != 2 || fake.requests["remove"] != 2 {
+				t.Errorf("posix-rename=false: requests = %v", fake.requests)
+			}
+		}
+		fake.mu.Unlock()
+	}
+}
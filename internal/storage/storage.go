@@ -0,0 +1,269 @@
+// Package storage 定义备份的存放位置（本地目录、SFTP、S3 等），两个程序通过同一套接口
+// 上传备份并在恢复时取回。对象名使用 / 分隔，相对于存储的根目录。
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNotExist 对象不存在，可用 errors.Is 判断。
+var ErrNotExist = fs.ErrNotExist
+
+// ErrMismatch 存储中对象的大小或 SHA-256 与本地记录不一致，可用 errors.Is 判断。
+var ErrMismatch = errors.New("checksum mismatch")
+
+const (
+	// 单个文件上传失败后的重试次数，支持断点续传的后端从断点继续
+	uploadRetries = 3
+	retryDelay    = 5 * time.Second
+)
+
+// Object 存储中的一个文件。
+type Object struct {
+	Name    string // 相对于根目录的路径，使用 / 分隔
+	Size    int64
+	ModTime time.Time
+}
+
+// Storage 备份存储后端。
+type Storage interface {
+	// Put 写入对象，写完之前同名对象保持不变。
+	Put(name string, r io.Reader) error
+	// Get 读取对象，调用方负责关闭。
+	Get(name string) (io.ReadCloser, error)
+	// List 列出名称以 prefix 开头的所有对象（包括子目录中的），按名称排序。
+	List(prefix string) ([]Object, error)
+	// Delete 删除对象。
+	Delete(name string) error
+	// Stat 查询对象信息，不存在时返回 ErrNotExist。
+	Stat(name string) (*Object, error)
+	// Close 释放连接。
+	Close() error
+	// String 用于日志的描述，不含密码。
+	String() string
+}
+
+// Resumer 支持断点续传的存储：上传中断时保留已上传的部分，再次上传同名对象时从断点继续。
+type Resumer interface {
+	// PutFile 上传本地文件，写完之前同名对象保持不变。
+	PutFile(name string, f *os.File) error
+}
+
+// Hasher 能在存储端计算 SHA-256 的存储，校验时不需要下载对象。
+type Hasher interface {
+	// SHA256 返回对象内容的十六进制 SHA-256，不支持时返回 errors.ErrUnsupported。
+	SHA256(name string) (string, error)
+}
+
+// Config 存储配置，两个程序的配置文件中使用相同的字段。
+type Config struct {
+	URL          string   `json:"url"`           // /data/backup、file:///data/backup、sftp://user@host:22/data/backup（/~/ 开头为家目录下）或 s3://bucket/prefix
+	IdentityFile string   `json:"identity_file"` // sftp：ssh 私钥，为空时使用 ssh 默认配置
+	SSHOptions   []string `json:"ssh_options"`   // sftp：额外的 ssh -o 选项，例如 StrictHostKeyChecking=accept-new
+	S3           S3Config `json:"s3"`            // s3：endpoint、密钥等
+}
+
+// Open 根据 URL 的 scheme 打开存储。
+func Open(cfg Config) (Storage, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("storage url is empty")
+	}
+	if !strings.Contains(cfg.URL, "://") {
+		return NewLocal(cfg.URL)
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("parse storage url: %w", err)
+	}
+	switch u.Scheme {
+	case "file":
+		return NewLocal(u.Path)
+	case "sftp":
+		return dialSFTP(u, cfg)
+	case "s3":
+		return newS3(u, cfg.S3)
+	}
+	return nil, fmt.Errorf("unsupported storage scheme %q", u.Scheme)
+}
+
+// Validate 检查配置，不建立连接。
+func Validate(cfg Config) error {
+	if cfg.URL == "" || !strings.Contains(cfg.URL, "://") {
+		return nil
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return fmt.Errorf("parse storage url: %w", err)
+	}
+	switch u.Scheme {
+	case "file":
+		return nil
+	case "sftp":
+		if u.Host == "" {
+			return errors.New("sftp url needs a host")
+		}
+		return nil
+	case "s3":
+		return validateS3(u, cfg.S3)
+	}
+	return fmt.Errorf("unsupported storage scheme %q", u.Scheme)
+}
+
+// PutPath 上传本地文件或目录，目录中的文件上传为 key/<相对路径>。
+// 每个文件失败后重试，支持断点续传的存储从断点继续。
+func PutPath(s Storage, localPath, key string) error {
+	return filepath.WalkDir(localPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(localPath, p)
+		if err != nil {
+			return err
+		}
+		name := key
+		if rel != "." {
+			name = path.Join(key, filepath.ToSlash(rel))
+		}
+		return putFile(s, p, name)
+	})
+}
+
+func putFile(s Storage, localPath, name string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for attempt := 1; ; attempt++ {
+		if r, ok := s.(Resumer); ok {
+			err = r.PutFile(name, f)
+		} else if _, err = f.Seek(0, io.SeekStart); err == nil {
+			err = s.Put(name, f)
+		}
+		if err == nil {
+			return nil
+		}
+		if attempt == uploadRetries {
+			return fmt.Errorf("upload %s (%d attempts): %w", name, attempt, err)
+		}
+		time.Sleep(time.Duration(attempt) * retryDelay)
+	}
+}
+
+// Copy 将 src 中的对象 name 复制到 dst 的同名对象。
+func Copy(src, dst Storage, name string) error {
+	r, err := src.Get(name)
+	if err != nil {
+		return fmt.Errorf("copy %s: %w", name, err)
+	}
+	defer r.Close()
+	if err := dst.Put(name, r); err != nil {
+		return fmt.Errorf("copy %s: %w", name, err)
+	}
+	return nil
+}
+
+// Checksum 返回对象的十六进制 SHA-256，存储端不能计算时下载对象计算。
+func Checksum(s Storage, name string) (string, error) {
+	if h, ok := s.(Hasher); ok {
+		sum, err := h.SHA256(name)
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return sum, err
+		}
+	}
+	r, err := s.Get(name)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", fmt.Errorf("read %s: %w", name, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Verify 检查对象的大小和 SHA-256 是否与 size、sum 一致，不一致时返回包装了 ErrMismatch 的错误。
+func Verify(s Storage, name string, size int64, sum string) error {
+	o, err := s.Stat(name)
+	if err != nil {
+		return err
+	}
+	if o.Size != size {
+		return fmt.Errorf("%s in %s: size %d, want %d: %w", name, s, o.Size, size, ErrMismatch)
+	}
+	got, err := Checksum(s, name)
+	if err != nil {
+		return err
+	}
+	if got != sum {
+		return fmt.Errorf("%s in %s: sha256 %s, want %s: %w", name, s, got, sum, ErrMismatch)
+	}
+	return nil
+}
+
+// GetPath 下载对象 key 到 localPath；key 不是对象时按目录下载 key/ 下的所有对象。
+func GetPath(s Storage, key, localPath string) error {
+	if _, err := s.Stat(key); err == nil {
+		return getFile(s, key, localPath)
+	} else if !errors.Is(err, ErrNotExist) {
+		return err
+	}
+	objects, err := s.List(key + "/")
+	if err != nil {
+		return err
+	}
+	if len(objects) == 0 {
+		return fmt.Errorf("%s not found in %s: %w", key, s, ErrNotExist)
+	}
+	for _, o := range objects {
+		dst := filepath.Join(localPath, filepath.FromSlash(strings.TrimPrefix(o.Name, key+"/")))
+		if err := getFile(s, o.Name, dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getFile 下载单个对象，先写入临时文件再改名，中断时不会留下不完整的文件。
+func getFile(s Storage, name, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	r, err := s.Get(name)
+	if err != nil {
+		return fmt.Errorf("download %s: %w", name, err)
+	}
+	defer r.Close()
+	tmp := dst + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("download %s: %w", name, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// matchPrefix 目录 dir（以 / 结尾或为空）下是否可能有以 prefix 开头的对象。
+func matchPrefix(dir, prefix string) bool {
+	return strings.HasPrefix(dir, prefix) || strings.HasPrefix(prefix, dir)
+}
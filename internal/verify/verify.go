@@ -0,0 +1,449 @@
+// Package verify 检查备份是否完整：清单中记录的校验和、加密/压缩/tar/xbstream 数据流能否完整读出、
+// 导出工具的结束标记（mysqldump、pg_dump）、mongodump 的元数据文件以及 xtrabackup_checkpoints。
+package verify
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/LYcoding0/dbbackup/internal/compress"
+	"github.com/LYcoding0/dbbackup/internal/crypt"
+	"github.com/LYcoding0/dbbackup/internal/manifest"
+	"github.com/LYcoding0/dbbackup/internal/xtrabackup"
+)
+
+// 检查项名称。
+const (
+	CheckManifest    = "manifest"    // 清单可读且状态为成功
+	CheckChecksum    = "checksum"    // 文件大小和 SHA-256 与清单一致
+	CheckIntegrity   = "integrity"   // 解密、解压、tar 数据流完整
+	CheckDumpMarker  = "dump-marker" // 逻辑备份末尾的结束标记
+	CheckMongoDump   = "mongodump"   // mongodump 元数据文件或 archive 头
+	CheckCheckpoints = "checkpoints" // xtrabackup_checkpoints
+)
+
+// mongoArchiveMagic mongodump --archive 文件开头的魔数（小端序）。
+const mongoArchiveMagic = 0x8199e26d
+
+// tailSize 检查结束标记时保留的文件末尾字节数。
+const tailSize = 4096
+
+// 逻辑备份末尾的结束标记。
+var (
+	mysqldumpMarker = []byte("-- Dump completed")
+	pgDumpMarkers   = [][]byte{
+		[]byte("-- PostgreSQL database dump complete"),
+		[]byte("-- PostgreSQL database cluster dump complete"),
+	}
+)
+
+// Options 校验参数。
+type Options struct {
+	Key *crypt.Key // 解密 .enc 文件，为空时加密文件只校验 checksum
+}
+
+// Result 单个备份文件的一项检查结果。
+type Result struct {
+	Artifact string // 被检查的文件或目录
+	Check    string // 检查项
+	Err      error  // 为空表示通过
+	Skipped  string // 不为空表示因该原因跳过
+	Detail   string // 通过时的补充说明
+}
+
+// OK 检查是否通过（跳过也视为通过）。
+func (r Result) OK() bool {
+	return r.Err == nil
+}
+
+// String 格式化为一行：PASS/FAIL/SKIP 检查项 文件 (说明)。
+func (r Result) String() string {
+	status, detail := "PASS", r.Detail
+	switch {
+	case r.Err != nil:
+		status, detail = "FAIL", r.Err.Error()
+	case r.Skipped != "":
+		status, detail = "SKIP", r.Skipped
+	}
+	line := fmt.Sprintf("%-4s  %-11s  %s", status, r.Check, r.Artifact)
+	if detail != "" {
+		line += "  (" + detail + ")"
+	}
+	return line
+}
+
+// Failed 返回 results 中未通过的检查数。
+func Failed(results []Result) int {
+	n := 0
+	for _, r := range results {
+		if !r.OK() {
+			n++
+		}
+	}
+	return n
+}
+
+// Path 校验一份备份。path 可以是清单文件，也可以是备份文件或目录；
+// 后者会在同目录下查找包含它的清单，找到时同时校验清单中的校验和。
+func Path(p string, opts Options) []Result {
+	if strings.HasSuffix(p, manifest.Suffix) {
+		return Manifest(p, opts)
+	}
+	if _, err := os.Stat(p); err != nil {
+		return []Result{{Artifact: p, Check: CheckIntegrity, Err: err}}
+	}
+	m, manifestPath := findManifest(p)
+	var results []Result
+	if m != nil {
+		results = append(results, statusResult(manifestPath, m))
+	}
+	return append(results, artifact(p, m, opts)...)
+}
+
+// Manifest 校验清单及其记录的所有备份文件。
+func Manifest(manifestPath string, opts Options) []Result {
+	m, err := manifest.Read(manifestPath)
+	if err != nil {
+		return []Result{{Artifact: manifestPath, Check: CheckManifest, Err: err}}
+	}
+	results := []Result{statusResult(manifestPath, m)}
+	dir := filepath.Dir(manifestPath)
+	for _, top := range topLevel(m) {
+		results = append(results, artifact(filepath.Join(dir, filepath.FromSlash(top)), m, opts)...)
+	}
+	if len(m.Files) == 0 {
+		results = append(results, Result{Artifact: manifestPath, Check: CheckChecksum, Err: errors.New("manifest lists no files")})
+	}
+	return results
+}
+
+func statusResult(manifestPath string, m *manifest.Manifest) Result {
+	r := Result{Artifact: manifestPath, Check: CheckManifest}
+	if m.Status != manifest.StatusSuccess {
+		r.Err = fmt.Errorf("backup %s recorded as %s: %s", m.Name, m.Status, m.Error)
+	}
+	return r
+}
+
+// topLevel 返回清单中文件的顶层路径（文件本身或所在的备份目录），保持原有顺序。
+func topLevel(m *manifest.Manifest) []string {
+	var tops []string
+	seen := map[string]bool{}
+	for _, f := range m.Files {
+		top, _, _ := strings.Cut(f.Path, "/")
+		if !seen[top] {
+			seen[top] = true
+			tops = append(tops, top)
+		}
+	}
+	return tops
+}
+
+// findManifest 在 p 所在目录查找记录了 p 的清单。
+func findManifest(p string) (*manifest.Manifest, string) {
+	dir := filepath.Dir(p)
+	base := filepath.Base(p)
+	paths, _ := filepath.Glob(filepath.Join(dir, "*"+manifest.Suffix))
+	for _, mp := range paths {
+		m, err := manifest.Read(mp)
+		if err != nil {
+			continue
+		}
+		for _, f := range m.Files {
+			if f.Path == base || strings.HasPrefix(f.Path, base+"/") {
+				return m, mp
+			}
+		}
+	}
+	return nil, ""
+}
+
+// artifact 校验单个备份文件或目录，m 为空时不校验 checksum。
+func artifact(p string, m *manifest.Manifest, opts Options) []Result {
+	var results []Result
+	if m != nil {
+		results = append(results, checksum(p, m))
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return append(results, Result{Artifact: p, Check: CheckIntegrity, Err: err})
+	}
+	if info.IsDir() {
+		return append(results, directory(p, m)...)
+	}
+	return append(results, file(p, m, opts)...)
+}
+
+// checksum 按清单校验 p 下所有文件的大小和 SHA-256。
+func checksum(p string, m *manifest.Manifest) Result {
+	r := Result{Artifact: p, Check: CheckChecksum}
+	checked, err := m.Check(filepath.Dir(p), filepath.Base(p))
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	r.Detail = fmt.Sprintf("%d file(s)", checked)
+	return r
+}
+
+// directory 校验备份目录：xtrabackup 目录检查 checkpoints，mongodump 目录检查元数据。
+func directory(dir string, m *manifest.Manifest) []Result {
+	if _, err := os.Stat(filepath.Join(dir, xtrabackup.CheckpointsFile)); err == nil || (m != nil && m.Tool == "xtrabackup") {
+		r := Result{Artifact: dir, Check: CheckCheckpoints}
+		cp, err := xtrabackup.ReadCheckpoints(dir)
+		r.Detail, r.Err = checkpointsResult(cp, err)
+		return []Result{r}
+	}
+	if m == nil || m.Tool == "mongodump" {
+		if r, ok := mongoDumpDir(dir, m != nil); ok {
+			return []Result{r}
+		}
+	}
+	return nil
+}
+
+func checkpointsResult(cp *xtrabackup.Checkpoints, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	if err := cp.Validate(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s from_lsn=%d to_lsn=%d", cp.BackupType, cp.FromLSN, cp.ToLSN), nil
+}
+
+// mongoDumpDir 检查 mongodump 输出目录中每个集合的 .bson 都有对应的 .metadata.json。
+// required 为 false 且目录中没有 mongodump 文件时返回 ok=false，表示不是 mongodump 目录。
+func mongoDumpDir(dir string, required bool) (Result, bool) {
+	r := Result{Artifact: dir, Check: CheckMongoDump}
+	var missing []string
+	collections := 0
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// 顶层的 oplog.bson 等文件没有元数据
+		if d.IsDir() || filepath.Dir(p) == dir {
+			return nil
+		}
+		name := strings.TrimSuffix(p, ".gz")
+		if !strings.HasSuffix(name, ".bson") {
+			return nil
+		}
+		collections++
+		meta := strings.TrimSuffix(name, ".bson") + ".metadata.json"
+		if !exists(meta) && !exists(meta+".gz") {
+			rel, _ := filepath.Rel(dir, p)
+			missing = append(missing, rel)
+		}
+		return nil
+	})
+	switch {
+	case err != nil:
+		r.Err = err
+	case collections == 0:
+		if !required {
+			return r, false
+		}
+		r.Err = errors.New("no mongodump collections found")
+	case len(missing) > 0:
+		r.Err = fmt.Errorf("metadata missing for %s", strings.Join(missing, ", "))
+	default:
+		r.Detail = fmt.Sprintf("%d collection(s)", collections)
+	}
+	return r, true
+}
+
+func exists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+// file 读出整个文件以校验加密和压缩数据流，并按文件类型检查内容。
+func file(p string, m *manifest.Manifest, opts Options) []Result {
+	integrity := Result{Artifact: p, Check: CheckIntegrity}
+	name := strings.TrimSuffix(p, crypt.Ext)
+	if name != p && opts.Key == nil {
+		integrity.Skipped = "encrypted, key file not given"
+		return []Result{integrity}
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		integrity.Err = err
+		return []Result{integrity}
+	}
+	defer f.Close()
+	var stream io.Reader = f
+	if name != p {
+		if stream, err = crypt.NewReader(f, opts.Key); err != nil {
+			integrity.Err = err
+			return []Result{integrity}
+		}
+	}
+	algo := compress.Detect(name)
+	name = compress.TrimExt(name)
+	if strings.HasSuffix(name, ".tar") {
+		// tar.gz 的压缩扩展名为 .gz，TrimExt 后剩下 .tar
+		return tarFile(p, stream, algo, integrity)
+	}
+	zr, err := compress.NewReader(stream, algo)
+	if err != nil {
+		integrity.Err = err
+		return []Result{integrity}
+	}
+	defer zr.Close()
+
+	switch {
+	case strings.HasSuffix(name, ".sql"):
+		tail := &tailWriter{}
+		if _, integrity.Err = io.Copy(tail, zr); integrity.Err != nil {
+			return []Result{integrity}
+		}
+		return []Result{integrity, dumpMarker(p, tail.buf, m)}
+	case strings.HasSuffix(name, ".xbstream"):
+		return xbstreamFile(p, zr, integrity)
+	case strings.HasSuffix(name, ".archive"):
+		head := make([]byte, 4)
+		if _, err := io.ReadFull(zr, head); err != nil {
+			integrity.Err = fmt.Errorf("read archive header: %w", err)
+			return []Result{integrity}
+		}
+		if _, integrity.Err = io.Copy(io.Discard, zr); integrity.Err != nil {
+			return []Result{integrity}
+		}
+		magic := Result{Artifact: p, Check: CheckMongoDump}
+		if binary.LittleEndian.Uint32(head) != mongoArchiveMagic {
+			magic.Err = errors.New("not a mongodump archive")
+		}
+		return []Result{integrity, magic}
+	}
+	_, integrity.Err = io.Copy(io.Discard, zr)
+	return []Result{integrity}
+}
+
+// tarFile 逐个读出 tar 中的文件，并检查其中的 xtrabackup_checkpoints。
+func tarFile(p string, stream io.Reader, algo string, integrity Result) []Result {
+	zr, err := compress.NewReader(stream, algo)
+	if err != nil {
+		integrity.Err = err
+		return []Result{integrity}
+	}
+	defer zr.Close()
+	var cp *xtrabackup.Checkpoints
+	var cpErr error
+	entries := 0
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			integrity.Err = fmt.Errorf("read tar: %w", err)
+			return []Result{integrity}
+		}
+		entries++
+		if path.Base(hdr.Name) == xtrabackup.CheckpointsFile {
+			cp, cpErr = xtrabackup.ParseCheckpoints(tr)
+		}
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			integrity.Err = fmt.Errorf("read tar entry %s: %w", hdr.Name, err)
+			return []Result{integrity}
+		}
+	}
+	// 读完 tar 结尾后 gzip 流中可能还有填充，读到底才会校验 gzip 的 CRC
+	if _, err := io.Copy(io.Discard, zr); err != nil {
+		integrity.Err = err
+		return []Result{integrity}
+	}
+	integrity.Detail = fmt.Sprintf("%d tar entries", entries)
+	results := []Result{integrity}
+	if cp != nil || cpErr != nil {
+		r := Result{Artifact: p, Check: CheckCheckpoints}
+		r.Detail, r.Err = checkpointsResult(cp, cpErr)
+		results = append(results, r)
+	}
+	return results
+}
+
+// xbstreamFile 逐块读出 xbstream 并校验每块的 CRC32，同时检查其中的 xtrabackup_checkpoints。
+func xbstreamFile(p string, stream io.Reader, integrity Result) []Result {
+	files := map[string]bool{}
+	var cpData []byte
+	x := xtrabackup.NewXbstreamReader(stream)
+	for {
+		c, err := x.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			integrity.Err = err
+			return []Result{integrity}
+		}
+		files[c.Path] = true
+		if c.Path == xtrabackup.CheckpointsFile && c.Type != xtrabackup.ChunkEOF {
+			cpData = append(cpData, c.Data...) // 文件的块按顺序写出
+		}
+	}
+	integrity.Detail = fmt.Sprintf("%d files in xbstream", len(files))
+	r := Result{Artifact: p, Check: CheckCheckpoints}
+	if cpData == nil {
+		r.Err = errors.New("xtrabackup_checkpoints not found in xbstream")
+	} else {
+		r.Detail, r.Err = checkpointsResult(xtrabackup.ParseCheckpoints(bytes.NewReader(cpData)))
+	}
+	return []Result{integrity, r}
+}
+
+// dumpMarker 检查逻辑备份末尾的结束标记。清单记录了导出工具时只接受该工具的标记。
+func dumpMarker(p string, tail []byte, m *manifest.Manifest) Result {
+	r := Result{Artifact: p, Check: CheckDumpMarker}
+	var markers [][]byte
+	tool := ""
+	if m != nil {
+		tool = m.Tool
+	}
+	switch tool {
+	case "mysqldump":
+		markers = [][]byte{mysqldumpMarker}
+	case "pg_dump", "pg_dumpall":
+		markers = pgDumpMarkers
+	default:
+		markers = append([][]byte{mysqldumpMarker}, pgDumpMarkers...)
+	}
+	for _, marker := range markers {
+		if bytes.Contains(tail, marker) {
+			r.Detail = string(marker)
+			return r
+		}
+	}
+	r.Err = errors.New("dump completion marker not found, the dump is probably truncated")
+	return r
+}
+
+// tailWriter 只保留最后 tailSize 字节。
+type tailWriter struct {
+	buf []byte
+}
+
+func (t *tailWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(p) >= tailSize {
+		t.buf = append(t.buf[:0], p[len(p)-tailSize:]...)
+		return n, nil
+	}
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > tailSize {
+		t.buf = append(t.buf[:0], t.buf[len(t.buf)-tailSize:]...)
+	}
+	return n, nil
+}
@@ -0,0 +1,234 @@
+package verify
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LYcoding0/dbbackup/internal/crypt"
+	"github.com/LYcoding0/dbbackup/internal/manifest"
+)
+
+const dump = "-- MySQL dump 10.13\nINSERT INTO t VALUES (1);\n-- Dump completed on 2024-05-01  2:00:01\n"
+
+// gz 返回 gzip 压缩后的 data
+func gz(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// writeFile 写入 dir/name，目录不存在时创建
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	p := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// writeManifest 为 dir 下的 paths 写入工具为 tool 的成功清单，返回清单路径
+func writeManifest(t *testing.T, dir, name, tool string, paths ...string) string {
+	t.Helper()
+	m := manifest.New(name)
+	m.Tool, m.Status = tool, manifest.StatusSuccess
+	for _, p := range paths {
+		if err := m.AddPath(dir, filepath.Join(dir, p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mp := manifest.PathFor(dir, name)
+	if err := manifest.Write(mp, m); err != nil {
+		t.Fatal(err)
+	}
+	return mp
+}
+
+// summary 把结果格式化为“检查项=PASS/FAIL/SKIP”，以空格分隔
+func summary(results []Result) string {
+	var parts []string
+	for _, r := range results {
+		status := "PASS"
+		switch {
+		case r.Err != nil:
+			status = "FAIL"
+		case r.Skipped != "":
+			status = "SKIP"
+		}
+		parts = append(parts, r.Check+"="+status)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestDump(t *testing.T) {
+	dir := t.TempDir()
+	name := "mysql_app_20240501_020000"
+	p := writeFile(t, dir, name+".sql.gz", gz([]byte(dump)))
+	mp := writeManifest(t, dir, name, "mysqldump", name+".sql.gz")
+
+	want := "manifest=PASS checksum=PASS integrity=PASS dump-marker=PASS"
+	if got := summary(Manifest(mp, Options{})); got != want {
+		t.Errorf("Manifest = %s, want %s", got, want)
+	}
+	// 指定备份文件时在同目录下找到清单
+	if got := summary(Path(p, Options{})); got != want {
+		t.Errorf("Path = %s, want %s", got, want)
+	}
+
+	// 清单记录为 mysqldump 时不接受 pg_dump 的结束标记
+	writeFile(t, dir, name+".sql.gz", gz([]byte("-- PostgreSQL database dump complete\n")))
+	writeManifest(t, dir, name, "mysqldump", name+".sql.gz")
+	if got := summary(Path(p, Options{})); got != "manifest=PASS checksum=PASS integrity=PASS dump-marker=FAIL" {
+		t.Errorf("pg_dump marker in a mysqldump backup: %s", got)
+	}
+
+	// 备份后文件被改动
+	writeFile(t, dir, name+".sql.gz", gz([]byte(dump+"-- extra\n")))
+	if got := summary(Manifest(mp, Options{})); !strings.HasPrefix(got, "manifest=PASS checksum=FAIL") {
+		t.Errorf("modified file: %s", got)
+	}
+
+	// 没有清单的截断文件：gzip 数据流不完整
+	data := gz(bytes.Repeat([]byte(dump), 100))
+	p = writeFile(t, t.TempDir(), "pg_app_20240501_020000.sql.gz", data[:len(data)/2])
+	if got := summary(Path(p, Options{})); got != "integrity=FAIL" {
+		t.Errorf("truncated gzip: %s", got)
+	}
+
+	// 导出中断，没有结束标记
+	p = writeFile(t, t.TempDir(), "pg_app_20240501_020000.sql", []byte("-- PostgreSQL database dump\nCOPY t FROM stdin;\n"))
+	if got := summary(Path(p, Options{})); got != "integrity=PASS dump-marker=FAIL" {
+		t.Errorf("dump without marker: %s", got)
+	}
+}
+
+func TestManifestStatus(t *testing.T) {
+	dir := t.TempDir()
+	name := "mysql_app_20240501_020000"
+	writeFile(t, dir, name+".sql", []byte(dump))
+	m := manifest.New(name)
+	m.Finish(os.ErrDeadlineExceeded)
+	mp := manifest.PathFor(dir, name)
+	if err := manifest.Write(mp, m); err != nil {
+		t.Fatal(err)
+	}
+	if got := summary(Manifest(mp, Options{})); got != "manifest=FAIL checksum=FAIL" {
+		t.Errorf("failed backup without files: %s", got)
+	}
+	if got := summary(Manifest(filepath.Join(dir, "missing"+manifest.Suffix), Options{})); got != "manifest=FAIL" {
+		t.Errorf("missing manifest: %s", got)
+	}
+}
+
+func TestEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := writeFile(t, dir, "backup.key", bytes.Repeat([]byte{7}, 32))
+	key, err := crypt.LoadKey(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	cw, err := crypt.NewWriter(&buf, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cw.Write(gz([]byte(dump)))
+	cw.Close()
+	p := writeFile(t, dir, "mysql_app_20240501_020000.sql.gz.enc", buf.Bytes())
+
+	if got := summary(Path(p, Options{})); got != "integrity=SKIP" {
+		t.Errorf("without key: %s", got)
+	}
+	if got := summary(Path(p, Options{Key: key})); got != "integrity=PASS dump-marker=PASS" {
+		t.Errorf("with key: %s", got)
+	}
+	other, _ := crypt.LoadKey(writeFile(t, dir, "other.key", bytes.Repeat([]byte{8}, 32)))
+	if got := summary(Path(p, Options{Key: other})); got != "integrity=FAIL" {
+		t.Errorf("with another key: %s", got)
+	}
+}
+
+// tarGz 返回包含 files 的 tar.gz
+func tarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, data := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(data))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return gz(buf.Bytes())
+}
+
+func TestXtrabackup(t *testing.T) {
+	dir := t.TempDir()
+	good := "backup_type = full-backuped\nfrom_lsn = 0\nto_lsn = 100\nlast_lsn = 100\n"
+	bad := "backup_type = full-backuped\nfrom_lsn = 0\nto_lsn = 0\n"
+
+	p := writeFile(t, dir, "mysql_full_20240501_020000.tar.gz", tarGz(t, map[string]string{
+		"xtrabackup_checkpoints": good, "ibdata1": "innodb",
+	}))
+	if got := summary(Path(p, Options{})); got != "integrity=PASS checkpoints=PASS" {
+		t.Errorf("tar.gz: %s", got)
+	}
+	p = writeFile(t, dir, "mysql_full_20240502_020000.tar.gz", tarGz(t, map[string]string{"xtrabackup_checkpoints": bad}))
+	if got := summary(Path(p, Options{})); got != "integrity=PASS checkpoints=FAIL" {
+		t.Errorf("tar.gz with bad checkpoints: %s", got)
+	}
+
+	// 备份目录
+	writeFile(t, dir, "mysql_full_20240503_020000/xtrabackup_checkpoints", []byte(good))
+	writeFile(t, dir, "mysql_full_20240503_020000/ibdata1", []byte("innodb"))
+	mp := writeManifest(t, dir, "mysql_full_20240503_020000", "xtrabackup", "mysql_full_20240503_020000")
+	if got := summary(Manifest(mp, Options{})); got != "manifest=PASS checksum=PASS checkpoints=PASS" {
+		t.Errorf("directory: %s", got)
+	}
+	// 清单记录为 xtrabackup 的目录缺少 checkpoints
+	os.Remove(filepath.Join(dir, "mysql_full_20240503_020000/xtrabackup_checkpoints"))
+	mp = writeManifest(t, dir, "mysql_full_20240503_020000", "xtrabackup", "mysql_full_20240503_020000")
+	if got := summary(Manifest(mp, Options{})); got != "manifest=PASS checksum=PASS checkpoints=FAIL" {
+		t.Errorf("directory without checkpoints: %s", got)
+	}
+}
+
+func TestMongoDump(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "mongo_20240501_020000/app/users.bson.gz", gz([]byte("bson")))
+	writeFile(t, dir, "mongo_20240501_020000/app/users.metadata.json.gz", gz([]byte("{}")))
+	writeFile(t, dir, "mongo_20240501_020000/app/orders.bson", []byte("bson"))
+	writeFile(t, dir, "mongo_20240501_020000/oplog.bson", []byte("bson"))
+	p := filepath.Join(dir, "mongo_20240501_020000")
+	if got := summary(Path(p, Options{})); got != "mongodump=FAIL" {
+		t.Errorf("collection without metadata: %s", got)
+	}
+	writeFile(t, dir, "mongo_20240501_020000/app/orders.metadata.json", []byte("{}"))
+	if got := summary(Path(p, Options{})); got != "mongodump=PASS" {
+		t.Errorf("complete dump: %s", got)
+	}
+
+	archive := binary.LittleEndian.AppendUint32(nil, mongoArchiveMagic)
+	p = writeFile(t, dir, "mongo_app_20240501_020000.archive.gz", gz(append(archive, "data"...)))
+	if got := summary(Path(p, Options{})); got != "integrity=PASS mongodump=PASS" {
+		t.Errorf("archive: %s", got)
+	}
+	p = writeFile(t, dir, "mongo_app_20240502_020000.archive.gz", gz([]byte("not an archive")))
+	if got := summary(Path(p, Options{})); got != "integrity=PASS mongodump=FAIL" {
+		t.Errorf("bad archive: %s", got)
+	}
+}
@@ -0,0 +1,100 @@
+// Package xtrabackup 解析 Percona XtraBackup 备份中的元数据文件。
+package xtrabackup
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CheckpointsFile 备份目录中记录 LSN 的文件名。
+const CheckpointsFile = "xtrabackup_checkpoints"
+
+// backup_type 的取值。
+const (
+	TypeFull         = "full-backuped"
+	TypeIncremental  = "incremental"
+	TypeLogApplied   = "log-applied"
+	TypeFullPrepared = "full-prepared"
+)
+
+// Checkpoints 对应 xtrabackup_checkpoints 文件内容。
+type Checkpoints struct {
+	BackupType string
+	FromLSN    uint64
+	ToLSN      uint64
+	LastLSN    uint64
+}
+
+// ParseCheckpoints 解析 xtrabackup_checkpoints 内容。
+func ParseCheckpoints(r io.Reader) (*Checkpoints, error) {
+	cp := &Checkpoints{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		var err error
+		switch key {
+		case "backup_type":
+			cp.BackupType = value
+		case "from_lsn":
+			cp.FromLSN, err = strconv.ParseUint(value, 10, 64)
+		case "to_lsn":
+			cp.ToLSN, err = strconv.ParseUint(value, 10, 64)
+		case "last_lsn":
+			cp.LastLSN, err = strconv.ParseUint(value, 10, 64)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", key, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if cp.BackupType == "" {
+		return nil, errors.New("backup_type missing in " + CheckpointsFile)
+	}
+	return cp, nil
+}
+
+// ReadCheckpoints 读取备份目录 dir 中的 xtrabackup_checkpoints。
+func ReadCheckpoints(dir string) (*Checkpoints, error) {
+	f, err := os.Open(filepath.Join(dir, CheckpointsFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseCheckpoints(f)
+}
+
+// Validate 检查 LSN 是否自洽，不自洽说明备份未正常完成或文件被改动。
+func (cp *Checkpoints) Validate() error {
+	switch cp.BackupType {
+	case TypeFull, TypeFullPrepared:
+		if cp.FromLSN != 0 {
+			return fmt.Errorf("full backup has from_lsn=%d, want 0", cp.FromLSN)
+		}
+	case TypeIncremental, TypeLogApplied:
+	default:
+		return fmt.Errorf("unknown backup_type %q", cp.BackupType)
+	}
+	if cp.ToLSN == 0 {
+		return errors.New("to_lsn is 0")
+	}
+	if cp.ToLSN < cp.FromLSN {
+		return fmt.Errorf("to_lsn %d is before from_lsn %d", cp.ToLSN, cp.FromLSN)
+	}
+	if cp.LastLSN != 0 && cp.LastLSN < cp.ToLSN {
+		return fmt.Errorf("last_lsn %d is before to_lsn %d", cp.LastLSN, cp.ToLSN)
+	}
+	return nil
+}
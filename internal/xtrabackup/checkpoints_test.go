@@ -0,0 +1,82 @@
+package xtrabackup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseCheckpoints(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		in   string
+		want Checkpoints
+		err  string // 为空表示成功
+	}{
+		{"full", "backup_type = full-backuped\nfrom_lsn = 0\nto_lsn = 18463512\nlast_lsn = 18463521\nflushed_lsn = 18463521\n",
+			Checkpoints{BackupType: TypeFull, ToLSN: 18463512, LastLSN: 18463521}, ""},
+		{"incremental", "backup_type = incremental\nfrom_lsn = 18463512\nto_lsn = 18502281\nlast_lsn = 18502290\ncompact = 0\n",
+			Checkpoints{BackupType: TypeIncremental, FromLSN: 18463512, ToLSN: 18502281, LastLSN: 18502290}, ""},
+		// 没有空格、有空行和无关内容
+		{"loose format", "\nbackup_type=log-applied\r\nfrom_lsn=0\nrecover_binlog_info = 0\nto_lsn=42\n",
+			Checkpoints{BackupType: TypeLogApplied, ToLSN: 42}, ""},
+		{"bad lsn", "backup_type = full-backuped\nto_lsn = 12ab\n", Checkpoints{}, "parse to_lsn"},
+		{"no backup_type", "from_lsn = 0\nto_lsn = 42\n", Checkpoints{}, "backup_type missing"},
+		{"empty", "", Checkpoints{}, "backup_type missing"},
+	} {
+		cp, err := ParseCheckpoints(strings.NewReader(tt.in))
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: err = %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if *cp != tt.want {
+			t.Errorf("%s: %+v, want %+v", tt.name, *cp, tt.want)
+		}
+	}
+}
+
+func TestReadCheckpoints(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := ReadCheckpoints(dir); !os.IsNotExist(err) {
+		t.Errorf("ReadCheckpoints without the file = %v, want not exist", err)
+	}
+	data := "backup_type = full-prepared\nfrom_lsn = 0\nto_lsn = 100\nlast_lsn = 100\n"
+	if err := os.WriteFile(filepath.Join(dir, CheckpointsFile), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cp, err := ReadCheckpoints(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.BackupType != TypeFullPrepared || cp.ToLSN != 100 {
+		t.Errorf("checkpoints = %+v", *cp)
+	}
+}
+
+func TestCheckpointsValidate(t *testing.T) {
+	for _, tt := range []struct {
+		cp  Checkpoints
+		err string // 为空表示有效
+	}{
+		{Checkpoints{BackupType: TypeFull, ToLSN: 100, LastLSN: 100}, ""},
+		{Checkpoints{BackupType: TypeIncremental, FromLSN: 100, ToLSN: 100}, ""},
+		{Checkpoints{BackupType: TypeIncremental, FromLSN: 100, ToLSN: 200}, ""},
+		{Checkpoints{BackupType: TypeFull, FromLSN: 5, ToLSN: 100}, "from_lsn=5"},
+		{Checkpoints{BackupType: "partial", ToLSN: 100}, "unknown backup_type"},
+		{Checkpoints{BackupType: TypeFull}, "to_lsn is 0"},
+		{Checkpoints{BackupType: TypeIncremental, FromLSN: 200, ToLSN: 100}, "before from_lsn"},
+		{Checkpoints{BackupType: TypeFull, ToLSN: 100, LastLSN: 99}, "last_lsn 99"},
+	} {
+		err := tt.cp.Validate()
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("Validate(%+v) = %v, want %q", tt.cp, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package xtrabackup
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// xbstream 数据块格式（小端）：
+//
+//	"XBSTCK01" | flags 1 | type 1 | path len 4 | path
+//	type=E 到此结束；type=P/S：[S: sparse map 数 4] | payload len 8 | offset 8 | crc32 4 | [S: sparse map] | payload
+var xbstreamMagic = []byte("XBSTCK01")
+
+// 数据块类型。
+const (
+	ChunkPayload = 'P'
+	ChunkSparse  = 'S'
+	ChunkEOF     = 'E'
+
+	chunkIgnorable = 0x01
+)
+
+// Chunk xbstream 中的一个数据块。
+type Chunk struct {
+	Path   string
+	Type   byte
+	Offset uint64
+	Data   []byte
+}
+
+// XbstreamReader 逐块读取 xtrabackup --stream=xbstream 的输出，并校验 payload 的 CRC32。
+type XbstreamReader struct {
+	r *bufio.Reader
+}
+
+// NewXbstreamReader 返回从 r 读取的 XbstreamReader。
+func NewXbstreamReader(r io.Reader) *XbstreamReader {
+	return &XbstreamReader{r: bufio.NewReaderSize(r, 1<<20)}
+}
+
+// Next 返回下一个数据块，流结束时返回 io.EOF。
+func (x *XbstreamReader) Next() (*Chunk, error) {
+	head := make([]byte, len(xbstreamMagic)+6)
+	if _, err := io.ReadFull(x.r, head); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errors.New("xbstream: truncated chunk header")
+		}
+		return nil, err
+	}
+	if !bytes.Equal(head[:len(xbstreamMagic)], xbstreamMagic) {
+		return nil, errors.New("xbstream: bad chunk magic")
+	}
+	flags, typ := head[8], head[9]
+	pathLen := binary.LittleEndian.Uint32(head[10:])
+	if pathLen > 4096 {
+		return nil, fmt.Errorf("xbstream: path length %d too large", pathLen)
+	}
+	p := make([]byte, pathLen)
+	if err := x.read(p); err != nil {
+		return nil, err
+	}
+	c := &Chunk{Path: string(p), Type: typ}
+	switch typ {
+	case ChunkEOF:
+		return c, nil
+	case ChunkPayload, ChunkSparse:
+	default:
+		if flags&chunkIgnorable == 0 {
+			return nil, fmt.Errorf("xbstream: unknown chunk type %q for %s", typ, c.Path)
+		}
+	}
+
+	var sparseEntries uint32
+	if typ == ChunkSparse {
+		buf := make([]byte, 4)
+		if err := x.read(buf); err != nil {
+			return nil, err
+		}
+		sparseEntries = binary.LittleEndian.Uint32(buf)
+	}
+	buf := make([]byte, 20)
+	if err := x.read(buf); err != nil {
+		return nil, err
+	}
+	length := binary.LittleEndian.Uint64(buf)
+	c.Offset = binary.LittleEndian.Uint64(buf[8:])
+	checksum := binary.LittleEndian.Uint32(buf[16:])
+	if length > 1<<30 {
+		return nil, fmt.Errorf("xbstream: payload length %d too large", length)
+	}
+	if sparseEntries > 0 {
+		if _, err := io.CopyN(io.Discard, x.r, int64(sparseEntries)*8); err != nil {
+			return nil, fmt.Errorf("xbstream: truncated sparse map for %s", c.Path)
+		}
+	}
+	c.Data = make([]byte, length)
+	if err := x.read(c.Data); err != nil {
+		return nil, err
+	}
+	// sparse 块的校验和覆盖范围因版本而异，只校验普通块
+	if typ == ChunkPayload && crc32.ChecksumIEEE(c.Data) != checksum {
+		return nil, fmt.Errorf("xbstream: checksum mismatch in %s at offset %d", c.Path, c.Offset)
+	}
+	return c, nil
+}
+
+func (x *XbstreamReader) read(p []byte) error {
+	if _, err := io.ReadFull(x.r, p); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errors.New("xbstream: truncated chunk")
+		}
+		return err
+	}
+	return nil
+}
+
+// ReadXbstreamFile 从 xbstream 中读出文件 name 的内容，读到该文件的结束块为止。
+func ReadXbstreamFile(r io.Reader, name string) ([]byte, error) {
+	x := NewXbstreamReader(r)
+	var data []byte
+	found := false
+	for {
+		c, err := x.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if c.Path != name {
+			continue
+		}
+		found = true
+		if c.Type == ChunkEOF {
+			return data, nil
+		}
+		end := c.Offset + uint64(len(c.Data))
+		if end > uint64(len(data)) {
+			data = append(data, make([]byte, end-uint64(len(data)))...)
+		}
+		copy(data[c.Offset:], c.Data)
+	}
+	if !found {
+		return nil, fmt.Errorf("%s not found in xbstream", name)
+	}
+	return data, nil
+}
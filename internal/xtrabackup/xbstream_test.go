@@ -0,0 +1,91 @@
+package xtrabackup
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"strings"
+	"testing"
+)
+
+// chunk 按 xbstream 格式编码一个数据块，typ 为 ChunkEOF 时没有 payload
+func chunk(path string, typ byte, offset uint64, data []byte) []byte {
+	b := append([]byte{}, xbstreamMagic...)
+	b = append(b, 0, typ)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(path)))
+	b = append(b, path...)
+	if typ == ChunkEOF {
+		return b
+	}
+	b = binary.LittleEndian.AppendUint64(b, uint64(len(data)))
+	b = binary.LittleEndian.AppendUint64(b, offset)
+	b = binary.LittleEndian.AppendUint32(b, crc32.ChecksumIEEE(data))
+	return append(b, data...)
+}
+
+func TestReadXbstreamFile(t *testing.T) {
+	var stream []byte
+	stream = append(stream, chunk("ibdata1", ChunkPayload, 0, []byte("innodb"))...)
+	stream = append(stream, chunk(CheckpointsFile, ChunkPayload, 0, []byte("backup_type = full-backuped\n"))...)
+	stream = append(stream, chunk(CheckpointsFile, ChunkPayload, 28, []byte("to_lsn = 42\n"))...)
+	stream = append(stream, chunk(CheckpointsFile, ChunkEOF, 0, nil)...)
+	stream = append(stream, chunk("ibdata1", ChunkEOF, 0, nil)...)
+
+	data, err := ReadXbstreamFile(bytes.NewReader(stream), CheckpointsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp, err := ParseCheckpoints(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.BackupType != TypeFull || cp.ToLSN != 42 {
+		t.Errorf("checkpoints = %+v", *cp)
+	}
+	if _, err := ReadXbstreamFile(bytes.NewReader(stream), "missing"); err == nil {
+		t.Error("ReadXbstreamFile of a missing file succeeded")
+	}
+
+	x := NewXbstreamReader(bytes.NewReader(stream))
+	n := 0
+	for {
+		_, err := x.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+	if n != 5 {
+		t.Errorf("read %d chunk(s), want 5", n)
+	}
+}
+
+func TestXbstreamErrors(t *testing.T) {
+	good := chunk("ibdata1", ChunkPayload, 0, []byte("innodb"))
+	corrupt := append([]byte{}, good...)
+	corrupt[len(corrupt)-1] ^= 0xff
+	unknown := chunk("ibdata1", 'X', 0, []byte("x"))
+	ignorable := chunk("ibdata1", 'X', 0, []byte("x"))
+	ignorable[8] = chunkIgnorable
+	for _, tt := range []struct {
+		name   string
+		stream []byte
+		err    string // 为空表示成功
+	}{
+		{"checksum", corrupt, "checksum mismatch"},
+		{"truncated header", good[:10], "truncated chunk header"},
+		{"truncated payload", good[:len(good)-2], "truncated chunk"},
+		{"bad magic", append([]byte("XBSTCK02"), good[8:]...), "bad chunk magic"},
+		{"unknown type", unknown, "unknown chunk type"},
+		{"ignorable type", ignorable, ""},
+	} {
+		_, err := NewXbstreamReader(bytes.NewReader(tt.stream)).Next()
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LYcoding0/dbbackup/internal/compress"
+	"github.com/LYcoding0/dbbackup/internal/crypt"
+	"github.com/LYcoding0/dbbackup/internal/manifest"
+	"github.com/LYcoding0/dbbackup/internal/metrics"
+	"github.com/LYcoding0/dbbackup/internal/notify"
+	"github.com/LYcoding0/dbbackup/internal/pool"
+	"github.com/LYcoding0/dbbackup/internal/retention"
+	"github.com/LYcoding0/dbbackup/internal/schedule"
+	"github.com/LYcoding0/dbbackup/internal/storage"
+)
+
+// JobsConfig -config 指定的多目标备份配置，顶层字段为各目标的默认值
+type JobsConfig struct {
+	OutputDir     string           `json:"output_dir"`     // 默认 ./backups，各目标写入 <output_dir>/<name>
+	Compress      string           `json:"compress"`       // none、gzip 或 zstd
+	CompressLevel int              `json:"compress_level"` // 0 表示默认级别
+	KeyFile       string           `json:"key_file"`       // 加密密钥文件，为空不加密
+	Concurrency   int              `json:"concurrency"`    // 同时备份的目标数，默认 4
+	PerHostLimit  int              `json:"per_host_limit"` // 同一 host:port 同时备份的目标数，默认 1
+	FailFast      bool             `json:"fail_fast"`      // 有目标失败后不再启动剩余目标
+	Overlap       string           `json:"overlap"`        // daemon 模式下上次备份未结束时：skip（默认）或 queue
+	Storage       storage.Config   `json:"storage"`        // 备份完成后上传到 <url>/<name>/，url 为空不上传
+	Retention     retention.Policy `json:"retention"`      // 备份后清理输出目录和存储中的过期备份，为空不清理
+	Notify        []notify.Config  `json:"notify"`         // 每个目标备份结束后发送通知的通道
+	Metrics       metrics.Config   `json:"metrics"`        // 每个目标备份结束后更新的 Prometheus 指标
+	HistoryFile   string           `json:"history_file"`   // 运行记录（JSONL），默认 <output_dir>/history.jsonl，"-" 不记录
+	Targets       []TargetConfig   `json:"targets"`
+}
+
+// TargetConfig 配置文件中的一个备份目标
+type TargetConfig struct {
+	Name          string                 `json:"name"` // 目标名称，用于 -targets 选择和结果汇总
+	Type          string                 `json:"type"` // 引擎名称，同 -type
+	Host          string                 `json:"host"`
+	Port          int                    `json:"port"` // 0 表示引擎默认端口
+	User          string                 `json:"user"`
+	Password      string                 `json:"password"`
+	PasswordEnv   string                 `json:"password_env"` // 从环境变量读取密码，避免明文写在配置中
+	Databases     []string               `json:"databases"`    // 每个数据库单独备份，为空时按引擎参数备份
+	OutputDir     string                 `json:"output_dir"`
+	Compress      string                 `json:"compress"`
+	CompressLevel int                    `json:"compress_level"`
+	KeyFile       string                 `json:"key_file"`
+	Options       map[string]interface{} `json:"options"`   // 引擎特定参数，键同命令行参数名，例如 mysql-tool
+	Schedule      string                 `json:"schedule"`  // daemon 模式的 cron 表达式，例如 "0 2 * * *"
+	Overlap       string                 `json:"overlap"`   // 覆盖顶层 overlap
+	Storage       storage.Config         `json:"storage"`   // 覆盖顶层 storage
+	Retention     retention.Policy       `json:"retention"` // 覆盖顶层 retention
+	Notify        []notify.Config        `json:"notify"`    // 覆盖顶层 notify
+}
+
+// jobResult 一个目标的备份结果
+type jobResult struct {
+	Name      string
+	Backups   []string             // 已生成的备份名
+	Size      int64                // 已生成备份的总大小
+	Pruned    []string             // 按保留策略删除的备份
+	Manifests []*manifest.Manifest // 已生成备份的清单
+	Start     time.Time
+	Duration  time.Duration
+	Err       error
+}
+
+// loadJobsConfig 读取并检查多目标配置，目标的空字段使用顶层默认值
+func loadJobsConfig(path string) (*JobsConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg JobsConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	if len(cfg.Targets) == 0 {
+		return nil, errors.New("no targets defined")
+	}
+	if cfg.OutputDir == "" {
+		cfg.OutputDir = "./backups"
+	}
+	switch cfg.HistoryFile {
+	case "":
+		cfg.HistoryFile = filepath.Join(cfg.OutputDir, "history.jsonl")
+	case "-":
+		cfg.HistoryFile = ""
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 4
+	}
+	if cfg.PerHostLimit <= 0 {
+		cfg.PerHostLimit = 1
+	}
+	if err := cfg.Metrics.Validate(); err != nil {
+		return nil, fmt.Errorf("metrics: %v", err)
+	}
+	seen := map[string]bool{}
+	dirs := map[string]string{} // 输出目录 -> 目标名
+	for i := range cfg.Targets {
+		tc := &cfg.Targets[i]
+		if tc.Name == "" {
+			return nil, fmt.Errorf("targets[%d]: name is required", i)
+		}
+		if seen[tc.Name] {
+			return nil, fmt.Errorf("target %s defined twice", tc.Name)
+		}
+		seen[tc.Name] = true
+		// 各目标默认写入自己的子目录，并发备份同名数据库时文件名不会冲突
+		if tc.OutputDir == "" {
+			tc.OutputDir = filepath.Join(cfg.OutputDir, tc.Name)
+		}
+		// 保留策略按目录清理备份，共用目录的目标会互相删除对方的备份
+		dir, err := filepath.Abs(tc.OutputDir)
+		if err != nil {
+			return nil, fmt.Errorf("target %s: %v", tc.Name, err)
+		}
+		if other, ok := dirs[dir]; ok {
+			return nil, fmt.Errorf("targets %s and %s share output_dir %s", other, tc.Name, tc.OutputDir)
+		}
+		dirs[dir] = tc.Name
+		if tc.Compress == "" {
+			tc.Compress, tc.CompressLevel = cfg.Compress, cfg.CompressLevel
+		}
+		if tc.KeyFile == "" {
+			tc.KeyFile = cfg.KeyFile
+		}
+		if tc.Overlap == "" {
+			tc.Overlap = cfg.Overlap
+		}
+		if tc.Storage.URL == "" {
+			tc.Storage = cfg.Storage
+		}
+		if tc.Retention.IsZero() {
+			tc.Retention = cfg.Retention
+		}
+		if len(tc.Notify) == 0 {
+			tc.Notify = cfg.Notify
+		}
+		if err := tc.check(); err != nil {
+			return nil, fmt.Errorf("target %s: %v", tc.Name, err)
+		}
+	}
+	return &cfg, nil
+}
+
+// check 检查目标配置，不连接数据库
+func (tc *TargetConfig) check() error {
+	d, err := lookupDriver(strings.ToLower(tc.Type))
+	if err != nil {
+		return err
+	}
+	if tc.User == "" {
+		return errors.New("user is required")
+	}
+	if tc.Password != "" && tc.PasswordEnv != "" {
+		return errors.New("password and password_env are mutually exclusive")
+	}
+	known := map[string]bool{}
+	for _, opt := range d.Options() {
+		known[opt.Name] = true
+	}
+	for name, value := range tc.Options {
+		if !known[name] {
+			return fmt.Errorf("unknown option %q for %s", name, d.Name())
+		}
+		// 指定了 databases 时逐库备份，不能同时备份所有数据库
+		if all, _ := strconv.ParseBool(fmt.Sprint(value)); all && isAllOption(name) && len(tc.Databases) > 0 {
+			return fmt.Errorf("option %s conflicts with databases", name)
+		}
+	}
+	if tc.Schedule != "" {
+		if _, err := schedule.Parse(tc.Schedule); err != nil {
+			return err
+		}
+	}
+	if err := schedule.ValidateOverlap(tc.Overlap); err != nil {
+		return err
+	}
+	if err := storage.Validate(tc.Storage); err != nil {
+		return err
+	}
+	if err := tc.Retention.Validate(); err != nil {
+		return err
+	}
+	for i, c := range tc.Notify {
+		if err := notify.Validate(c); err != nil {
+			return fmt.Errorf("notify[%d]: %v", i, err)
+		}
+	}
+	return compress.Validate(tc.Compress, tc.CompressLevel)
+}
+
+// selectTargets 按名称选择目标，names 为空时返回全部
+func (cfg *JobsConfig) selectTargets(names []string) ([]TargetConfig, error) {
+	if len(names) == 0 {
+		return cfg.Targets, nil
+	}
+	var selected []TargetConfig
+	for _, name := range names {
+		found := false
+		for _, tc := range cfg.Targets {
+			if tc.Name == name {
+				selected = append(selected, tc)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("target %s not found in config", name)
+		}
+	}
+	return selected, nil
+}
+
+// hostKey 目标的 host:port，用于限制同一数据库服务器上的并发备份
+func (tc *TargetConfig) hostKey() string {
+	host, port := tc.Host, strconv.Itoa(tc.Port)
+	if host == "" {
+		host = "localhost"
+	}
+	if tc.Port == 0 {
+		if d, err := lookupDriver(strings.ToLower(tc.Type)); err == nil {
+			port = d.DefaultPort()
+		}
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// targets 由配置生成每次备份的连接参数，配置了多个数据库时每个库一个Target
+func (tc *TargetConfig) targets(d Driver) ([]*Target, error) {
+	password := tc.Password
+	if tc.PasswordEnv != "" {
+		password = os.Getenv(tc.PasswordEnv)
+		if password == "" {
+			return nil, fmt.Errorf("environment variable %s is not set", tc.PasswordEnv)
+		}
+	}
+	var key *crypt.Key
+	if tc.KeyFile != "" {
+		var err error
+		if key, err = crypt.LoadKey(tc.KeyFile); err != nil {
+			return nil, err
+		}
+	}
+	port := ""
+	if tc.Port != 0 {
+		port = strconv.Itoa(tc.Port)
+	}
+
+	databases := tc.Databases
+	if len(databases) == 0 {
+		databases = []string{""}
+	}
+	var targets []*Target
+	for _, db := range databases {
+		t := &Target{
+			Type:     d.Name(),
+			Host:     tc.Host,
+			Port:     port,
+			Username: tc.User,
+			Password: password,
+			Database: db,
+			Options:  map[string]string{},
+			Output: OutputOptions{
+				Compress:      tc.Compress,
+				CompressLevel: tc.CompressLevel,
+				EncryptKey:    key,
+			},
+		}
+		if t.Host == "" {
+			t.Host = "localhost"
+		}
+		for name, value := range tc.Options {
+			t.Options[name] = fmt.Sprint(value)
+		}
+		// mysql-all 默认为 true，指定数据库时改为只备份该库
+		if db != "" {
+			for _, opt := range d.Options() {
+				if _, ok := t.Options[opt.Name]; !ok && isAllOption(opt.Name) {
+					t.Options[opt.Name] = "false"
+				}
+			}
+		}
+		applyDriverDefaults(d, t)
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// isAllOption 是否为备份所有数据库的引擎参数，例如 mysql-all
+func isAllOption(name string) bool {
+	return strings.HasSuffix(name, "-all")
+}
+
+// runJob 备份一个目标的所有数据库，某个库失败后继续备份其余的库
+func runJob(tc TargetConfig) *jobResult {
+	res := &jobResult{Name: tc.Name, Start: time.Now()}
+	defer func() { res.Duration = time.Since(res.Start) }()
+
+	d, err := lookupDriver(strings.ToLower(tc.Type))
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	targets, err := tc.targets(d)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	if err := os.MkdirAll(tc.OutputDir, 0755); err != nil {
+		res.Err = fmt.Errorf("create output directory: %v", err)
+		return res
+	}
+
+	var errs []string
+	var done []*manifest.Manifest
+	for _, t := range targets {
+		if err := d.Validate(t); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		m, err := runBackup(d, t, tc.OutputDir)
+		if m != nil && err == nil {
+			res.Backups = append(res.Backups, m.Name)
+			res.Size += m.Size
+			done = append(done, m)
+		}
+		if err != nil {
+			if t.Database != "" {
+				err = fmt.Errorf("%s: %v", t.Database, err)
+			}
+			errs = append(errs, err.Error())
+		}
+	}
+	res.Manifests = done
+	uploaded := true
+	if len(done) > 0 && tc.Storage.URL != "" {
+		if err := uploadJob(tc, done); err != nil {
+			errs = append(errs, "upload: "+err.Error())
+			uploaded = false
+		}
+	}
+	// 本次有成功的备份并已上传后才清理，失败时不删除旧备份
+	if len(done) > 0 && uploaded && !tc.Retention.IsZero() {
+		pruned, err := pruneJob(tc, false)
+		res.Pruned = pruned
+		if err != nil {
+			errs = append(errs, "prune: "+err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		res.Err = errors.New(strings.Join(errs, "; "))
+	}
+	return res
+}
+
+// uploadJob 将本次成功的备份上传到目标的 storage，存放在以目标名命名的目录下
+func uploadJob(tc TargetConfig, backups []*manifest.Manifest) error {
+	s, err := storage.Open(tc.Storage)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	for _, m := range backups {
+		if err := uploadBackup(s, tc.OutputDir, tc.Name, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runJobs 并发备份配置中选中的目标并打印汇总，有目标失败时返回错误
+func runJobs(configPath string, names []string) error {
+	cfg, err := loadJobsConfig(configPath)
+	if err != nil {
+		return err
+	}
+	selected, err := cfg.selectTargets(names)
+	if err != nil {
+		return err
+	}
+
+	results := make([]*jobResult, len(selected))
+	tasks := make([]pool.Task, len(selected))
+	for i, tc := range selected {
+		i, tc := i, tc
+		tasks[i] = pool.Task{
+			Group: tc.hostKey(),
+			Run: func() error {
+				fmt.Printf("=== [%s] %s backup started (%s)\n", tc.Name, tc.Type, tc.hostKey())
+				res := runJob(tc)
+				finishJob(cfg, tc, res)
+				if res.Err != nil {
+					fmt.Printf("=== [%s] failed: %v\n", tc.Name, res.Err)
+				} else {
+					fmt.Printf("=== [%s] finished in %s\n", tc.Name, res.Duration.Round(time.Second))
+				}
+				results[i] = res
+				return res.Err
+			},
+		}
+	}
+	errs := pool.Run(context.Background(), tasks, pool.Options{
+		Workers:  cfg.Concurrency,
+		PerGroup: cfg.PerHostLimit,
+		FailFast: cfg.FailFast,
+	})
+	for i, err := range errs {
+		if results[i] == nil {
+			// 未启动的目标
+			results[i] = &jobResult{Name: selected[i].Name, Err: err}
+		}
+	}
+	return printJobSummary(results)
+}
+
+// printJobSummary 每个目标打印一行结果
+func printJobSummary(results []*jobResult) error {
+	failed := 0
+	fmt.Println("\nSummary:")
+	for _, res := range results {
+		status := "OK  "
+		detail := strings.Join(res.Backups, ", ")
+		switch {
+		case errors.Is(res.Err, pool.ErrCanceled):
+			status, detail = "SKIP", "not started: "+res.Err.Error()
+			failed++
+		case res.Err != nil:
+			status, detail = "FAIL", res.Err.Error()
+			failed++
+		}
+		fmt.Printf("%s  %-20s  %8s  %s\n", status, res.Name, res.Duration.Round(time.Second), detail)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d targets failed", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadTestJobs 把 config 写入临时文件并用 loadJobsConfig 读取
+func loadTestJobs(t *testing.T, config string) (*JobsConfig, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return loadJobsConfig(path)
+}
+
+func TestTargetsMySQLDatabases(t *testing.T) {
+	cfg, err := loadTestJobs(t, `{"targets": [
+		{"name": "app", "type": "mysql", "user": "root", "databases": ["app", "crm"]},
+		{"name": "all", "type": "mysql", "user": "root"}
+	]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := lookupDriver("mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 指定数据库时逐库备份，不使用 mysql-all 的默认值 true
+	targets, err := cfg.Targets[0].targets(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 2 {
+		t.Fatalf("%d target(s), want 2", len(targets))
+	}
+	for _, target := range targets {
+		if target.BoolOption("mysql-all") {
+			t.Errorf("database %s: mysql-all = true, want false", target.Database)
+		}
+		if err := d.Validate(target); err != nil {
+			t.Errorf("database %s: %v", target.Database, err)
+		}
+	}
+
+	targets, err = cfg.Targets[1].targets(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 1 || !targets[0].BoolOption("mysql-all") {
+		t.Errorf("target without databases: mysql-all = false, want the default true")
+	}
+
+	// 显式备份所有库与 databases 冲突
+	_, err = loadTestJobs(t, `{"targets": [
+		{"name": "app", "type": "mysql", "user": "root", "databases": ["app"], "options": {"mysql-all": true}}
+	]}`)
+	if err == nil || !strings.Contains(err.Error(), "mysql-all") {
+		t.Errorf("mysql-all with databases: err = %v, want a conflict", err)
+	}
+}
+
+func TestLoadJobsConfigOutputDir(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := loadTestJobs(t, `{"output_dir": "`+dir+`", "targets": [
+		{"name": "app", "type": "mysql", "user": "root"},
+		{"name": "crm", "type": "mysql", "user": "root", "output_dir": "`+dir+`/app2"}
+	]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Targets[0].OutputDir; got != filepath.Join(dir, "app") {
+		t.Errorf("default output_dir = %s, want %s", got, filepath.Join(dir, "app"))
+	}
+
+	// 两个目标写入同一目录时，按保留策略清理会删除对方的备份
+	_, err = loadTestJobs(t, `{"output_dir": "`+dir+`", "targets": [
+		{"name": "app", "type": "mysql", "user": "root"},
+		{"name": "crm", "type": "mysql", "user": "root", "output_dir": "`+dir+`/./app/"}
+	]}`)
+	if err == nil || !strings.Contains(err.Error(), "share output_dir") {
+		t.Errorf("shared output_dir: err = %v, want an error", err)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/LYcoding0/dbbackup/internal/metrics"
+)
+
+// recordJob 更新目标的指标，daemon 模式下同时更新 /metrics，写入失败只输出警告
+func recordJob(mc metrics.Config, tc TargetConfig, res *jobResult) {
+	run := metrics.Run{
+		Tool:     "dbbackup",
+		Job:      tc.Name,
+		Type:     tc.Type,
+		Success:  res.Err == nil,
+		Time:     time.Now(),
+		Duration: res.Duration,
+		Size:     res.Size,
+	}
+	if err := metrics.Update(daemonMetrics, mc.Textfile, run); err != nil {
+		fmt.Printf("Warning: [%s] update metrics failed: %v\n", tc.Name, err)
+	}
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/LYcoding0/dbbackup/internal/compress"
+	"github.com/LYcoding0/dbbackup/internal/crypt"
+)
+
+// MongoDBConfig MongoDB配置结构
+type MongoDBConfig struct {
+	Host         string
+	Port         string
+	Username     string
+	Password     string
+	Database     string
+	AuthDatabase string // 新增：认证数据库
+	Options      string
+	AllDatabases bool // 新增：是否备份所有数据库
+	OutputOptions
+}
+
+func init() {
+	RegisterDriver(&mongoDriver{})
+}
+
+// mongoDriver MongoDB引擎驱动
+type mongoDriver struct{}
+
+func (d *mongoDriver) Name() string        { return "mongodb" }
+func (d *mongoDriver) DefaultPort() string { return "27017" }
+
+func (d *mongoDriver) Options() []DriverOption {
+	return []DriverOption{
+		{Name: "mongo-options", Default: "", Usage: "Additional MongoDB options"},
+		{Name: "mongo-auth-db", Default: "", Usage: "MongoDB authentication database"},
+		{Name: "mongo-all", Default: "false", Usage: "MongoDB backup all databases", Bool: true},
+	}
+}
+
+func (d *mongoDriver) Validate(t *Target) error {
+	if !t.BoolOption("mongo-all") && t.Database == "" {
+		return errors.New("-db is required unless -mongo-all is set")
+	}
+	// mongodump只支持内置的gzip压缩
+	if t.Output.Compress == compress.Zstd {
+		return errors.New("mongodump only supports -compress gzip")
+	}
+	return nil
+}
+
+func (d *mongoDriver) Backup(t *Target, outputDir string) (*BackupResult, error) {
+	config := newMongoDBConfig(t)
+	path, err := backupMongoDB(config, outputDir)
+	result := &BackupResult{Path: path, Tool: "mongodump", BackupType: "full", Compress: config.Compress}
+	if !config.AllDatabases {
+		result.Databases = []string{config.Database}
+	}
+	return result, err
+}
+
+func (d *mongoDriver) Restore(t *Target, opts *RestoreOptions) error {
+	return restoreMongoDB(newMongoDBConfig(t), opts)
+}
+
+func (d *mongoDriver) ListDatabases(t *Target) ([]string, error) {
+	return mongoEval(newMongoDBConfig(t), "db.adminCommand({listDatabases: 1}).databases.forEach(function(d) { print(d.name) })")
+}
+
+func (d *mongoDriver) ServerVersion(t *Target) (string, error) {
+	rows, err := mongoEval(newMongoDBConfig(t), "print(db.version())")
+	if err != nil || len(rows) == 0 {
+		return "", err
+	}
+	return rows[0], nil
+}
+
+// mongoEval 使用mongo shell执行脚本，返回每行输出
+func mongoEval(config *MongoDBConfig, script string) ([]string, error) {
+	// 优先使用mongosh，兼容旧版mongo shell
+	shell, err := exec.LookPath("mongosh")
+	if err != nil {
+		if shell, err = exec.LookPath("mongo"); err != nil {
+			return nil, fmt.Errorf("mongosh command not found. Please install MongoDB shell: %v", err)
+		}
+	}
+
+	authDB := config.AuthDatabase
+	if authDB == "" {
+		authDB = "admin"
+	}
+	cmd := exec.Command(shell,
+		"--quiet",
+		"--host="+config.Host,
+		"--port="+config.Port,
+		"--username="+config.Username,
+		"--password="+config.Password,
+		"--authenticationDatabase="+authDB,
+		"--eval", script,
+	)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %v", shell, err)
+	}
+	return splitLines(out), nil
+}
+
+// newMongoDBConfig 根据通用连接参数生成MongoDB配置
+func newMongoDBConfig(t *Target) *MongoDBConfig {
+	return &MongoDBConfig{
+		Host:          t.Host,
+		Port:          t.Port,
+		Username:      t.Username,
+		Password:      t.Password,
+		Database:      t.Database,
+		AuthDatabase:  t.Option("mongo-auth-db"),
+		Options:       t.Option("mongo-options"),
+		AllDatabases:  t.BoolOption("mongo-all"),
+		OutputOptions: t.Output,
+	}
+}
+
+// backupMongoDB 备份MongoDB数据库
+func backupMongoDB(config *MongoDBConfig, outputDir string) (string, error) {
+	if config.AllDatabases {
+		return backupMongoDBAll(config, outputDir)
+	} else {
+		return backupMongoDBSingle(config, outputDir)
+	}
+}
+
+// backupMongoDBAll 备份所有MongoDB数据库
+func backupMongoDBAll(config *MongoDBConfig, outputDir string) (string, error) {
+	fmt.Println("Starting MongoDB backup of all databases...")
+
+	// 检查mongodump命令是否存在
+	_, err := exec.LookPath("mongodump")
+	if err != nil {
+		return "", fmt.Errorf("mongodump command not found. Please install MongoDB client tools: %v", err)
+	}
+
+	// 构建mongodump命令（不指定--db参数以备份所有数据库）
+	filename, outArg := mongoDumpTarget(config, fmt.Sprintf("%s/mongodb_all_%s", outputDir, time.Now().Format("20060102_150405")))
+	cmdArgs := []string{
+		"--host=" + config.Host + ":" + config.Port,
+		"--username=" + config.Username,
+		"--password=" + config.Password,
+		outArg,
+	}
+
+	// 添加认证数据库参数（如果没有指定则默认使用admin）
+	authDB := config.AuthDatabase
+	if authDB == "" {
+		authDB = "admin"
+	}
+	cmdArgs = append(cmdArgs, "--authenticationDatabase="+authDB)
+
+	// 使用mongodump内置的gzip压缩
+	if config.Compress == compress.Gzip {
+		cmdArgs = append(cmdArgs, "--gzip")
+	}
+
+	// 添加额外选项
+	if config.Options != "" {
+		cmdArgs = append(cmdArgs, strings.Split(config.Options, " ")...)
+	}
+
+	cmd := exec.Command("mongodump", cmdArgs...)
+	cmd.Stderr = os.Stderr
+
+	// 创建不包含密码的日志参数用于显示
+	logArgs := make([]string, len(cmdArgs))
+	copy(logArgs, cmdArgs)
+	for i, arg := range logArgs {
+		if strings.HasPrefix(arg, "--password=") {
+			logArgs[i] = "--password=***"
+		}
+	}
+
+	fmt.Printf("Executing: mongodump with args %v\n", logArgs)
+	err = runMongodump(cmd, filename, config)
+	if err != nil {
+		return filename, fmt.Errorf("mongodump failed: %v", err)
+	}
+
+	fmt.Printf("MongoDB backup of all databases completed successfully: %s\n", filename)
+	return filename, nil
+}
+
+// backupMongoDBSingle 备份单个MongoDB数据库
+func backupMongoDBSingle(config *MongoDBConfig, outputDir string) (string, error) {
+	fmt.Printf("Starting MongoDB backup of database '%s'...\n", config.Database)
+
+	// 检查mongodump命令是否存在
+	_, err := exec.LookPath("mongodump")
+	if err != nil {
+		return "", fmt.Errorf("mongodump command not found. Please install MongoDB client tools: %v", err)
+	}
+
+	// 构建mongodump命令
+	filename, outArg := mongoDumpTarget(config, fmt.Sprintf("%s/mongodb_%s_%s", outputDir, config.Database, time.Now().Format("20060102_150405")))
+	cmdArgs := []string{
+		"--host=" + config.Host + ":" + config.Port,
+		"--username=" + config.Username,
+		"--password=" + config.Password,
+		"--db=" + config.Database,
+		outArg,
+	}
+
+	// 添加认证数据库参数（如果没有指定则默认使用admin）
+	authDB := config.AuthDatabase
+	if authDB == "" {
+		authDB = "admin"
+	}
+	cmdArgs = append(cmdArgs, "--authenticationDatabase="+authDB)
+
+	// 使用mongodump内置的gzip压缩
+	if config.Compress == compress.Gzip {
+		cmdArgs = append(cmdArgs, "--gzip")
+	}
+
+	// 添加额外选项
+	if config.Options != "" {
+		cmdArgs = append(cmdArgs, strings.Split(config.Options, " ")...)
+	}
+
+	cmd := exec.Command("mongodump", cmdArgs...)
+	cmd.Stderr = os.Stderr
+
+	// 创建不包含密码的日志参数用于显示
+	logArgs := make([]string, len(cmdArgs))
+	copy(logArgs, cmdArgs)
+	for i, arg := range logArgs {
+		if strings.HasPrefix(arg, "--password=") {
+			logArgs[i] = "--password=***"
+		}
+	}
+
+	fmt.Printf("Executing: mongodump with args %v\n", logArgs)
+	err = runMongodump(cmd, filename, config)
+	if err != nil {
+		return filename, fmt.Errorf("mongodump failed: %v", err)
+	}
+
+	fmt.Printf("MongoDB backup of database '%s' completed successfully: %s\n", config.Database, filename)
+	return filename, nil
+}
+
+// mongoDumpTarget 返回备份路径及对应的mongodump输出参数，加密时使用--archive输出到stdout
+func mongoDumpTarget(config *MongoDBConfig, base string) (string, string) {
+	if config.EncryptKey == nil {
+		return base, "--out=" + base
+	}
+	filename := base + ".archive"
+	if config.Compress == compress.Gzip {
+		filename += ".gz"
+	}
+	return filename + crypt.Ext, "--archive"
+}
+
+// runMongodump 执行mongodump，使用--archive时由本工具加密后写入filename
+func runMongodump(cmd *exec.Cmd, filename string, config *MongoDBConfig) error {
+	if config.EncryptKey == nil {
+		cmd.Stdout = os.Stdout
+		return cmd.Run()
+	}
+	return runDumpToFile(cmd, filename, OutputOptions{EncryptKey: config.EncryptKey})
+}
+
+// restoreMongoDB 使用mongorestore恢复mongodump生成的备份目录
+func restoreMongoDB(config *MongoDBConfig, opts *RestoreOptions) error {
+	// 检查mongorestore命令是否存在
+	if _, err := exec.LookPath("mongorestore"); err != nil {
+		return fmt.Errorf("mongorestore command not found. Please install MongoDB client tools: %v", err)
+	}
+
+	info, err := os.Stat(opts.InputPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat backup: %v", err)
+	}
+	archive := !info.IsDir()
+
+	databases, err := mongoDumpDatabases(opts.InputPath, archive)
+	if err != nil {
+		return err
+	}
+
+	cmdArgs := []string{
+		"--host=" + config.Host + ":" + config.Port,
+		"--username=" + config.Username,
+		"--password=" + config.Password,
+		"--drop",
+	}
+
+	// 添加认证数据库参数（如果没有指定则默认使用admin）
+	authDB := config.AuthDatabase
+	if authDB == "" {
+		authDB = "admin"
+	}
+	cmdArgs = append(cmdArgs, "--authenticationDatabase="+authDB)
+
+	// 备份使用了--gzip时恢复也需要指定
+	if mongoDumpGzipped(opts.InputPath, archive) {
+		cmdArgs = append(cmdArgs, "--gzip")
+	}
+
+	summary := fmt.Sprintf("Restoring %s into MongoDB %s:%s (all databases in the backup)", opts.InputPath, config.Host, config.Port)
+	if len(databases) > 0 {
+		summary = fmt.Sprintf("Restoring %s into MongoDB %s:%s databases %v", opts.InputPath, config.Host, config.Port, databases)
+	}
+	if opts.TargetDB != "" {
+		if len(databases) != 1 {
+			return fmt.Errorf("-target-db requires a single-database backup, found %v", databases)
+		}
+		cmdArgs = append(cmdArgs,
+			"--nsInclude="+databases[0]+".*",
+			"--nsFrom="+databases[0]+".*",
+			"--nsTo="+opts.TargetDB+".*",
+		)
+		summary = fmt.Sprintf("Restoring %s into MongoDB %s:%s database '%s'", opts.InputPath, config.Host, config.Port, opts.TargetDB)
+	}
+
+	// 添加额外选项
+	if config.Options != "" {
+		cmdArgs = append(cmdArgs, strings.Split(config.Options, " ")...)
+	}
+
+	if err := confirmRestore(summary, opts.AssumeYes); err != nil {
+		return err
+	}
+
+	cmd := exec.Command("mongorestore")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// 加密的归档解密后通过stdin交给mongorestore
+	if archive {
+		input, err := openEncrypted(opts.InputPath, opts.DecryptKey)
+		if err != nil {
+			return err
+		}
+		defer input.Close()
+		cmd.Stdin = input
+		cmdArgs = append(cmdArgs, "--archive")
+	} else {
+		cmdArgs = append(cmdArgs, opts.InputPath)
+	}
+	cmd.Args = append(cmd.Args, cmdArgs...)
+
+	fmt.Printf("Executing: mongorestore with args %v\n", maskPasswordArgs(cmdArgs))
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("mongorestore failed: %v", err)
+	}
+
+	fmt.Printf("MongoDB restore completed successfully: %s\n", opts.InputPath)
+	return nil
+}
+
+// mongoDumpDatabases 返回备份中的数据库，无法确定（备份所有数据库的归档）时返回空
+func mongoDumpDatabases(path string, archive bool) ([]string, error) {
+	if archive {
+		// 归档文件名形如 mongodb_<db>_<timestamp>.archive[.gz].enc
+		name, _, _ := strings.Cut(filepath.Base(path), ".archive")
+		if strings.HasPrefix(name, "mongodb_all_") || !strings.HasPrefix(name, "mongodb_") {
+			return nil, nil
+		}
+		return []string{backupTimestampPattern.ReplaceAllString(strings.TrimPrefix(name, "mongodb_"), "")}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %v", err)
+	}
+	var databases []string
+	for _, e := range entries {
+		if e.IsDir() {
+			databases = append(databases, e.Name())
+		}
+	}
+	if len(databases) == 0 {
+		return nil, fmt.Errorf("no database found in %s", path)
+	}
+	return databases, nil
+}
+
+// mongoDumpGzipped 检查mongodump备份是否使用了--gzip
+func mongoDumpGzipped(path string, archive bool) bool {
+	if archive {
+		return strings.Contains(filepath.Base(path), ".archive.gz")
+	}
+	matches, _ := filepath.Glob(filepath.Join(path, "*", "*.gz"))
+	return len(matches) > 0
+}
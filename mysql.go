@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/LYcoding0/dbbackup/internal/compress"
+	"github.com/LYcoding0/dbbackup/internal/crypt"
+)
+
+// MySQLConfig MySQL配置结构
+type MySQLConfig struct {
+	Host         string
+	Port         string
+	Username     string
+	Password     string
+	Database     string
+	AllDatabases bool   // 是否备份所有数据库
+	BackupTool   string // "mysqldump" 或 "xtrabackup"
+	Datadir      string // 数据目录（使用xtrabackup时必需）
+	OutputOptions
+}
+
+func init() {
+	RegisterDriver(&mysqlDriver{})
+}
+
+// mysqlDriver MySQL引擎驱动
+type mysqlDriver struct{}
+
+func (d *mysqlDriver) Name() string        { return "mysql" }
+func (d *mysqlDriver) DefaultPort() string { return "3306" }
+
+func (d *mysqlDriver) Options() []DriverOption {
+	return []DriverOption{
+		{Name: "mysql-tool", Default: "mysqldump", Usage: "MySQL backup tool: mysqldump or xtrabackup"},
+		{Name: "mysql-datadir", Default: "/var/lib/mysql", Usage: "MySQL data directory (required for xtrabackup)"},
+		{Name: "mysql-all", Default: "true", Usage: "MySQL backup all databases (default true)", Bool: true},
+	}
+}
+
+func (d *mysqlDriver) Validate(t *Target) error {
+	switch t.Option("mysql-tool") {
+	case "mysqldump":
+		if !t.BoolOption("mysql-all") && t.Database == "" {
+			return errors.New("-db is required when -mysql-all=false")
+		}
+	case "xtrabackup":
+		if t.Option("mysql-datadir") == "" {
+			return errors.New("-mysql-datadir is required for xtrabackup")
+		}
+		if t.Output.Compress != "" && t.Output.Compress != compress.None {
+			return errors.New("-compress is not supported with xtrabackup, use mysql_xtrabackup with xtrabackup.compress instead")
+		}
+		if t.Output.EncryptKey != nil {
+			return errors.New("-key-file is not supported with xtrabackup, use mysql_xtrabackup with encryption instead")
+		}
+	default:
+		return fmt.Errorf("unsupported MySQL backup tool '%s'", t.Option("mysql-tool"))
+	}
+	return nil
+}
+
+func (d *mysqlDriver) Backup(t *Target, outputDir string) (*BackupResult, error) {
+	config := newMySQLConfig(t)
+	path, err := backupMySQL(config, outputDir)
+	result := &BackupResult{Path: path, Tool: config.BackupTool, BackupType: "full", Compress: config.Compress}
+	if config.BackupTool == "mysqldump" && !config.AllDatabases {
+		result.Databases = []string{config.Database}
+	}
+	return result, err
+}
+
+func (d *mysqlDriver) Restore(t *Target, opts *RestoreOptions) error {
+	return restoreMySQL(newMySQLConfig(t), opts)
+}
+
+func (d *mysqlDriver) ListDatabases(t *Target) ([]string, error) {
+	return mysqlQuery(newMySQLConfig(t), "SHOW DATABASES")
+}
+
+func (d *mysqlDriver) ServerVersion(t *Target) (string, error) {
+	rows, err := mysqlQuery(newMySQLConfig(t), "SELECT VERSION()")
+	if err != nil || len(rows) == 0 {
+		return "", err
+	}
+	return rows[0], nil
+}
+
+// mysqlQuery 使用mysql客户端执行查询，返回每行输出
+func mysqlQuery(config *MySQLConfig, query string) ([]string, error) {
+	// 检查mysql命令是否存在
+	if _, err := exec.LookPath("mysql"); err != nil {
+		return nil, fmt.Errorf("mysql command not found. Please install MySQL client tools: %v", err)
+	}
+
+	cmd := exec.Command("mysql",
+		"--host="+config.Host,
+		"--port="+config.Port,
+		"--user="+config.Username,
+		"--password="+config.Password,
+		"-N", "-B", "-e", query,
+	)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("mysql failed: %v", err)
+	}
+	return splitLines(out), nil
+}
+
+// newMySQLConfig 根据通用连接参数生成MySQL配置
+func newMySQLConfig(t *Target) *MySQLConfig {
+	return &MySQLConfig{
+		Host:          t.Host,
+		Port:          t.Port,
+		Username:      t.Username,
+		Password:      t.Password,
+		Database:      t.Database,
+		AllDatabases:  t.BoolOption("mysql-all"),
+		BackupTool:    t.Option("mysql-tool"),
+		Datadir:       t.Option("mysql-datadir"),
+		OutputOptions: t.Output,
+	}
+}
+
+// backupMySQL 备份MySQL数据库，支持mysqldump和xtrabackup
+func backupMySQL(config *MySQLConfig, outputDir string) (string, error) {
+	fmt.Printf("Starting MySQL backup using %s...\n", config.BackupTool)
+
+	switch config.BackupTool {
+	case "xtrabackup":
+		return backupMySQLWithXtraBackup(config, outputDir)
+	case "mysqldump":
+		return backupMySQLWithMysqldump(config, outputDir)
+	default:
+		// 默认使用mysqldump方式
+		return backupMySQLWithMysqldump(config, outputDir)
+	}
+}
+
+// backupMySQLWithXtraBackup 使用XtraBackup备份MySQL
+func backupMySQLWithXtraBackup(config *MySQLConfig, outputDir string) (string, error) {
+	fmt.Println("Starting MySQL backup with XtraBackup...")
+
+	// 检查xtrabackup命令是否存在
+	_, err := exec.LookPath("xtrabackup")
+	if err != nil {
+		return "", fmt.Errorf("xtrabackup command not found. Please install Percona XtraBackup: %v", err)
+	}
+
+	// 创建备份目录
+	backupDir := fmt.Sprintf("%s/xtrabackup_%s", outputDir, time.Now().Format("20060102_150405"))
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return backupDir, fmt.Errorf("failed to create backup directory: %v", err)
+	}
+
+	// 构建xtrabackup命令
+	cmdArgs := []string{
+		"--backup",
+		"--datadir=" + config.Datadir,
+		"--target-dir=" + backupDir,
+		"--host=" + config.Host,
+		"--port=" + config.Port,
+		"--user=" + config.Username,
+		"--password=" + config.Password,
+	}
+
+	cmd := exec.Command("xtrabackup", cmdArgs...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// 创建不包含密码的日志参数用于显示
+	logArgs := make([]string, len(cmdArgs))
+	copy(logArgs, cmdArgs)
+	for i, arg := range logArgs {
+		if strings.HasPrefix(arg, "--password=") {
+			logArgs[i] = "--password=***"
+		}
+	}
+
+	fmt.Printf("Executing: xtrabackup with args %v\n", logArgs)
+	err = cmd.Run()
+	if err != nil {
+		return backupDir, fmt.Errorf("xtrabackup failed: %v", err)
+	}
+
+	fmt.Printf("MySQL backup with XtraBackup completed successfully: %s\n", backupDir)
+	return backupDir, nil
+}
+
+// backupMySQLWithMysqldump 使用mysqldump备份MySQL
+func backupMySQLWithMysqldump(config *MySQLConfig, outputDir string) (string, error) {
+	fmt.Println("Starting MySQL backup with mysqldump...")
+
+	// 检查mysqldump命令是否存在
+	_, err := exec.LookPath("mysqldump")
+	if err != nil {
+		return "", fmt.Errorf("mysqldump command not found. Please install MySQL client tools: %v", err)
+	}
+
+	// 构建mysqldump命令
+	// 文件名带上库名，同一目标的多个库在同一秒备份时不会互相覆盖
+	filename := fmt.Sprintf("%s/mysql_%s_%s%s", outputDir, config.Database, time.Now().Format("20060102_150405"), config.dumpExt())
+	if config.AllDatabases {
+		filename = fmt.Sprintf("%s/mysql_all_%s%s", outputDir, time.Now().Format("20060102_150405"), config.dumpExt())
+	}
+	cmdArgs := []string{
+		"--host=" + config.Host,
+		"--port=" + config.Port,
+		"--user=" + config.Username,
+		"--password=" + config.Password,
+		"--single-transaction",
+		"--routines",
+		"--triggers",
+		"--no-tablespaces", // 添加此参数以避免需要PROCESS权限
+	}
+
+	// 根据是否备份所有数据库添加相应参数
+	if config.AllDatabases {
+		cmdArgs = append(cmdArgs, "--all-databases") // 备份所有数据库
+	} else {
+		cmdArgs = append(cmdArgs, config.Database) // 备份指定数据库
+	}
+
+	cmd := exec.Command("mysqldump", cmdArgs...)
+	cmd.Stderr = os.Stderr
+
+	// 创建不包含密码的日志参数用于显示
+	logArgs := make([]string, len(cmdArgs))
+	copy(logArgs, cmdArgs)
+	for i, arg := range logArgs {
+		if strings.HasPrefix(arg, "--password=") {
+			logArgs[i] = "--password=***"
+		}
+	}
+
+	fmt.Printf("Executing: mysqldump with args %v\n", logArgs)
+	err = runDumpToFile(cmd, filename, config.OutputOptions)
+	if err != nil {
+		return filename, fmt.Errorf("mysqldump failed: %v", err)
+	}
+
+	fmt.Printf("MySQL backup with mysqldump completed successfully: %s\n", filename)
+	return filename, nil
+}
+
+// quoteMySQLIdent 转义MySQL标识符
+func quoteMySQLIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// mysqlDumpDatabase 从mysqldump文件头读取源数据库名，备份所有数据库时返回空
+func mysqlDumpDatabase(path string, key *crypt.Key) (string, error) {
+	file, err := openDump(path, key)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for i := 0; i < 20 && scanner.Scan(); i++ {
+		line := scanner.Text()
+		// 形如 "-- Host: localhost    Database: mydb"
+		if strings.HasPrefix(line, "-- Host:") {
+			if idx := strings.Index(line, "Database:"); idx >= 0 {
+				return strings.TrimSpace(line[idx+len("Database:"):]), nil
+			}
+			return "", nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+// restoreMySQL 使用mysql客户端恢复mysqldump生成的备份文件
+func restoreMySQL(config *MySQLConfig, opts *RestoreOptions) error {
+	info, err := os.Stat(opts.InputPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat backup: %v", err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory; XtraBackup backups must be restored with mysql_xtrabackup -mode restore", opts.InputPath)
+	}
+
+	// 检查mysql命令是否存在
+	if _, err := exec.LookPath("mysql"); err != nil {
+		return fmt.Errorf("mysql command not found. Please install MySQL client tools: %v", err)
+	}
+
+	sourceDB, err := mysqlDumpDatabase(opts.InputPath, opts.DecryptKey)
+	if err != nil {
+		return err
+	}
+	targetDB := sourceDB
+	if opts.TargetDB != "" {
+		if sourceDB == "" {
+			return errors.New("-target-db cannot be used with a backup of all databases")
+		}
+		targetDB = opts.TargetDB
+	}
+
+	summary := fmt.Sprintf("Restoring %s into MySQL %s:%s (all databases in the backup)", opts.InputPath, config.Host, config.Port)
+	if targetDB != "" {
+		summary = fmt.Sprintf("Restoring %s into MySQL %s:%s database '%s'", opts.InputPath, config.Host, config.Port, targetDB)
+	}
+	if err := confirmRestore(summary, opts.AssumeYes); err != nil {
+		return err
+	}
+
+	connArgs := []string{
+		"--host=" + config.Host,
+		"--port=" + config.Port,
+		"--user=" + config.Username,
+		"--password=" + config.Password,
+	}
+
+	// 单库备份不包含CREATE DATABASE语句，需要先创建目标库
+	if targetDB != "" {
+		createArgs := append(append([]string{}, connArgs...), "-e", "CREATE DATABASE IF NOT EXISTS "+quoteMySQLIdent(targetDB))
+		cmd := exec.Command("mysql", createArgs...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to create database '%s': %v", targetDB, err)
+		}
+	}
+
+	cmdArgs := append([]string{}, connArgs...)
+	if targetDB != "" {
+		cmdArgs = append(cmdArgs, targetDB)
+	}
+
+	inputFile, err := openDump(opts.InputPath, opts.DecryptKey)
+	if err != nil {
+		return err
+	}
+	defer inputFile.Close()
+
+	cmd := exec.Command("mysql", cmdArgs...)
+	cmd.Stdin = inputFile
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	fmt.Printf("Executing: mysql with args %v < %s\n", maskPasswordArgs(cmdArgs), opts.InputPath)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("mysql restore failed: %v", err)
+	}
+
+	fmt.Printf("MySQL restore completed successfully: %s\n", opts.InputPath)
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/LYcoding0/dbbackup/internal/notify"
+)
+
+// notifyStateFile 目标输出目录中记录上一次备份结果的文件，用于判断是否恢复
+const notifyStateFile = ".notify_state.json"
+
+// notifyJob 将目标的备份结果发送到其 notify 通道，发送失败只输出警告
+func notifyJob(tc TargetConfig, res *jobResult) {
+	if len(tc.Notify) == 0 {
+		return
+	}
+	e := &notify.Event{
+		Tool:     "dbbackup",
+		Job:      tc.Name,
+		Host:     tc.hostKey(),
+		Type:     tc.Type,
+		Status:   notify.StatusSuccess,
+		Backups:  res.Backups,
+		Size:     res.Size,
+		Pruned:   res.Pruned,
+		Location: tc.OutputDir,
+		Duration: res.Duration,
+		Time:     time.Now(),
+
+		Manifests: res.Manifests,
+	}
+	if tc.Storage.URL != "" {
+		e.Location = tc.Storage.URL + "/" + tc.Name
+	}
+	if res.Err != nil {
+		e.Status, e.Error = notify.StatusFailure, res.Err.Error()
+	}
+	statePath := ""
+	if err := os.MkdirAll(tc.OutputDir, 0755); err == nil {
+		statePath = filepath.Join(tc.OutputDir, notifyStateFile)
+	}
+	if err := notify.Send(tc.Notify, e, statePath); err != nil {
+		fmt.Printf("Warning: [%s] notify failed: %v\n", tc.Name, err)
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// PostgresConfig PostgreSQL配置结构
+type PostgresConfig struct {
+	Host         string
+	Port         string
+	Username     string
+	Password     string
+	Database     string
+	AllDatabases bool // 是否备份所有数据库
+	OutputOptions
+}
+
+func init() {
+	RegisterDriver(&postgresDriver{})
+}
+
+// postgresDriver PostgreSQL引擎驱动
+type postgresDriver struct{}
+
+func (d *postgresDriver) Name() string        { return "postgresql" }
+func (d *postgresDriver) DefaultPort() string { return "5432" }
+
+func (d *postgresDriver) Options() []DriverOption {
+	return []DriverOption{
+		{Name: "postgres-all", Default: "false", Usage: "PostgreSQL backup all databases (pg_dumpall)", Bool: true},
+	}
+}
+
+func (d *postgresDriver) Validate(t *Target) error {
+	if !t.BoolOption("postgres-all") && t.Database == "" {
+		return errors.New("-db is required unless -postgres-all is set")
+	}
+	return nil
+}
+
+func (d *postgresDriver) Backup(t *Target, outputDir string) (*BackupResult, error) {
+	config := newPostgresConfig(t)
+	path, err := backupPostgreSQL(config, outputDir)
+	result := &BackupResult{Path: path, Tool: "pg_dumpall", BackupType: "full", Compress: config.Compress}
+	if !config.AllDatabases {
+		result.Tool = "pg_dump"
+		result.Databases = []string{config.Database}
+	}
+	return result, err
+}
+
+func (d *postgresDriver) Restore(t *Target, opts *RestoreOptions) error {
+	return restorePostgreSQL(newPostgresConfig(t), opts)
+}
+
+func (d *postgresDriver) ListDatabases(t *Target) ([]string, error) {
+	return psqlQuery(newPostgresConfig(t), "SELECT datname FROM pg_database WHERE NOT datistemplate ORDER BY datname")
+}
+
+func (d *postgresDriver) ServerVersion(t *Target) (string, error) {
+	rows, err := psqlQuery(newPostgresConfig(t), "SHOW server_version")
+	if err != nil || len(rows) == 0 {
+		return "", err
+	}
+	return rows[0], nil
+}
+
+// psqlQuery 连接postgres库执行查询，返回每行输出
+func psqlQuery(config *PostgresConfig, query string) ([]string, error) {
+	// 检查psql命令是否存在
+	if _, err := exec.LookPath("psql"); err != nil {
+		return nil, fmt.Errorf("psql command not found. Please install PostgreSQL client tools: %v", err)
+	}
+
+	cmd := exec.Command("psql", "-d", "postgres", "-tAc", query)
+	cmd.Env = postgresEnv(config)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("psql failed: %v", err)
+	}
+	return splitLines(out), nil
+}
+
+// newPostgresConfig 根据通用连接参数生成PostgreSQL配置
+func newPostgresConfig(t *Target) *PostgresConfig {
+	return &PostgresConfig{
+		Host:          t.Host,
+		Port:          t.Port,
+		Username:      t.Username,
+		Password:      t.Password,
+		Database:      t.Database,
+		AllDatabases:  t.BoolOption("postgres-all"),
+		OutputOptions: t.Output,
+	}
+}
+
+// postgresEnv 生成连接PostgreSQL所需的环境变量
+func postgresEnv(config *PostgresConfig) []string {
+	env := os.Environ()
+	env = append(env, fmt.Sprintf("PGHOST=%s", config.Host))
+	env = append(env, fmt.Sprintf("PGPORT=%s", config.Port))
+	env = append(env, fmt.Sprintf("PGUSER=%s", config.Username))
+	env = append(env, fmt.Sprintf("PGPASSWORD=%s", config.Password))
+	return env
+}
+
+// backupPostgreSQL 备份PostgreSQL数据库
+func backupPostgreSQL(config *PostgresConfig, outputDir string) (string, error) {
+	if config.AllDatabases {
+		return backupPostgreSQLAll(config, outputDir)
+	} else {
+		return backupPostgreSQLSingle(config, outputDir)
+	}
+}
+
+// backupPostgreSQLAll 使用pg_dumpall备份所有PostgreSQL数据库
+func backupPostgreSQLAll(config *PostgresConfig, outputDir string) (string, error) {
+	fmt.Println("Starting PostgreSQL backup of all databases...")
+
+	// 检查pg_dumpall命令是否存在
+	_, err := exec.LookPath("pg_dumpall")
+	if err != nil {
+		return "", fmt.Errorf("pg_dumpall command not found. Please install PostgreSQL client tools: %v", err)
+	}
+
+	// 设置环境变量
+	env := postgresEnv(config)
+
+	// 构建pg_dumpall命令
+	filename := fmt.Sprintf("%s/postgresql_all_%s%s", outputDir, time.Now().Format("20060102_150405"), config.dumpExt())
+	cmdArgs := []string{
+		"--verbose",
+		"--clean",
+		"--if-exists",
+		"--no-owner",
+		"--no-acl",
+	}
+
+	cmd := exec.Command("pg_dumpall", cmdArgs...)
+	cmd.Env = env
+
+	cmd.Stderr = os.Stderr
+
+	// 创建不包含密码的日志参数用于显示
+	logEnv := make([]string, len(env))
+	copy(logEnv, env)
+	for i, envVar := range logEnv {
+		if strings.HasPrefix(envVar, "PGPASSWORD=") {
+			logEnv[i] = "PGPASSWORD=***"
+		}
+	}
+
+	fmt.Printf("Executing: pg_dumpall with args %v and env %v\n", cmdArgs, logEnv)
+	err = runDumpToFile(cmd, filename, config.OutputOptions)
+	if err != nil {
+		return filename, fmt.Errorf("pg_dumpall failed: %v", err)
+	}
+
+	fmt.Printf("PostgreSQL backup of all databases completed successfully: %s\n", filename)
+	return filename, nil
+}
+
+// backupPostgreSQLSingle 使用pg_dump备份单个PostgreSQL数据库
+func backupPostgreSQLSingle(config *PostgresConfig, outputDir string) (string, error) {
+	fmt.Printf("Starting PostgreSQL backup of database '%s'...\n", config.Database)
+
+	// 检查pg_dump命令是否存在
+	_, err := exec.LookPath("pg_dump")
+	if err != nil {
+		return "", fmt.Errorf("pg_dump command not found. Please install PostgreSQL client tools: %v", err)
+	}
+
+	// 设置环境变量
+	env := postgresEnv(config)
+
+	// 构建pg_dump命令
+	filename := fmt.Sprintf("%s/postgresql_%s_%s%s", outputDir, config.Database, time.Now().Format("20060102_150405"), config.dumpExt())
+	cmdArgs := []string{
+		"--verbose",
+		"--clean",
+		"--if-exists",
+		"--no-owner",
+		"--no-acl",
+		config.Database,
+	}
+
+	cmd := exec.Command("pg_dump", cmdArgs...)
+	cmd.Env = env
+
+	cmd.Stderr = os.Stderr
+
+	// 创建不包含密码的日志参数用于显示
+	logEnv := make([]string, len(env))
+	copy(logEnv, env)
+	for i, envVar := range logEnv {
+		if strings.HasPrefix(envVar, "PGPASSWORD=") {
+			logEnv[i] = "PGPASSWORD=***"
+		}
+	}
+
+	fmt.Printf("Executing: pg_dump with args %v and env %v\n", cmdArgs, logEnv)
+	err = runDumpToFile(cmd, filename, config.OutputOptions)
+	if err != nil {
+		return filename, fmt.Errorf("pg_dump failed: %v", err)
+	}
+
+	fmt.Printf("PostgreSQL backup of database '%s' completed successfully: %s\n", config.Database, filename)
+	return filename, nil
+}
+
+// quotePostgresIdent 转义PostgreSQL标识符
+func quotePostgresIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// restorePostgreSQL 使用psql恢复pg_dump或pg_dumpall生成的备份文件
+func restorePostgreSQL(config *PostgresConfig, opts *RestoreOptions) error {
+	// 检查psql命令是否存在
+	if _, err := exec.LookPath("psql"); err != nil {
+		return fmt.Errorf("psql command not found. Please install PostgreSQL client tools: %v", err)
+	}
+	inputFile, err := openDump(opts.InputPath, opts.DecryptKey)
+	if err != nil {
+		return err
+	}
+	defer inputFile.Close()
+
+	// 设置环境变量
+	env := postgresEnv(config)
+
+	base := filepath.Base(opts.InputPath)
+
+	// pg_dumpall的备份自带建库语句，连接到postgres库执行即可
+	if strings.HasPrefix(base, "postgresql_all_") {
+		if opts.TargetDB != "" {
+			return errors.New("-target-db cannot be used with a pg_dumpall backup")
+		}
+		summary := fmt.Sprintf("Restoring %s into PostgreSQL %s:%s (all databases in the backup)", opts.InputPath, config.Host, config.Port)
+		if err := confirmRestore(summary, opts.AssumeYes); err != nil {
+			return err
+		}
+		return runPsql(env, inputFile, "postgres")
+	}
+
+	// 单库备份文件名形如 postgresql_<db>_<timestamp>.sql
+	targetDB := opts.TargetDB
+	if targetDB == "" {
+		if name := strings.TrimPrefix(base, "postgresql_"); name != base && backupTimestampPattern.MatchString(name) {
+			targetDB = backupTimestampPattern.ReplaceAllString(name, "")
+		}
+	}
+	if targetDB == "" {
+		targetDB = config.Database
+	}
+	if targetDB == "" {
+		return fmt.Errorf("cannot determine target database from %s, use -target-db", base)
+	}
+
+	summary := fmt.Sprintf("Restoring %s into PostgreSQL %s:%s database '%s'", opts.InputPath, config.Host, config.Port, targetDB)
+	if err := confirmRestore(summary, opts.AssumeYes); err != nil {
+		return err
+	}
+
+	// pg_dump的备份不包含建库语句，目标库不存在时先创建
+	check := exec.Command("psql", "-d", "postgres", "-tAc", "SELECT 1 FROM pg_database WHERE datname = '"+strings.ReplaceAll(targetDB, "'", "''")+"'")
+	check.Env = env
+	check.Stderr = os.Stderr
+	out, err := check.Output()
+	if err != nil {
+		return fmt.Errorf("failed to check database '%s': %v", targetDB, err)
+	}
+	if strings.TrimSpace(string(out)) != "1" {
+		if err := runPsql(env, nil, "postgres", "-c", "CREATE DATABASE "+quotePostgresIdent(targetDB)); err != nil {
+			return err
+		}
+	}
+
+	return runPsql(env, inputFile, targetDB)
+}
+
+// runPsql 在指定数据库上执行psql，stdin不为空时从中读取SQL。遇到SQL错误时立即停止并返回错误，
+// 否则psql会继续执行并以0退出
+func runPsql(env []string, stdin io.Reader, database string, args ...string) error {
+	cmdArgs := append([]string{"-v", "ON_ERROR_STOP=1", "-d", database}, args...)
+	cmd := exec.Command("psql", cmdArgs...)
+	cmd.Env = env
+	cmd.Stdin = stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	fmt.Printf("Executing: psql with args %v\n", cmdArgs)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("psql failed: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/LYcoding0/dbbackup/internal/manifest"
+	"github.com/LYcoding0/dbbackup/internal/retention"
+	"github.com/LYcoding0/dbbackup/internal/storage"
+)
+
+// backupTimeLayout 备份名末尾的时间，例如 postgresql_app_20240101_020000
+const backupTimeLayout = "20060102_150405"
+
+// prunable 一份参与保留计算的备份及其所有文件
+type prunable struct {
+	retention.Backup
+	Paths    []string // 本地路径或存储中的键，有清单时清单在最前
+	Manifest string   // 清单状态，没有清单时为空
+	HasData  bool     // 有备份文件或目录
+}
+
+// parseBackupTime 由备份名得到系列（去掉时间的部分，例如 postgresql_app）和备份时间
+func parseBackupTime(name string) (string, time.Time, bool) {
+	if len(name) <= len(backupTimeLayout)+1 || name[len(name)-len(backupTimeLayout)-1] != '_' {
+		return "", time.Time{}, false
+	}
+	t, err := time.ParseInLocation(backupTimeLayout, name[len(name)-len(backupTimeLayout):], time.Local)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return name[:len(name)-len(backupTimeLayout)-1], t, true
+}
+
+// collect 按备份名归类文件，base 为文件名（或存储中目标目录下的第一段），p 为要删除的路径
+func collect(byName map[string]*prunable, list *[]*prunable, base, p string) *prunable {
+	name := backupName(strings.TrimSuffix(base, manifest.Suffix))
+	series, t, ok := parseBackupTime(name)
+	if !ok {
+		return nil
+	}
+	b := byName[name]
+	if b == nil {
+		b = &prunable{Backup: retention.Backup{Name: name, Series: series, Time: t}}
+		byName[name] = b
+		*list = append(*list, b)
+	}
+	if strings.HasSuffix(base, manifest.Suffix) {
+		b.Paths = append([]string{p}, b.Paths...)
+	} else {
+		b.Paths = append(b.Paths, p)
+		b.HasData = true
+	}
+	return b
+}
+
+// legacySeries 旧版本的 mysqldump 单库备份名不含库名（mysql_<时间>），同一目标中不同库的备份
+// 前缀相同，按清单中的数据库归入 mysql_<库名> 系列，与现在的备份名一致，互不挤占名额。
+func legacySeries(b *prunable, m *manifest.Manifest) {
+	if b.Series == "mysql" && m.Engine == "mysql" && m.Tool == "mysqldump" && len(m.Databases) == 1 {
+		b.Series = "mysql_" + m.Databases[0]
+	}
+}
+
+// expired 按策略返回要删除的备份
+func expired(p retention.Policy, list []*prunable) []*prunable {
+	byName := map[string]*prunable{}
+	backups := make([]retention.Backup, len(list))
+	for i, b := range list {
+		byName[b.Name] = b
+		backups[i] = b.Backup
+	}
+	var out []*prunable
+	for _, e := range p.Expired(backups, time.Now()) {
+		out = append(out, byName[e.Name])
+	}
+	return out
+}
+
+// pruneLocal 按保留策略删除目标输出目录中过期的备份和清单，返回已删除的备份名，dryRun 时只报告。
+// 清单为成功的备份，以及没有清单的旧备份，才占用日、周、月、年的名额。
+func pruneLocal(tc TargetConfig, dryRun bool) ([]string, error) {
+	entries, err := os.ReadDir(tc.OutputDir)
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]*prunable{}
+	var list []*prunable
+	for _, e := range entries {
+		fp := filepath.Join(tc.OutputDir, e.Name())
+		b := collect(byName, &list, e.Name(), fp)
+		if b == nil || !strings.HasSuffix(e.Name(), manifest.Suffix) {
+			continue
+		}
+		if m, err := manifest.Read(fp); err == nil {
+			b.Manifest, b.Parent = m.Status, m.Parent
+			legacySeries(b, m)
+		} else {
+			b.Manifest = "unreadable"
+		}
+	}
+	for _, b := range list {
+		b.Complete = b.Manifest == manifest.StatusSuccess || (b.Manifest == "" && b.HasData)
+	}
+	var pruned []string
+	for _, b := range expired(tc.Retention, list) {
+		for _, fp := range b.Paths {
+			if dryRun {
+				fmt.Printf("[%s] Would remove %s\n", tc.Name, fp)
+				continue
+			}
+			if err := os.RemoveAll(fp); err != nil {
+				return pruned, err
+			}
+			fmt.Printf("[%s] Removed %s\n", tc.Name, fp)
+		}
+		if !dryRun {
+			pruned = append(pruned, b.Name)
+		}
+	}
+	return pruned, nil
+}
+
+// pruneStorage 按保留策略删除存储中 <name>/ 下过期的备份，返回已删除的备份名，有清单的备份才算完整。
+// 每个备份先删除清单，中途失败时剩下的文件不会被当作完整的备份。dryRun 时只报告。
+func pruneStorage(tc TargetConfig, s storage.Storage, dryRun bool) ([]string, error) {
+	objects, err := s.List(tc.Name + "/")
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]*prunable{}
+	var list []*prunable
+	for _, o := range objects {
+		rel := strings.TrimPrefix(o.Name, tc.Name+"/")
+		top, _, _ := strings.Cut(rel, "/")
+		if b := collect(byName, &list, top, o.Name); b != nil && top == b.Name+manifest.Suffix {
+			b.Manifest = manifest.StatusSuccess
+		}
+	}
+	for _, b := range list {
+		b.Complete = b.Manifest != ""
+		if b.Complete && b.Series == "mysql" {
+			m, err := storageManifest(s, path.Join(tc.Name, b.Name+manifest.Suffix))
+			if err != nil {
+				return nil, err
+			}
+			legacySeries(b, m)
+		}
+	}
+	var pruned []string
+	for _, b := range expired(tc.Retention, list) {
+		if dryRun {
+			fmt.Printf("[%s] Would remove %s/%s (%d file(s))\n", tc.Name, s, path.Join(tc.Name, b.Name), len(b.Paths))
+			continue
+		}
+		for _, key := range b.Paths {
+			if err := s.Delete(key); err != nil {
+				return pruned, fmt.Errorf("delete %s: %v", key, err)
+			}
+		}
+		fmt.Printf("[%s] Removed %s/%s (%d file(s))\n", tc.Name, s, path.Join(tc.Name, b.Name), len(b.Paths))
+		pruned = append(pruned, b.Name)
+	}
+	return pruned, nil
+}
+
+// storageManifest 读取存储中的清单。
+func storageManifest(s storage.Storage, key string) (*manifest.Manifest, error) {
+	r, err := s.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var m manifest.Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("parse manifest %s: %w", key, err)
+	}
+	return &m, nil
+}
+
+// pruneJob 按目标的保留策略清理输出目录和存储，返回已删除的备份（"local: 备份名" 或 "storage: 备份名"）
+func pruneJob(tc TargetConfig, dryRun bool) ([]string, error) {
+	if tc.Retention.IsZero() {
+		fmt.Printf("[%s] No retention configured, skipped\n", tc.Name)
+		return nil, nil
+	}
+	fmt.Printf("[%s] Retention: %s\n", tc.Name, tc.Retention)
+	var errs, pruned []string
+	local, err := pruneLocal(tc, dryRun)
+	for _, name := range local {
+		pruned = append(pruned, "local: "+name)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		errs = append(errs, "local: "+err.Error())
+	}
+	if tc.Storage.URL != "" {
+		remote, err := func() ([]string, error) {
+			s, err := storage.Open(tc.Storage)
+			if err != nil {
+				return nil, err
+			}
+			defer s.Close()
+			return pruneStorage(tc, s, dryRun)
+		}()
+		for _, name := range remote {
+			pruned = append(pruned, "storage: "+name)
+		}
+		if err != nil {
+			errs = append(errs, "storage: "+err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return pruned, errors.New(strings.Join(errs, "; "))
+	}
+	return pruned, nil
+}
+
+// runPrune 按保留策略清理配置中选中的目标，dryRun 时只列出将被删除的备份
+func runPrune(configPath string, names []string, dryRun bool) error {
+	cfg, err := loadJobsConfig(configPath)
+	if err != nil {
+		return err
+	}
+	selected, err := cfg.selectTargets(names)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, tc := range selected {
+		if _, err := pruneJob(tc, dryRun); err != nil {
+			fmt.Printf("[%s] Prune failed: %v\n", tc.Name, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d targets failed", failed, len(selected))
+	}
+	return nil
+}
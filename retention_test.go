@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/LYcoding0/dbbackup/internal/manifest"
+	"github.com/LYcoding0/dbbackup/internal/retention"
+	"github.com/LYcoding0/dbbackup/internal/storage"
+)
+
+// writeBackup 在 dir 中写入一份成功的 mysqldump 单库备份及其清单
+func writeBackup(t *testing.T, dir, name, db string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name+".sql"), []byte("-- dump\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := manifest.New(name)
+	m.Engine, m.Tool, m.Databases, m.Status = "mysql", "mysqldump", []string{db}, manifest.StatusSuccess
+	if err := manifest.Write(manifest.PathFor(dir, name), m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// remaining 返回 dir 中剩下的备份名
+func remaining(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		if filepath.Ext(e.Name()) == ".sql" {
+			names = append(names, e.Name()[:len(e.Name())-len(".sql")])
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// stamp 返回 n 天前中午的备份时间，sec 用于错开同一时刻的备份名
+func stamp(n, sec int) string {
+	y, m, d := time.Now().AddDate(0, 0, -n).Date()
+	return time.Date(y, m, d, 12, 0, sec, 0, time.Local).Format(backupTimeLayout)
+}
+
+// 同一目标中两个库各自保留最近两天的备份，不会因为共用前缀删掉另一个库的备份
+func TestPruneLocalTwoDatabases(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		backup func(db string, n int) string
+	}{
+		{"named", func(db string, n int) string { return "mysql_" + db + "_" + stamp(n, 0) }},
+		// 旧版本的备份名不含库名，按清单中的数据库区分；同一秒的名称会冲突，两个库错开一秒
+		{"legacy", func(db string, n int) string {
+			if db == "payments" {
+				return "mysql_" + stamp(n, 1)
+			}
+			return "mysql_" + stamp(n, 0)
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tc := TargetConfig{Name: "orders-mysql", OutputDir: dir, Retention: retention.Policy{Daily: 2}}
+			var want []string
+			for n := 3; n >= 0; n-- {
+				for _, db := range []string{"orders", "payments"} {
+					writeBackup(t, dir, tt.backup(db, n), db)
+					if n <= 1 {
+						want = append(want, tt.backup(db, n))
+					}
+				}
+			}
+			sort.Strings(want)
+			if _, err := pruneLocal(tc, false); err != nil {
+				t.Fatal(err)
+			}
+			if got := remaining(t, dir); !equal(got, want) {
+				t.Errorf("remaining = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// 存储中的旧备份同样按清单中的数据库区分系列
+func TestPruneStorageLegacyTwoDatabases(t *testing.T) {
+	remote := t.TempDir()
+	tc := TargetConfig{Name: "orders-mysql", OutputDir: t.TempDir(), Retention: retention.Policy{Daily: 1}}
+	s, err := storage.Open(storage.Config{URL: remote})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	dir := filepath.Join(remote, tc.Name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeBackup(t, dir, "mysql_"+stamp(1, 0), "orders")
+	writeBackup(t, dir, "mysql_"+stamp(0, 0), "orders")
+	writeBackup(t, dir, "mysql_"+stamp(0, 1), "payments")
+	pruned, err := pruneStorage(tc, s, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"mysql_" + stamp(1, 0)}; !equal(pruned, want) {
+		t.Errorf("pruned = %v, want %v", pruned, want)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/LYcoding0/dbbackup/internal/manifest"
+	"github.com/LYcoding0/dbbackup/internal/storage"
+)
+
+// withStorage 打开 url 指定的存储并执行 fn
+func withStorage(url string, fn func(s storage.Storage) error) error {
+	s, err := storage.Open(storage.Config{URL: url})
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return fn(s)
+}
+
+// uploadBackup 上传清单中的备份文件（或目录）到 storage 的 prefix 下，
+// 与清单中的大小和 SHA-256 比对无误后最后上传清单
+func uploadBackup(s storage.Storage, outputDir, prefix string, m *manifest.Manifest) error {
+	// 清单中的路径相对于 outputDir，第一段即备份文件名或目录名
+	var tops []string
+	for _, f := range m.Files {
+		top, _, _ := strings.Cut(f.Path, "/")
+		if len(tops) == 0 || tops[len(tops)-1] != top {
+			tops = append(tops, top)
+		}
+	}
+	for _, top := range tops {
+		key := path.Join(prefix, top)
+		fmt.Printf("Uploading %s to %s\n", key, s)
+		if err := storage.PutPath(s, filepath.Join(outputDir, top), key); err != nil {
+			return err
+		}
+	}
+	manifestKey := path.Join(prefix, m.Name+manifest.Suffix)
+	for _, f := range m.Files {
+		key := path.Join(prefix, f.Path)
+		if err := storage.Verify(s, key, f.Size, f.SHA256); err != nil {
+			if errors.Is(err, storage.ErrMismatch) {
+				// 不留下损坏的副本，也不留下表示上传完成的清单
+				s.Delete(key)
+				s.Delete(manifestKey)
+			}
+			return err
+		}
+	}
+	return storage.PutPath(s, filepath.Join(outputDir, m.Name+manifest.Suffix), manifestKey)
+}
+
+// fetchBackup 下载存储中的备份（文件或目录）及其清单到 dir，有清单时校验大小和 SHA-256，返回本地路径
+func fetchBackup(s storage.Storage, key, dir string) (string, error) {
+	key = strings.Trim(path.Clean("/"+key), "/")
+	if key == "" {
+		return "", errors.New("empty storage key")
+	}
+	local := filepath.Join(dir, path.Base(key))
+	fmt.Printf("Downloading %s from %s\n", key, s)
+	if err := storage.GetPath(s, key, local); err != nil {
+		return "", err
+	}
+	// 清单不是必需的，旧备份可能没有
+	if !strings.HasSuffix(key, manifest.Suffix) {
+		name := backupName(key) + manifest.Suffix
+		manifestPath := filepath.Join(dir, name)
+		err := storage.GetPath(s, path.Join(path.Dir(key), name), manifestPath)
+		if errors.Is(err, storage.ErrNotExist) {
+			return local, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		m, err := manifest.Read(manifestPath)
+		if err != nil {
+			return "", err
+		}
+		if _, err := m.Check(dir, path.Base(key)); err != nil {
+			os.RemoveAll(local)
+			return "", fmt.Errorf("fetch %s: %w", key, err)
+		}
+	}
+	return local, nil
+}
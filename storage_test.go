@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LYcoding0/dbbackup/internal/manifest"
+	"github.com/LYcoding0/dbbackup/internal/storage"
+)
+
+func TestFetchBackupVerifies(t *testing.T) {
+	src, remote := t.TempDir(), t.TempDir()
+	name := "mysql_app_20240501_020000"
+	if err := os.WriteFile(filepath.Join(src, name+".sql.gz"), []byte("compressed dump"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := manifest.New(name)
+	m.Status = manifest.StatusSuccess
+	if err := m.AddPath(src, filepath.Join(src, name+".sql.gz")); err != nil {
+		t.Fatal(err)
+	}
+	if err := manifest.Write(manifest.PathFor(src, name), m); err != nil {
+		t.Fatal(err)
+	}
+	s, err := storage.Open(storage.Config{URL: remote})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := uploadBackup(s, src, "mysql", m); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	local, err := fetchBackup(s, "mysql/"+name+".sql.gz", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if local != filepath.Join(dir, name+".sql.gz") {
+		t.Errorf("local = %s", local)
+	}
+
+	// 存储中的文件损坏（大小不变）时报错，不留下下载的文件
+	if err := os.WriteFile(filepath.Join(remote, "mysql", name+".sql.gz"), []byte("corrupted dump!"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dir = t.TempDir()
+	if _, err := fetchBackup(s, "mysql/"+name+".sql.gz", dir); err == nil || !strings.Contains(err.Error(), "sha256") {
+		t.Errorf("fetch of a corrupted file: err = %v, want a sha256 mismatch", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, name+".sql.gz")); !os.IsNotExist(err) {
+		t.Errorf("corrupted download left behind: %v", err)
+	}
+
+	// 没有清单的旧备份不校验
+	if err := os.Remove(filepath.Join(remote, "mysql", name+manifest.Suffix)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fetchBackup(s, "mysql/"+name+".sql.gz", t.TempDir()); err != nil {
+		t.Errorf("fetch without a manifest: %v", err)
+	}
+}
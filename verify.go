@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/LYcoding0/dbbackup/internal/crypt"
+	"github.com/LYcoding0/dbbackup/internal/verify"
+)
+
+// runVerify 校验备份文件、目录或清单，逐项打印结果，全部通过时返回 nil
+func runVerify(inputPath string, key *crypt.Key) error {
+	results := verify.Path(inputPath, verify.Options{Key: key})
+	for _, r := range results {
+		fmt.Println(r)
+	}
+	if failed := verify.Failed(results); failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(results))
+	}
+	return nil
+}